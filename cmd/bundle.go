@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tilt-valid/cmd/config"
+	"tilt-valid/internal/keypair"
+	mpc "tilt-valid/internal/mpc"
+	"tilt-valid/internal/solanarpc"
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// runBundle moves a payout through offline signing: an online machine
+// exports the unsigned transaction, validators without RPC access sign it
+// with the threshold key in an MPC round, and the online machine broadcasts
+// the signed bundle
+func runBundle(args []string) error {
+	usage := fmt.Errorf("usage: bundle export -authority <threshold key> -out file <receiver>=<lamports>... | bundle inspect <file> | bundle sign <validator_id> <file> | bundle submit <file>")
+	if len(args) < 1 {
+		return usage
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "export":
+		flags := flag.NewFlagSet("bundle export", flag.ContinueOnError)
+		authorityKey := flags.String("authority", "", "threshold key authorizing the payment")
+		out := flags.String("out", "", "bundle file to write")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *authorityKey == "" || *out == "" || flags.NArg() == 0 {
+			return usage
+		}
+		authority, err := solana.PublicKeyFromBase58(*authorityKey)
+		if err != nil {
+			return fmt.Errorf("invalid authority: %v", err)
+		}
+		payment, err := parsePayment(flags.Args())
+		if err != nil {
+			return err
+		}
+		return exportBundle(ctx, cfg, authority, payment, *out)
+
+	case "inspect":
+		if len(args) != 2 {
+			return usage
+		}
+		b, err := solanatx.ReadBundle(args[1])
+		if err != nil {
+			return err
+		}
+		printBundle(b)
+		return nil
+
+	case "sign":
+		if len(args) != 3 {
+			return usage
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid validator id: %v", err)
+		}
+		return signBundle(ctx, cfg, id, args[2])
+
+	case "submit":
+		if len(args) != 2 {
+			return usage
+		}
+		b, err := solanatx.ReadBundle(args[1])
+		if err != nil {
+			return err
+		}
+		tx, err := b.Transaction()
+		if err != nil {
+			return err
+		}
+		journal, err := solanarpc.OpenJournal(filepath.Join(cfg.ValidatorPath, "submissions_bundle.jsonl"))
+		if err != nil {
+			return err
+		}
+		// A bundle cannot be signed again here, so an expired one is reported
+		recent := solanarpc.Blockhash{Hash: tx.Message.RecentBlockhash, LastValidBlockHeight: b.LastValidBlockHeight}
+		submitter := solanarpc.NewSubmitter(solanarpc.New(cfg.SolanaRPC), journal)
+		sig, err := submitter.SubmitSigned(ctx, "bundle:"+tx.Signatures[0].String(), tx, recent, nil)
+		if err != nil {
+			return err
+		}
+		logSuccess(fmt.Sprintf("Transaction confirmed! Signature: %s", sig))
+		return nil
+	}
+	return usage
+}
+
+// parsePayment reads receiver=lamports arguments
+func parsePayment(args []string) (solanatx.Payment, error) {
+	var payment solanatx.Payment
+	for _, arg := range args {
+		receiver, amount, ok := strings.Cut(arg, "=")
+		if !ok {
+			return payment, fmt.Errorf("invalid payout %q, want <receiver>=<lamports>", arg)
+		}
+		key, err := solana.PublicKeyFromBase58(receiver)
+		if err != nil {
+			return payment, fmt.Errorf("invalid receiver %q: %v", receiver, err)
+		}
+		lamports, err := strconv.ParseUint(amount, 10, 64)
+		if err != nil {
+			return payment, fmt.Errorf("invalid amount %q: %v", amount, err)
+		}
+		payment.Receivers = append(payment.Receivers, key)
+		payment.Amounts = append(payment.Amounts, lamports)
+		payment.TotalAmount += lamports
+	}
+	return payment, payment.Validate()
+}
+
+// exportBundle builds the payout as one transaction over the configured
+// durable nonce or a recent blockhash, signs it with the local fee payer when
+// one is configured and writes it for the threshold key to sign
+func exportBundle(ctx context.Context, cfg *config.Config, authority solana.PublicKey, payment solanatx.Payment, out string) error {
+	client := solanarpc.New(cfg.SolanaRPC)
+	localKey, err := keypair.Open(cfg.KeypairPath)
+	if err != nil {
+		return err
+	}
+	feePayer := authority
+	if localKey != nil {
+		feePayer = localKey.PublicKey()
+	}
+
+	validate, err := solanatx.NewPaymentInstruction(solanatx.ProgramID, authority, payment)
+	if err != nil {
+		return err
+	}
+	transfers, err := solanatx.TransferInstructions(authority, nil, payment)
+	if err != nil {
+		return err
+	}
+	instructions, err := computeBudget(cfg).Apply(append([]solana.Instruction{validate}, transfers...))
+	if err != nil {
+		return fmt.Errorf("invalid compute budget: %v", err)
+	}
+
+	// Offline signing can take long, which a durable nonce survives
+	var recent solanarpc.Blockhash
+	var tx *solana.Transaction
+	if len(cfg.NonceAccounts) > 0 {
+		nonces, err := loadNonces(ctx, client, cfg.NonceAccounts[:1], authority)
+		if err != nil {
+			return err
+		}
+		nonce := nonces[0]
+		recent = solanarpc.DurableBlockhash(nonce)
+		tx, err = solanatx.NewDurableTransaction(instructions, nonce, feePayer)
+		if err != nil {
+			return err
+		}
+	} else {
+		logWarning("No SOLANA_NONCE_ACCOUNT configured, the bundle expires with its blockhash in about a minute")
+		recent, err = client.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+		if err != nil {
+			return fmt.Errorf("failed to get recent blockhash: %v", err)
+		}
+		tx, err = solana.NewTransaction(instructions, recent.Hash, solana.TransactionPayer(feePayer))
+		if err != nil {
+			return fmt.Errorf("failed to create transaction: %v", err)
+		}
+	}
+	size, err := solanatx.Size(tx)
+	if err != nil {
+		return err
+	}
+	if size > solanatx.MaxTransactionSize {
+		return fmt.Errorf("payout needs %d bytes, more than the %d of one transaction: export fewer receivers", size, solanatx.MaxTransactionSize)
+	}
+	if err := priceTransaction(ctx, cfg, client, tx); err != nil {
+		return err
+	}
+	if localKey != nil {
+		if err := solanatx.Sign(ctx, tx, feePayer, solanatx.KeySigner(localKey)); err != nil {
+			return err
+		}
+	}
+
+	b, err := solanatx.NewBundle(tx, authority, recent.LastValidBlockHeight, map[string]string{
+		"receivers": strconv.Itoa(len(payment.Receivers)),
+		"total":     strconv.FormatUint(payment.TotalAmount, 10),
+		"created":   time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	if err := solanatx.WriteBundle(out, b); err != nil {
+		return err
+	}
+	logSuccess(fmt.Sprintf("Exported bundle %s for %s to sign", out, authority))
+	return nil
+}
+
+// printBundle shows what a bundle asks validators to sign
+func printBundle(b *solanatx.Bundle) {
+	fmt.Printf("Version:   %d\nChecksum:  %s\nExpires:   block height %d\n", b.Version, b.Checksum, b.LastValidBlockHeight)
+	keys := make([]string, 0, len(b.Metadata))
+	for key := range b.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("%-10s %s\n", key+":", b.Metadata[key])
+	}
+	for i, signer := range b.Signers {
+		status := "signed"
+		if b.Signatures[i].IsZero() {
+			status = "unsigned"
+		}
+		if i == b.SignerIndex {
+			status += ", threshold key"
+		}
+		fmt.Printf("Signer %d:  %s (%s)\n", i, signer, status)
+	}
+	if tx, err := b.Transaction(); err == nil {
+		fmt.Println(tx.String())
+	}
+}
+
+// signBundle signs the bundle at path with the threshold key, together with
+// the other validators signing it. It needs no RPC access: the transport and
+// the key share saved by DKG are local.
+func signBundle(ctx context.Context, cfg *config.Config, id int, path string) error {
+	b, err := solanatx.ReadBundle(path)
+	if err != nil {
+		return err
+	}
+	n, err := startNode(ctx, cfg, id, "bundle")
+	if err != nil {
+		return err
+	}
+	if err := n.party.LoadLocalPartySaveData(); err != nil {
+		return fmt.Errorf("no key share, run DKG first: %v", err)
+	}
+	pk, err := n.party.ThresholdPK()
+	if err != nil {
+		return err
+	}
+	authority, err := solanatx.ThresholdAccount(pk)
+	if err != nil {
+		return err
+	}
+	if !authority.Equals(b.Signer()) {
+		return fmt.Errorf("bundle waits on %s, not the threshold key %s", b.Signer(), authority)
+	}
+
+	logInfo("Waiting for peer validators...")
+	waitCtx, cancelWait := context.WithTimeout(ctx, 60*time.Second)
+	err = n.monitor.WaitForPeers(waitCtx, threshold)
+	cancelWait()
+	if err != nil {
+		return fmt.Errorf("peers unavailable: %v", err)
+	}
+	// Every validator must sign with the same signers, whatever its view
+	signCtx, cancelSign := context.WithTimeout(ctx, signingTimeout)
+	defer cancelSign()
+	decision, err := n.agreement.Decide(signCtx, fmt.Sprintf("bundle:%x", mpc.Digest(b.Message)), n.parties, nil)
+	if err != nil {
+		return err
+	}
+	signers := decision.Signers
+	if !slices.Contains(signers, uint16(id)) {
+		return fmt.Errorf("validators %v sign the bundle, run sign on one of them", signers)
+	}
+	logInfo(fmt.Sprintf("Signing with validators %v", signers))
+	n.beginSigning(signers, b.Message)
+
+	if err := b.Sign(signCtx, n.party.SignSolanaMessage); err != nil {
+		return fmt.Errorf("failed to sign bundle with MPC: %v", err)
+	}
+	if err := solanatx.WriteBundle(path, b); err != nil {
+		return err
+	}
+	logSuccess(fmt.Sprintf("Signed bundle %s as %s", path, authority))
+	return nil
+}
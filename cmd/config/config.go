@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +16,44 @@ type Config struct {
 	TransportPath   string
 	TiltDb          string
 	Distribution    string
+
+	// Randomness backend: "beacon" (default), "local" or "chainlink"
+	RandomnessSource  string
+	BeaconPath        string
+	VRFOracleEndpoint string
+	VRFOracleProgram  string
+	VRFOracleKey      string
+
+	// Solana JSON-RPC endpoint, devnet by default
+	SolanaRPC string
+
+	// Durable nonce accounts advanced by the threshold key, comma separated:
+	// the first for the ballot results and each other for one payout
+	// transaction. None builds over recent blockhashes.
+	NonceAccounts []string
+
+	// Address lookup table extended by the threshold key. Payouts over
+	// recent blockhashes are then v0 transactions naming their accounts
+	// through it, and the signers extend it with the ones it lacks.
+	LookupTable string
+
+	// Solana CLI keypair paying for one-off commands: nonce and lookup
+	// table creation and bundle export. Validators never use it; the
+	// threshold key pays for everything they sign.
+	KeypairPath string
+
+	// Directory of this node's MPC key share, ~/.solmpc/shares by default.
+	// Like the keypair it must lie outside the repository.
+	KeyShareDir string
+
+	// Compute budget of submitted transactions: the unit limit, 0 for the
+	// cluster default, and the price in micro-lamports per unit. A non-zero
+	// percentile raises the price to that percentile of recent
+	// prioritization fees, capped at PriorityFeeMax when it is set.
+	ComputeUnitLimit      uint32
+	ComputeUnitPrice      uint64
+	PriorityFeePercentile int
+	PriorityFeeMax        uint64
 }
 
 func LoadConfig() (*Config, error) {
@@ -28,17 +69,99 @@ func LoadConfig() (*Config, error) {
 		tiltDb = "/Users/yash/Documents/SolMPC-Node/utils/tiltdb.csv"
 	}
 
+	randomnessSource := os.Getenv("RANDOMNESS_SOURCE")
+	if randomnessSource == "" {
+		randomnessSource = "beacon"
+	}
+
+	beaconPath := os.Getenv("BEACON_PATH")
+	if beaconPath == "" {
+		beaconPath = filepath.Join(os.Getenv("VALIDATOR_PATH"), "beacon")
+	}
+
+	solanaRPC := os.Getenv("SOLANA_RPC_URL")
+	if solanaRPC == "" {
+		solanaRPC = "https://api.devnet.solana.com"
+	}
+
+	keyShareDir := os.Getenv("KEY_SHARE_DIR")
+	if keyShareDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("KEY_SHARE_DIR is not set and there is no home directory: %v", err)
+		}
+		keyShareDir = filepath.Join(home, ".solmpc", "shares")
+	}
+
+	computeUnitLimit, err := parseUint("COMPUTE_UNIT_LIMIT", 32)
+	if err != nil {
+		return nil, err
+	}
+	computeUnitPrice, err := parseUint("COMPUTE_UNIT_PRICE", 64)
+	if err != nil {
+		return nil, err
+	}
+	priorityFeePercentile, err := parseUint("PRIORITY_FEE_PERCENTILE", 8)
+	if err != nil {
+		return nil, err
+	}
+	priorityFeeMax, err := parseUint("PRIORITY_FEE_MAX", 64)
+	if err != nil {
+		return nil, err
+	}
+
 	config := &Config{
-		SolanaProductId: os.Getenv("SOLANA_PRODUCT_ID"),
-		ValidatorPath:   os.Getenv("VALIDATOR_PATH"),
-		TransportPath:   os.Getenv("TRANSPORT_PATH"),
-		TiltDb:          tiltDb,
-		Distribution:    os.Getenv("DISTRIBUTION_DUMP"),
+		SolanaProductId:   os.Getenv("SOLANA_PRODUCT_ID"),
+		ValidatorPath:     os.Getenv("VALIDATOR_PATH"),
+		TransportPath:     os.Getenv("TRANSPORT_PATH"),
+		TiltDb:            tiltDb,
+		Distribution:      os.Getenv("DISTRIBUTION_DUMP"),
+		RandomnessSource:  randomnessSource,
+		BeaconPath:        beaconPath,
+		VRFOracleEndpoint: os.Getenv("VRF_ORACLE_ENDPOINT"),
+		VRFOracleProgram:  os.Getenv("VRF_ORACLE_PROGRAM"),
+		VRFOracleKey:      os.Getenv("VRF_ORACLE_PUBKEY"),
+		SolanaRPC:         solanaRPC,
+		NonceAccounts:     parseList("SOLANA_NONCE_ACCOUNT"),
+		LookupTable:       os.Getenv("LOOKUP_TABLE"),
+		KeypairPath:       os.Getenv("SOLANA_KEYPAIR"),
+		KeyShareDir:       keyShareDir,
+
+		ComputeUnitLimit:      uint32(computeUnitLimit),
+		ComputeUnitPrice:      computeUnitPrice,
+		PriorityFeePercentile: int(priorityFeePercentile),
+		PriorityFeeMax:        priorityFeeMax,
 	}
 
 	return config, nil
 }
 
+// parseUint reads an unsigned integer of bitSize bits from the environment,
+// 0 when the variable is not set
+func parseUint(name string, bitSize int) (uint64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return n, nil
+}
+
+// parseList reads a comma separated list from the environment, dropping
+// blanks
+func parseList(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // func main() {
 // 	cfg, err := config.LoadConfig()
 // 	if err != nil {
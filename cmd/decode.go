@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"tilt-valid/internal/anchor"
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// runDecode prints the call made by instruction data, hex or base58 as
+// explorers show it, using the payment_validator IDL or the one given
+func runDecode(args []string) error {
+	flags := flag.NewFlagSet("decode", flag.ContinueOnError)
+	idlPath := flags.String("idl", "", "Anchor IDL of the program, payment_validator by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: decode [-idl file] <instruction data>")
+	}
+
+	idl := solanatx.PaymentValidator
+	if *idlPath != "" {
+		data, err := os.ReadFile(*idlPath)
+		if err != nil {
+			return err
+		}
+		if idl, err = anchor.ParseIDL(data); err != nil {
+			return err
+		}
+	}
+
+	data, err := hex.DecodeString(flags.Arg(0))
+	if err != nil {
+		var b58 solana.Base58
+		if err := json.Unmarshal([]byte(strconv.Quote(flags.Arg(0))), &b58); err != nil {
+			return fmt.Errorf("instruction data is neither hex nor base58")
+		}
+		data = b58
+	}
+	ix, values, err := idl.Decode(data)
+	if err != nil {
+		return err
+	}
+	fmt.Println(ix.Format(values))
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"tilt-valid/internal/distribution"
+)
+
+// runExplain distributes the root tilts of a tilt file and prints how every
+// payout was produced, as one tree per asset or, with -json, as the full
+// traced distributions
+func runExplain(args []string) error {
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	rounding := flags.String("rounding", distribution.LargestRemainder.String(), "rounding policy")
+	treasury := flags.String("treasury", "", "receiver of rounding dust under the treasury policy")
+	seed := flags.String("seed", "", "seed for the seeded-random policy")
+	asJSON := flags.Bool("json", false, "print the traced distributions as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		return fmt.Errorf("usage: explain [-rounding name] [-treasury receiver] [-seed seed] [-json] <tilts file> <root tilt>...")
+	}
+
+	var roots []int
+	for _, arg := range flags.Args()[1:] {
+		root, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid root tilt %q", arg)
+		}
+		roots = append(roots, root)
+	}
+	tilts, err := distribution.LoadTilts(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	policy, err := distribution.ParseRounding(*rounding)
+	if err != nil {
+		return err
+	}
+
+	// Every asset is distributed with the same options
+	options := distribution.Options{Rounding: policy, Treasury: *treasury, Seed: []byte(*seed), Trace: true}
+	opts := map[distribution.Asset]distribution.Options{distribution.NativeSOL: options}
+	for _, tilt := range tilts {
+		if tilt.Asset != "" {
+			opts[tilt.Asset] = options
+		}
+	}
+	distributions, err := distribution.DistributeAssets(tilts, roots, opts)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(distributions)
+	}
+	for _, asset := range distributions.Assets() {
+		d := distributions[asset]
+		separator(fmt.Sprintf("Distribution of %s (total %d)", asset, d.Total))
+		if err := d.Trace.WriteTree(os.Stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"tilt-valid/cmd/config"
+	"tilt-valid/internal/solanarpc"
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// computeBudget is the compute budget every transaction is built with. When
+// compute units are priced from recent fees, the price is a placeholder
+// until priceTransaction or signing terms replace it, so that the
+// instruction setting it counts towards the transaction's size.
+func computeBudget(cfg *config.Config) solanatx.ComputeBudget {
+	budget := solanatx.ComputeBudget{UnitLimit: cfg.ComputeUnitLimit, UnitPrice: cfg.ComputeUnitPrice}
+	if cfg.PriorityFeePercentile > 0 && budget.UnitPrice == 0 {
+		budget.UnitPrice = 1
+	}
+	return budget
+}
+
+// unitPrice estimates the compute unit price of tx from the fees recently
+// paid for the accounts it writes, falling back to COMPUTE_UNIT_PRICE
+func unitPrice(ctx context.Context, cfg *config.Config, client solanarpc.SolanaClient, tx *solana.Transaction) uint64 {
+	estimator := solanarpc.NewFeeEstimator(client)
+	estimator.Percentile = cfg.PriorityFeePercentile
+	estimator.Min, estimator.Max = cfg.ComputeUnitPrice, cfg.PriorityFeeMax
+	var writable []solana.PublicKey
+	for _, account := range tx.Message.AccountKeys {
+		if ok, err := tx.Message.IsWritable(account); err == nil && ok {
+			writable = append(writable, account)
+		}
+	}
+	price, err := estimator.UnitPrice(ctx, writable)
+	if err != nil {
+		logWarning(fmt.Sprintf("Fee estimation failed, paying %d micro-lamports per unit: %v", cfg.ComputeUnitPrice, err))
+		return cfg.ComputeUnitPrice
+	}
+	return price
+}
+
+// priceTransaction prices the compute units of an unsigned tx built with
+// computeBudget, when PRIORITY_FEE_PERCENTILE asks for it. Only one machine
+// may price a transaction others sign too; validators agree on signing terms.
+func priceTransaction(ctx context.Context, cfg *config.Config, client solanarpc.SolanaClient, tx *solana.Transaction) error {
+	if cfg.PriorityFeePercentile == 0 {
+		return nil
+	}
+	return solanatx.SetUnitPrice(tx, unitPrice(ctx, cfg, client, tx))
+}
+
+// signingTerms is what the proposing validator fixes for a transaction on
+// behalf of all signers, since each signer builds the message itself and
+// all must build the very same one
+type signingTerms struct {
+	// Blockhash is absent for a transaction over a durable nonce
+	Blockhash *solanarpc.Blockhash `json:"blockhash,omitempty"`
+	// UnitPrice is absent unless compute units are priced from recent fees
+	UnitPrice *uint64 `json:"unit_price,omitempty"`
+}
+
+// proposeTerms returns the signing terms of tx a proposer offers: a recent
+// blockhash unless tx is durable, and the unit price of its accounts if it
+// was built with computeBudget
+func proposeTerms(cfg *config.Config, client solanarpc.SolanaClient, tx *solana.Transaction, durable bool) func(ctx context.Context) ([]byte, error) {
+	return func(ctx context.Context) ([]byte, error) {
+		var terms signingTerms
+		if !durable {
+			recent, err := client.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get recent blockhash: %w", err)
+			}
+			terms.Blockhash = &recent
+		}
+		if budget, _, err := solanatx.ParseComputeBudget(tx.Message); err == nil && budget.UnitPrice > 0 && cfg.PriorityFeePercentile > 0 {
+			price := unitPrice(ctx, cfg, client, tx)
+			terms.UnitPrice = &price
+		}
+		return json.Marshal(terms)
+	}
+}
+
+// applyTerms builds tx on the agreed signing terms, returning its blockhash
+// if they set one
+func applyTerms(tx *solana.Transaction, value []byte) (*solanarpc.Blockhash, error) {
+	var terms signingTerms
+	if err := json.Unmarshal(value, &terms); err != nil {
+		return nil, fmt.Errorf("invalid signing terms: %w", err)
+	}
+	if terms.UnitPrice != nil {
+		if err := solanatx.SetUnitPrice(tx, *terms.UnitPrice); err != nil {
+			return nil, err
+		}
+	}
+	if terms.Blockhash != nil {
+		tx.Message.RecentBlockhash = terms.Blockhash.Hash
+	}
+	return terms.Blockhash, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"tilt-valid/cmd/config"
+	"tilt-valid/internal/keypair"
+	mpc "tilt-valid/internal/mpc"
+	"tilt-valid/internal/solanarpc"
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// runLookup creates an address lookup table extended only by the threshold
+// key, or lists the addresses of one. Extensions need the threshold key's
+// signature, so validators make them in an MPC round.
+func runLookup(args []string) error {
+	usage := fmt.Errorf("usage: lookup create [-keypair file] -authority <threshold key> | lookup show <lookup table>")
+	if len(args) < 1 {
+		return usage
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+	client := solanarpc.New(cfg.SolanaRPC)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("lookup create", flag.ContinueOnError)
+		keypairPath := flags.String("keypair", cfg.KeypairPath, "keypair paying for the table")
+		authorityKey := flags.String("authority", "", "threshold key extending the table")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *keypairPath == "" || *authorityKey == "" {
+			return usage
+		}
+		authority, err := solana.PublicKeyFromBase58(*authorityKey)
+		if err != nil {
+			return fmt.Errorf("invalid authority: %v", err)
+		}
+		payer, err := keypair.Load(*keypairPath)
+		if err != nil {
+			return err
+		}
+		journal, err := solanarpc.OpenJournal(filepath.Join(cfg.ValidatorPath, "submissions_lookup.jsonl"))
+		if err != nil {
+			return err
+		}
+
+		table, err := solanarpc.NewSubmitter(client, journal).CreateLookupTable(ctx, payer, authority)
+		if err != nil {
+			return err
+		}
+		logSuccess(fmt.Sprintf("Created lookup table %s", table))
+		return nil
+
+	case "show":
+		if len(args) != 2 {
+			return usage
+		}
+		address, err := solana.PublicKeyFromBase58(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid lookup table: %v", err)
+		}
+		table, err := solanarpc.LoadLookupTable(ctx, client, address)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Table:     %s\nAuthority: %s\nAddresses: %d\n", table.Address, table.Authority, len(table.Addresses))
+		for i, address := range table.Addresses {
+			fmt.Printf("%5d  %s\n", i, address)
+		}
+		return nil
+	}
+	return usage
+}
+
+// extendLookupTable adds the addresses the lookup table of LOOKUP_TABLE is
+// missing. The threshold key extends it and pays for it, so each extension
+// takes an MPC round among signers over terms they agree on. Every signer
+// submits the extension, which holding the same signature lands once.
+func (n *node) extendLookupTable(ctx context.Context, cfg *config.Config, client solanarpc.SolanaClient, submitter *solanarpc.Submitter, authority solana.PublicKey, signers []uint16, addresses []solana.PublicKey) (solanatx.LookupTable, error) {
+	address, err := solana.PublicKeyFromBase58(cfg.LookupTable)
+	if err != nil {
+		return solanatx.LookupTable{}, fmt.Errorf("invalid LOOKUP_TABLE: %v", err)
+	}
+	table, err := solanarpc.LoadLookupTable(ctx, client, address)
+	if err != nil {
+		return solanatx.LookupTable{}, err
+	}
+	if !table.Authority.Equals(authority) {
+		return solanatx.LookupTable{}, fmt.Errorf("lookup table %s is extended by %s, not the threshold key %s", address, table.Authority, authority)
+	}
+
+	sign := func(ctx context.Context, tx *solana.Transaction) (solanarpc.Blockhash, error) {
+		signCtx, cancel := context.WithTimeout(ctx, signingTimeout)
+		defer cancel()
+		// Every signer builds the same extension, so it names the round
+		unsigned, err := tx.Message.MarshalBinary()
+		if err != nil {
+			return solanarpc.Blockhash{}, err
+		}
+		decision, err := n.agreement.Decide(signCtx, fmt.Sprintf("lookup:%x", mpc.Digest(unsigned)), signers, proposeTerms(cfg, client, tx, false))
+		if err != nil {
+			return solanarpc.Blockhash{}, err
+		}
+		recent, err := applyTerms(tx, decision.Value)
+		if err != nil {
+			return solanarpc.Blockhash{}, err
+		}
+		if recent == nil {
+			return solanarpc.Blockhash{}, fmt.Errorf("no blockhash agreed on for the lookup table extension")
+		}
+		message, err := tx.Message.MarshalBinary()
+		if err != nil {
+			return solanarpc.Blockhash{}, err
+		}
+		n.beginSigning(decision.Signers, message)
+		return *recent, solanatx.Sign(signCtx, tx, authority, n.party.SignSolanaMessage)
+	}
+	return submitter.ExtendLookupTable(ctx, table, authority, addresses, sign)
+}
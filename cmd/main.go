@@ -2,28 +2,25 @@ package main
 
 import (
 	"context"
-	"crypto/ed25519"
-	"crypto/sha256"
-	"encoding/binary"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"sort"
+	"slices"
 	"strconv"
 	"sync"
 	"time"
 
 	"tilt-valid/cmd/config"
-	"tilt-valid/internal/exchange"
-	mpc "tilt-valid/internal/mpc"
-	"tilt-valid/utils"
+	"tilt-valid/internal/keypair"
+	"tilt-valid/internal/solanarpc"
+	"tilt-valid/internal/solanatx"
+	"tilt-valid/internal/validators"
+	vrf "tilt-valid/internal/vrf"
 
-	"github.com/blocto/solana-go-sdk/types"
 	"github.com/gagliardetto/solana-go"
-	"github.com/gagliardetto/solana-go/rpc"
 )
 
 // No command line flags needed for ballot system
@@ -80,67 +77,106 @@ func main() {
 	flag.Parse()
 
 	if len(args) < 1 {
-		logError("Usage: go run main.go <validator_id>")
+		logError("Usage: go run main.go <validator_id> | status | explain <tilts file> <root tilt>... | nonce create|show ... | lookup create|show ... | bundle export|inspect|sign|submit ... | decode [-idl file] <instruction data>")
+		return
+	}
+	if args[0] == "status" {
+		if err := runStatus(); err != nil {
+			logError(err.Error())
+		}
+		return
+	}
+	if args[0] == "explain" {
+		if err := runExplain(args[1:]); err != nil {
+			logError(err.Error())
+		}
+		return
+	}
+	if args[0] == "nonce" {
+		if err := runNonce(args[1:]); err != nil {
+			logError(err.Error())
+		}
+		return
+	}
+	if args[0] == "lookup" {
+		if err := runLookup(args[1:]); err != nil {
+			logError(err.Error())
+		}
+		return
+	}
+	if args[0] == "decode" {
+		if err := runDecode(args[1:]); err != nil {
+			logError(err.Error())
+		}
+		return
+	}
+	if args[0] == "bundle" {
+		if err := runBundle(args[1:]); err != nil {
+			logError(err.Error())
+		}
 		return
 	}
 	id, _ := strconv.Atoi(args[0])
 	separator(fmt.Sprintf("Starting Validator ID: %d", id))
 
-	// Initialize RPC client for Devnet
-	client := rpc.New("https://api.devnet.solana.com")
-
-	programID, err := solana.PublicKeyFromBase58("EM7AAngMgQPXizeuwAKaBvci79DhRxJMBYjRVoJWYEH3")
+	// loading config
+	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("Invalid program ID: %v", err)
+		log.Fatalf("Error loading config: %v", err)
 	}
+	path := cfg.ValidatorPath
 
-	// Payer setup (replace with your actual keypair)
-	privateKeyBytes := [64]byte{16, 246, 168, 249, 237, 255, 125, 101, 217, 247, 127, 166, 74, 53, 162, 51, 171, 210, 214, 143, 114, 231, 90, 39, 199, 152, 51, 247, 155, 89, 49, 209, 188, 164, 235, 18, 201, 90, 220, 112, 187, 42, 70, 106, 82, 127, 58, 134, 94, 39, 122, 20, 109, 110, 8, 203, 126, 148, 192, 140, 5, 77, 75, 60}
-	wallet, err := types.AccountFromBytes(privateKeyBytes[:])
+	// Initialize the Solana RPC client, devnet unless SOLANA_RPC_URL is set
+	var client solanarpc.SolanaClient = solanarpc.New(cfg.SolanaRPC)
+
+	// Keys never live in the repository: refuse to start if one is found there
+	wd, err := os.Getwd()
 	if err != nil {
-		log.Fatalf("Failed to create wallet from private key: %v", err)
+		log.Fatalf("Failed to get working directory: %v", err)
 	}
-
-	// loading config
-	cfg, err := config.LoadConfig()
+	root, err := keypair.RepositoryRoot(wd)
 	if err != nil {
-		fmt.Println("error in loading config")
+		log.Fatalf("Failed to find repository root: %v", err)
+	}
+	if err := keypair.CheckRepository(root, cfg.KeypairPath, cfg.KeyShareDir); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
 	}
-	path := cfg.ValidatorPath
 
 	// No longer need tilt creation - using ballot system instead
 
-	validatorsFilePath := filepath.Join(path, "validators.csv")
-	validators, err := loadValidators(validatorsFilePath)
+	// Join the other validators: heartbeats share the transport with MPC messages
+	ctx := context.Background()
+	n, err := startNode(ctx, cfg, id, "main")
+	if err != nil {
+		logError(err.Error())
+		return
+	}
+	activeValidators, err := n.registry.Active()
 	if err != nil {
 		logError(fmt.Sprintf("Error loading validators: %v", err))
 		return
 	}
-	// transaction creation successfully created.
-
-	// Create a channel for incoming messages
-	receiveChan := make(chan []byte, 10000)
 
-	// Create a list of party IDs for message exchange
-	var parties []uint16
-	for i := range validators[1:] {
-		parties = append(parties, uint16(i+1))
+	// DKG needs every party, so wait until all of them answer heartbeats
+	logInfo("Waiting for peer validators...")
+	waitCtx, cancelWait := context.WithTimeout(ctx, 60*time.Second)
+	err = n.monitor.WaitForPeers(waitCtx, len(n.parties)-1)
+	cancelWait()
+	if err != nil {
+		logError(fmt.Sprintf("Peers unavailable: %v", err))
+		return
 	}
 
-	// Set up the transport and MPC party
-	transport := exchange.NewTransport(id, parties)
-	mpcParty := mpc.NewParty(uint16(id), utils.Logger(validators[id].ID, "main"))
-	mpcParty.Init(parties, threshold, transport.SendMsg)
-
 	separator("Distributed Key Generation (DKG)")
 	logInfo("Initiating DKG process...")
 
+	n.begin("keygen", n.parties)
 	wg.Add(1)
 	startTime := time.Now()
 	var keyShare []byte
 	go func() {
 		defer wg.Done()
-		keyShare, err = mpcParty.KeyGen(context.Background())
+		keyShare, err = n.party.KeyGen(context.Background())
 		if err != nil {
 			logError(fmt.Sprintf("Error performing DKG: %v", err))
 		} else {
@@ -148,19 +184,8 @@ func main() {
 		}
 	}()
 
-	// Start a goroutine to watch for incoming messages
-	go transport.WatchFile(1*time.Millisecond, receiveChan)
-	go func() {
-		for msg := range receiveChan {
-			var msgStructured exchange.Msg
-			json.Unmarshal(msg, &msgStructured)
-			mpcParty.OnMsg(msgStructured.Message, uint16(msgStructured.From), msgStructured.Broadcast)
-		}
-	}()
-
 	wg.Wait() // Wait for DKG to complete
 	logInfo(fmt.Sprintf("DKG completed in %.2f seconds", time.Since(startTime).Seconds()))
-	transport.DeleteFileData()
 
 	// Initialize Ballot System
 	separator("Ballot System Initialization")
@@ -205,198 +230,290 @@ func main() {
 	}
 	logInfo(fmt.Sprintf("Total votes cast: %d", totalVotes))
 
+	// The threshold key authorizes the payment, so no single validator holds
+	// the key behind it. It also pays the fees unless a local keypair is
+	// configured, which must then be the same on every validator.
+	n.party.SetShareData(keyShare)
+	pk, err := n.party.ThresholdPK()
+	if err != nil {
+		logError("Failed to get threshold public key")
+		return
+	}
+	authority, err := solanatx.ThresholdAccount(pk)
+	if err != nil {
+		log.Fatalf("Invalid threshold public key: %v", err)
+	}
+	// The threshold key pays the fees: validators hold no key of their own,
+	// and one signature from the MPC round makes the transaction valid
+	logInfo(fmt.Sprintf("Threshold PK: %s", authority))
+
 	// Create Solana instruction for vote result
-	// Use a consistent recipient across all validators for MPC signing
+	// Use a consistent recipient across all validators for MPC signing, with
+	// one entry per ballot option so receivers and amounts line up
 	fixedRecipient, _ := solana.PublicKeyFromBase58("11111111111111111111111111111112") // System Program
-	recipients := []solana.PublicKey{
-		fixedRecipient, // Results recipient - same across all validators
+	payment := solanatx.Payment{TotalAmount: totalVotes, Amounts: voteCounts}
+	for range voteCounts {
+		payment.Receivers = append(payment.Receivers, fixedRecipient) // Results recipient - same across all validators
 	}
 
-	// Step 4: Serialize Instruction Data for Vote Results
-	instructionData, err := serializeInstructionData(voteCounts, totalVotes, recipients)
+	// Step 4: Build the validate_payment_distribution instruction for the vote results
+	instruction, err := solanatx.NewPaymentInstruction(solanatx.ProgramID, authority, payment)
 	if err != nil {
-		log.Fatalf("Failed to serialize instruction data: %v", err)
+		log.Fatalf("Failed to build payment instruction: %v", err)
 	}
 
-	// Step 5: Prepare Accounts
-	accounts := []*solana.AccountMeta{
-		{PublicKey: solana.PublicKeyFromBytes(wallet.PublicKey[:]), IsSigner: true, IsWritable: true}, // Sender
+	// Step 5: Set the compute budget. With PRIORITY_FEE_PERCENTILE set, compute
+	// units are priced from recent prioritization fees when signing starts,
+	// so the payout lands in congestion.
+	budget := computeBudget(cfg)
+	instructions, err := budget.Apply([]solana.Instruction{instruction})
+	if err != nil {
+		log.Fatalf("Invalid compute budget: %v", err)
 	}
-
-	// Add recipient accounts
-	for _, recipient := range recipients {
-		accounts = append(accounts, &solana.AccountMeta{
-			PublicKey:  recipient,
-			IsSigner:   false,
-			IsWritable: true,
-		})
+	if budget != (solanatx.ComputeBudget{}) {
+		logInfo(fmt.Sprintf("Compute budget: %d units at %d micro-lamports each", budget.UnitLimit, budget.UnitPrice))
 	}
 
-	// Step 6: Create Instruction
-	instruction := solana.NewInstruction(programID, accounts, instructionData)
-	// Step 7: Get Recent Blockhash
-	ctx := context.Background()
-	recent, err := client.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
+	// Step 6: Load the durable nonces when configured, which keep the
+	// transactions valid however long signing takes
+	var recent solanarpc.Blockhash
+	var nonce *solanatx.DurableNonce
+	nonces, err := loadNonces(ctx, client, cfg.NonceAccounts, authority)
 	if err != nil {
-		log.Fatalf("Failed to get recent blockhash: %v", err)
+		log.Fatalf("Invalid durable nonce: %v", err)
+	}
+	if len(nonces) > 0 {
+		nonce, recent = &nonces[0], solanarpc.DurableBlockhash(nonces[0])
+		logInfo(fmt.Sprintf("Using durable nonce %s", nonce.Account))
 	}
 
-	// Step 8: Build Transaction
-	tx, err := solana.NewTransaction(
-		[]solana.Instruction{instruction},
-		recent.Value.Blockhash,
-		solana.TransactionPayer(solana.PublicKeyFromBytes(wallet.PublicKey[:])),
-	)
+	// Step 7: Build Transaction, without a nonce over the blockhash the
+	// signers agree on in step 8
+	var tx *solana.Transaction
+	if nonce != nil {
+		tx, err = solanatx.NewDurableTransaction(instructions, *nonce, authority)
+	} else {
+		tx, err = solana.NewTransaction(
+			instructions,
+			solana.Hash{},
+			solana.TransactionPayer(authority),
+		)
+	}
 	if err != nil {
 		log.Fatalf("Failed to create transaction: %v", err)
 	}
 
-	// Step 9: Sign Transaction with MPC
-	// Get the transaction message to sign
+	// Step 7b: Load the distribution to pay out once the results are
+	// confirmed. Each payout needs a durable nonce of its own, the ones after
+	// the results', or else gets a recent blockhash when it is signed.
+	var payments []assetPayment
+	var payoutNonces []solanatx.DurableNonce
+	if cfg.Distribution != "" {
+		payments, err = loadPayments(ctx, client, cfg.Distribution)
+		if err != nil {
+			log.Fatalf("Failed to load payouts: %v", err)
+		}
+		if len(nonces) > 1 {
+			payoutNonces = nonces[1:]
+		} else if len(nonces) == 1 {
+			logWarning("Only one durable nonce, paying out over recent blockhashes")
+		}
+		if cfg.LookupTable != "" && len(payoutNonces) > 0 {
+			logWarning("Durable payouts are legacy transactions, LOOKUP_TABLE is not used")
+		}
+	} else {
+		logInfo("No DISTRIBUTION_DUMP configured, validating the results without paying out")
+	}
+
+	// Step 8: Sign Transaction with MPC. Only validators answering
+	// heartbeats take part in signing. They agree on the signers before
+	// signing, along with the blockhash and the compute unit price, since
+	// each signer must build the very same message.
+	signCtx, cancelSign := context.WithTimeout(ctx, signingTimeout)
+	defer cancelSign()
+	decision, err := n.agreement.Decide(signCtx, "results:"+ballot.ID, n.parties, proposeTerms(cfg, client, tx, nonce != nil))
+	if err != nil {
+		log.Fatalf("Cannot sign: %v", err)
+	}
+	signers := decision.Signers
+	agreed, err := applyTerms(tx, decision.Value)
+	if err != nil {
+		log.Fatalf("Cannot sign: %v", err)
+	}
+	if agreed != nil {
+		recent = *agreed
+	}
+
+	// The evidence session is named after the message being signed
 	txMessage, err := tx.Message.MarshalBinary()
 	if err != nil {
 		log.Fatalf("Failed to marshal transaction message: %v", err)
 	}
 
-	// Wait for MPC signing (this should happen after line 313)
-	// Move the MPC signing code here and use the transaction message
-	mpcParty.SetShareData(keyShare)
-	mpcParty.Init(parties, threshold, transport.SendMsg)
+	if !slices.Contains(signers, uint16(id)) {
+		logInfo(fmt.Sprintf("Validators %v sign this ballot, not this one", signers))
+		return
+	}
+	logInfo(fmt.Sprintf("Signing with validators %v", signers))
+	n.beginSigning(signers, txMessage)
 
-	txDigestMsg := mpc.Digest(txMessage)
-	txSign, err := mpcParty.Sign(ctx, txDigestMsg)
-	if err != nil {
+	// Sign the raw message, as Solana verifies it, and place the signature
+	// at the threshold key's index
+	if err := solanatx.Sign(signCtx, tx, authority, n.party.SignSolanaMessage); err != nil {
 		log.Fatalf("Failed to sign transaction with MPC: %v", err)
 	}
 
-	// Apply MPC signature to transaction
-	tx.Signatures = []solana.Signature{solana.SignatureFromBytes(txSign)}
-
-	distStr := make(map[string]uint64)
-	sortedDist := make(map[string]uint64)
-	var keys []string
-	for k := range distStr {
-		keys = append(keys, k)
+	// The journal keeps a restarted validator from sending any transaction
+	// twice
+	journal, err := solanarpc.OpenJournal(filepath.Join(path, fmt.Sprintf("submissions_%d.jsonl", id)))
+	if err != nil {
+		log.Fatalf("Failed to open submission journal: %v", err)
 	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		sortedDist[k] = distStr[k]
+	submitter := solanarpc.NewSubmitter(client, journal)
+
+	// Step 8b: Build the payouts. With LOOKUP_TABLE set, those over recent
+	// blockhashes are v0 transactions looking up their receivers in the
+	// table, which the signers first extend with the addresses it lacks.
+	var tables []solanatx.LookupTable
+	if cfg.LookupTable != "" && len(payments) > 0 && len(payoutNonces) == 0 {
+		addresses, err := lookupAddresses(authority, payments)
+		if err != nil {
+			log.Fatalf("Failed to list payout addresses: %v", err)
+		}
+		table, err := n.extendLookupTable(ctx, cfg, client, submitter, authority, signers, addresses)
+		if err != nil {
+			log.Fatalf("Failed to extend lookup table: %v", err)
+		}
+		tables = append(tables, table)
 	}
-
-	// Instruction marshaling removed - now using transaction message directly for MPC signing
-
-	// MPC signing is now done during transaction signing above
-
-	pk, err := mpcParty.ThresholdPK()
+	payouts, err := buildPayouts(authority, payments, payoutNonces, tables, budget)
 	if err != nil {
-		logError("Failed to get threshold public key")
-		return
+		log.Fatalf("Failed to build payouts: %v", err)
+	}
+	if len(payouts) > 0 {
+		logInfo(fmt.Sprintf("Paying out %s in %d transactions", cfg.Distribution, len(payouts)))
+	}
+
+	// Every payout takes an MPC round of its own, with the same signers. Its
+	// terms are agreed on right before the round, so a payout without a nonce
+	// is signed over a blockhash as fresh as it can be.
+	for i := range payouts {
+		p := &payouts[i]
+		payoutCtx, cancelPayout := context.WithTimeout(ctx, signingTimeout)
+		decision, err := n.agreement.Decide(payoutCtx, "payout:"+ballot.ID+"/"+p.id, signers, proposeTerms(cfg, client, p.tx, p.durable))
+		if err != nil {
+			log.Fatalf("Cannot sign payout %s: %v", p.id, err)
+		}
+		agreed, err := applyTerms(p.tx, decision.Value)
+		if err != nil {
+			log.Fatalf("Cannot sign payout %s: %v", p.id, err)
+		}
+		if agreed != nil {
+			p.recent = *agreed
+		}
+		message, err := p.tx.Message.MarshalBinary()
+		if err != nil {
+			log.Fatalf("Failed to marshal payout %s: %v", p.id, err)
+		}
+		n.beginSigning(signers, message)
+		if err := solanatx.Sign(payoutCtx, p.tx, authority, n.party.SignSolanaMessage); err != nil {
+			log.Fatalf("Failed to sign payout %s with MPC: %v", p.id, err)
+		}
+		cancelPayout()
 	}
-	logInfo(fmt.Sprintf("Threshold PK: %x", pk))
 
 	// VRF logic implementation
 	separator("VRF-based Validator Selection")
 
-	// Generate VRF hash for this validator
-	logInfo("Generating VRF hash...")
-	vrfHash := generateVRFHash()
-	logInfo(fmt.Sprintf("Generated VRF hash: %s", vrfHash.String()))
-
-	// Update the VRF hash in the CSV file
-	updateVRFHash(id, vrfHash, validatorsFilePath)
+	// Only the signers hold the signed transaction, so one of them submits it
+	var signingValidators []validators.Validator
+	for _, validator := range activeValidators {
+		if slices.Contains(signers, uint16(validator.ID)) {
+			signingValidators = append(signingValidators, validator)
+		}
+	}
 
-	// Wait for all validators to update their VRF hashes
-	logInfo("Waiting for other validators to update their VRF hashes...")
-	time.Sleep(3 * time.Second)
+	source, err := newRandomnessSource(cfg, id, signingValidators, n.identityKey)
+	if err != nil {
+		logError(fmt.Sprintf("Error creating %s randomness source: %v", cfg.RandomnessSource, err))
+		return
+	}
 
-	// Reload validators to get updated VRF hashes
-	updatedValidators, err := loadValidators(validatorsFilePath)
+	// Every validator derives the same seed, so every beacon participant gets the same output
+	seed := selectionSeed(ballot.ID, pk)
+	logInfo(fmt.Sprintf("Requesting randomness from %s source...", cfg.RandomnessSource))
+	selectionCtx, cancelSelection := context.WithTimeout(ctx, 30*time.Second)
+	output, proof, err := source.Request(selectionCtx, seed)
+	cancelSelection()
 	if err != nil {
-		logError(fmt.Sprintf("Error reloading validators: %v", err))
+		var missed *vrf.MissedRevealError
+		if errors.As(err, &missed) {
+			for offender, commitment := range missed.Commitments {
+				n.collector.ReportMissedReveal(offender, missed.Round, commitment)
+			}
+		}
+		logError(fmt.Sprintf("Error obtaining randomness: %v", err))
+		return
+	}
+	if err := source.Verify(seed, output, proof); err != nil {
+		logError(fmt.Sprintf("Randomness failed verification: %v", err))
 		return
 	}
-	// updating flag to: tilt complete.
-	selectedValidator, err := selectValidator(updatedValidators)
+	logInfo(fmt.Sprintf("Verified randomness: %x", output))
+
+	selectedValidator, err := selectValidator(signingValidators, output)
 	if err != nil {
 		logError(fmt.Sprintf("Error selecting validator: %v", err))
 	} else {
 		if id == selectedValidator {
 			logSuccess(fmt.Sprintf("This validator (ID: %d) was selected for verification!", 1))
 			separator("Signature Verification")
-			if ed25519.Verify(pk, txDigestMsg, txSign) {
-				logSuccess("✅ Transaction signature verification successful!")
-			} else {
-				logError("❌ Transaction signature verification failed!")
+			if err := tx.VerifySignatures(); err != nil {
+				logError(fmt.Sprintf("❌ Transaction signature verification failed: %v", err))
+				return
 			}
-
-			// Step 10: Send Transaction
-			sig, err := client.SendTransactionWithOpts(ctx, tx, rpc.TransactionOpts{
-				SkipPreflight:       false,
-				PreflightCommitment: rpc.CommitmentFinalized,
-			})
+			for _, p := range payouts {
+				if err := p.tx.VerifySignatures(); err != nil {
+					logError(fmt.Sprintf("❌ Payout %s signature verification failed: %v", p.id, err))
+					return
+				}
+			}
+			logSuccess("✅ Transaction signature verification successful!")
+
+			// Step 9: Send Transaction and wait for it to be confirmed, then
+			// the payouts. Signing again needs another MPC round with
+			// validators that have finished by now, so an expired blockhash
+			// stops the submission with that advice; a durable nonce does not
+			// expire.
+			expired := func(advice string) solanarpc.BuildFunc {
+				return func(context.Context, solana.Hash) (*solana.Transaction, error) {
+					return nil, fmt.Errorf("blockhash expired before the transaction landed and the signers have finished; %s", advice)
+				}
+			}
+			var resign solanarpc.BuildFunc
+			if nonce == nil {
+				resign = expired("create nonce accounts advanced by the threshold key and set SOLANA_NONCE_ACCOUNT to sign over them instead")
+			}
+			sig, err := submitter.SubmitSigned(ctx, ballot.ID, tx, recent, resign)
 			if err != nil {
-				log.Fatalf("Failed to send transaction: %v", err)
+				log.Fatalf("Failed to submit transaction: %v", err)
+			}
+			fmt.Printf("Transaction confirmed! Signature: %s\n", sig)
+
+			for _, p := range payouts {
+				var resign solanarpc.BuildFunc
+				if !p.durable {
+					resign = expired("set a durable nonce in SOLANA_NONCE_ACCOUNT for every payout, or pay the rest out with bundle export")
+				}
+				sig, err := submitter.SubmitSigned(ctx, ballot.ID+"/payout/"+p.id, p.tx, p.recent, resign)
+				if err != nil {
+					log.Fatalf("Failed to submit payout %s: %v", p.id, err)
+				}
+				fmt.Printf("Payout %s confirmed! Signature: %s\n", p.id, sig)
 			}
-			fmt.Printf("Transaction sent! Signature: %s\n", sig)
 
 		} else {
 			logInfo(fmt.Sprintf("Validator ID: %d was selected for verification", selectedValidator))
 		}
 	}
 }
-
-// serializeInstructionData creates the instruction data for validate_payment_distribution
-func serializeInstructionData(amounts []uint64, totalAmount uint64, recipients []solana.PublicKey) ([]byte, error) {
-	var data []byte
-
-	// Discriminator: First 8 bytes of SHA256("global:validate_payment_distribution")
-	hash := sha256.Sum256([]byte("global:validate_payment_distribution"))
-	data = append(data, hash[:8]...)
-
-	// Serialize total_amount (u64)
-	totalBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(totalBytes, totalAmount)
-	data = append(data, totalBytes...)
-
-	// Serialize receivers (Vec<Pubkey>)
-	// Length of receivers
-	lengthBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(lengthBytes, uint32(len(recipients)))
-	data = append(data, lengthBytes...)
-
-	// Add each receiver's public key (32 bytes)
-	for _, recipient := range recipients {
-		data = append(data, recipient.Bytes()...)
-	}
-
-	// Serialize amounts (Vec<u64>)
-	// Length of amounts
-	amountLengthBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(amountLengthBytes, uint32(len(amounts)))
-	data = append(data, amountLengthBytes...)
-
-	// Add each amount
-	for _, amount := range amounts {
-		amountBytes := make([]byte, 8)
-		binary.LittleEndian.PutUint64(amountBytes, amount)
-		data = append(data, amountBytes...)
-	}
-
-	return data, nil
-}
-
-func getKeys(m map[string]interface{}) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
-func getKeysStringMap(m map[string]map[string]interface{}) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
-	}
-	return keys
-}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"tilt-valid/cmd/config"
+	"tilt-valid/internal/evidence"
+	"tilt-valid/internal/exchange"
+	"tilt-valid/internal/health"
+	mpc "tilt-valid/internal/mpc"
+	"tilt-valid/internal/validators"
+	"tilt-valid/utils"
+)
+
+// node is a validator connected to its peers. MPC messages and heartbeats
+// share the transport; the party is initialized by every protocol run.
+type node struct {
+	id          int
+	self        validators.Validator
+	registry    *validators.Registry
+	parties     []uint16
+	identityKey ed25519.PrivateKey
+	collector   *evidence.Collector
+	transport   *exchange.Transport
+	monitor     *health.Monitor
+	agreement   *health.Agreement
+	party       *mpc.Party
+}
+
+// signingTimeout bounds agreeing on the signers and the MPC rounds that
+// follow, so a validator left out of a round gives up instead of hanging
+const signingTimeout = 2 * time.Minute
+
+// startNode loads validator id from the registry, publishing its identity
+// key there, and exchanges heartbeats and MPC messages with its peers until
+// ctx is done. component names the command in the party's log.
+func startNode(ctx context.Context, cfg *config.Config, id int, component string) (*node, error) {
+	// The registry is created from the legacy validators.csv on first start
+	registry, err := validators.OpenOrMigrate(
+		filepath.Join(cfg.ValidatorPath, "validators.json"),
+		filepath.Join(cfg.ValidatorPath, "validators.csv"),
+		cfg.TransportPath,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading validator registry: %v", err)
+	}
+	self, err := registry.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading validator %d: %v", id, err)
+	}
+	parties, err := registry.PartyIDs()
+	if err != nil {
+		return nil, fmt.Errorf("error loading party IDs: %v", err)
+	}
+
+	// The identity key signs evidence and, with the local source, randomness
+	identityKey, err := loadOrCreateIdentityKey(filepath.Join(cfg.ValidatorPath, fmt.Sprintf("identity_%d.key", id)))
+	if err != nil {
+		return nil, fmt.Errorf("error loading identity key: %v", err)
+	}
+	// Peers check our evidence against the identity key published in the registry
+	identityPubKey := hex.EncodeToString(identityKey.Public().(ed25519.PublicKey))
+	if self.IdentityPubKey != identityPubKey {
+		self, err = registry.Update(id, func(v *validators.Validator) error {
+			v.IdentityPubKey = identityPubKey
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error publishing identity key: %v", err)
+		}
+	}
+
+	evidenceStore, err := evidence.NewStore(filepath.Join(cfg.ValidatorPath, "evidence"))
+	if err != nil {
+		return nil, fmt.Errorf("error opening evidence store: %v", err)
+	}
+
+	n := &node{
+		id:          id,
+		self:        self,
+		registry:    registry,
+		parties:     parties,
+		identityKey: identityKey,
+		collector:   evidence.NewCollector(uint16(id), identityKey, evidenceStore),
+		transport:   exchange.NewTransportWithDirectory(id, parties, registry),
+	}
+	n.party = mpc.NewParty(uint16(id), utils.Logger(strconv.Itoa(id), component))
+	n.party.ShareDir = cfg.KeyShareDir
+	n.party.Reporter = n.collector
+
+	// Records a previous run left in the inbox would be taken for this run's.
+	// No peer sends MPC messages before this validator answers heartbeats, so
+	// clearing the inbox now loses nothing.
+	if err := n.transport.DeleteFileData(); err != nil && !os.IsNotExist(err) {
+		logWarning(fmt.Sprintf("Failed to clear the inbox: %v", err))
+	}
+
+	n.monitor = health.NewMonitor(uint16(id), parties, n.transport.SendMsg)
+	n.monitor.StatusPath = filepath.Join(cfg.ValidatorPath, fmt.Sprintf("health_%d.json", id))
+	go n.monitor.Run(ctx)
+	n.agreement = health.NewAgreement(uint16(id), n.monitor, n.transport.SendMsg, func(available []uint16) ([]uint16, error) {
+		return mpc.SignerSet(available, threshold)
+	})
+
+	receiveChan := make(chan []byte, 10000)
+	go n.transport.WatchFile(1*time.Millisecond, receiveChan)
+	go n.receive(receiveChan)
+	return n, nil
+}
+
+// receive hands heartbeats to the monitor, agreement messages to the
+// agreement and everything else to the party
+func (n *node) receive(ch <-chan []byte) {
+	for data := range ch {
+		var msg exchange.Msg
+		if err := json.Unmarshal(data, &msg); err != nil {
+			logWarning(fmt.Sprintf("Dropping malformed transport message: %v", err))
+			continue
+		}
+		if health.IsAgreement(msg.Message) {
+			n.agreement.OnMsg(msg.Message, uint16(msg.From))
+			continue
+		}
+		if health.IsHeartbeat(msg.Message) {
+			n.monitor.OnMsg(msg.Message, uint16(msg.From))
+			continue
+		}
+		n.party.OnSessionMsg(msg.Session, msg.Message, uint16(msg.From), msg.Broadcast)
+	}
+}
+
+// beginSigning prepares the party for an MPC round signing message among
+// signers. The round is named after the message, which tags its transport
+// messages and the evidence reported during it.
+func (n *node) beginSigning(signers []uint16, message []byte) {
+	n.begin(fmt.Sprintf("sign:%x", mpc.Digest(message)), signers)
+}
+
+// begin prepares the party for the protocol run named session among parties
+func (n *node) begin(session string, parties []uint16) {
+	n.party.Init(parties, threshold, n.transport.SessionSender(session))
+	n.party.SetSession(session)
+	n.collector.SetSession(session)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"tilt-valid/cmd/config"
+	"tilt-valid/internal/keypair"
+	"tilt-valid/internal/solanarpc"
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// runNonce creates a durable nonce account advanced by the threshold key, or
+// shows the current value of one
+func runNonce(args []string) error {
+	usage := fmt.Errorf("usage: nonce create [-keypair file] -authority <threshold key> | nonce show <nonce account>")
+	if len(args) < 1 {
+		return usage
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+	client := solanarpc.New(cfg.SolanaRPC)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("nonce create", flag.ContinueOnError)
+		keypairPath := flags.String("keypair", cfg.KeypairPath, "keypair paying for the account")
+		authorityKey := flags.String("authority", "", "threshold key advancing the nonce")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *keypairPath == "" || *authorityKey == "" {
+			return usage
+		}
+		authority, err := solana.PublicKeyFromBase58(*authorityKey)
+		if err != nil {
+			return fmt.Errorf("invalid authority: %v", err)
+		}
+		payer, err := keypair.Load(*keypairPath)
+		if err != nil {
+			return err
+		}
+		journal, err := solanarpc.OpenJournal(filepath.Join(cfg.ValidatorPath, "submissions_nonce.jsonl"))
+		if err != nil {
+			return err
+		}
+
+		account, err := solanarpc.NewSubmitter(client, journal).CreateNonceAccount(ctx, payer, authority)
+		if err != nil {
+			return err
+		}
+		logSuccess(fmt.Sprintf("Created nonce account %s, set SOLANA_NONCE_ACCOUNT to use it", account))
+		return nil
+
+	case "show":
+		if len(args) != 2 {
+			return usage
+		}
+		account, err := solana.PublicKeyFromBase58(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid nonce account: %v", err)
+		}
+		nonce, err := solanarpc.LoadNonce(ctx, client, account)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Account:   %s\nAuthority: %s\nNonce:     %s\n", nonce.Account, nonce.Authority, nonce.Value)
+		return nil
+	}
+	return usage
+}
+
+// loadNonces loads the durable nonce accounts of SOLANA_NONCE_ACCOUNT, which
+// only the threshold key may advance
+func loadNonces(ctx context.Context, client solanarpc.SolanaClient, accounts []string, authority solana.PublicKey) ([]solanatx.DurableNonce, error) {
+	nonces := make([]solanatx.DurableNonce, 0, len(accounts))
+	for _, address := range accounts {
+		account, err := solana.PublicKeyFromBase58(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOLANA_NONCE_ACCOUNT %s: %v", address, err)
+		}
+		nonce, err := solanarpc.LoadNonce(ctx, client, account)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load nonce account %s: %v", account, err)
+		}
+		if !nonce.Authority.Equals(authority) {
+			return nil, fmt.Errorf("nonce account %s is advanced by %s, not the threshold key %s", account, nonce.Authority, authority)
+		}
+		nonces = append(nonces, nonce)
+	}
+	return nonces, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"tilt-valid/internal/distribution"
+	"tilt-valid/internal/solanarpc"
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// payout is one transaction paying a run of a distribution's receivers
+type payout struct {
+	id     string
+	tx     *solana.Transaction
+	recent solanarpc.Blockhash
+	// durable payouts are built over a nonce; the others get a blockhash
+	// right before they are signed
+	durable bool
+}
+
+// assetPayment is what a distribution pays out in one asset
+type assetPayment struct {
+	asset   distribution.Asset
+	payment solanatx.Payment
+	tok     *solanatx.Token // nil for SOL
+}
+
+// loadPayments reads the distributions in path, as written by explain -json,
+// skipping assets whose amounts are all carried forward
+func loadPayments(ctx context.Context, client solanarpc.SolanaClient, path string) ([]assetPayment, error) {
+	distributions, err := distribution.LoadDistributions(path)
+	if err != nil {
+		return nil, err
+	}
+	var payments []assetPayment
+	for _, p := range distributions.Payments() {
+		if len(p.Receivers) == 0 {
+			continue // everything was carried forward
+		}
+		payment, err := solanatx.FromDistribution(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Asset, err)
+		}
+		tok, err := solanarpc.LoadToken(ctx, client, p.Asset)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Asset, err)
+		}
+		payments = append(payments, assetPayment{asset: p.Asset, payment: payment, tok: tok})
+	}
+	return payments, nil
+}
+
+// lookupAddresses returns the accounts the payouts of payments can look up
+// in a table, in a stable order
+func lookupAddresses(authority solana.PublicKey, payments []assetPayment) ([]solana.PublicKey, error) {
+	var addresses []solana.PublicKey
+	for _, p := range payments {
+		more, err := solanatx.PaymentLookupAddresses(authority, p.payment, p.tok)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.asset, err)
+		}
+		addresses = append(addresses, more...)
+	}
+	return addresses, nil
+}
+
+// buildPayouts builds the transfers paying out payments. Each transaction
+// validates its receivers' amounts with the program and moves the funds from
+// authority, which also pays the fees, so the threshold key alone signs
+// them. Given nonces, transaction i is built over nonces[i] and there must be
+// one for every transaction. Without, the transactions carry no blockhash
+// yet, and given tables they are v0 transactions looking up their accounts
+// there. Every transaction sets budget.
+func buildPayouts(authority solana.PublicKey, payments []assetPayment, nonces []solanatx.DurableNonce, tables []solanatx.LookupTable, budget solanatx.ComputeBudget) ([]payout, error) {
+	var payouts []payout
+	for _, p := range payments {
+		var txs []*solana.Transaction
+		var err error
+		switch {
+		case len(nonces) > 0:
+			// Each nonce pays out once, so every asset takes the next ones
+			if len(payouts) >= len(nonces) {
+				return nil, fmt.Errorf("%s: all %d durable nonces are taken by earlier payouts", p.asset, len(nonces))
+			}
+			txs, err = solanatx.BuildDurableTransferTransactions(solanatx.ProgramID, authority, nonces[len(payouts):], p.payment, p.tok, budget)
+		case len(tables) > 0:
+			txs, err = solanatx.BuildVersionedTransferTransactions(solanatx.ProgramID, authority, solana.Hash{}, tables, p.payment, p.tok, budget)
+		default:
+			txs, err = solanatx.BuildTransferTransactions(solanatx.ProgramID, authority, solana.Hash{}, p.payment, p.tok, budget)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.asset, err)
+		}
+		for i, tx := range txs {
+			next := payout{id: fmt.Sprintf("%s/%d", p.asset, i), tx: tx}
+			if len(nonces) > 0 {
+				next.recent, next.durable = solanarpc.DurableBlockhash(nonces[len(payouts)]), true
+			}
+			payouts = append(payouts, next)
+		}
+	}
+	return payouts, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"tilt-valid/cmd/config"
+	"tilt-valid/internal/evidence"
+	"tilt-valid/internal/health"
+	"tilt-valid/internal/validators"
+)
+
+// runStatus prints the validator registry, each validator's view of its peers
+// and any recorded evidence of misbehavior
+func runStatus() error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+
+	registry, err := validators.Open(filepath.Join(cfg.ValidatorPath, "validators.json"))
+	if err != nil {
+		return fmt.Errorf("error loading validator registry: %v", err)
+	}
+	all, err := registry.List()
+	if err != nil {
+		return err
+	}
+
+	separator("Validators")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTAKE\tACTIVE\tJOINED\tTRANSPORT")
+	for _, v := range all {
+		fmt.Fprintf(w, "%d\t%s\t%.2f\t%t\t%d\t%s\n", v.ID, v.Name, v.Stake, v.Active, v.JoinedEpoch, v.TransportAddress)
+	}
+	w.Flush()
+
+	for _, v := range all {
+		report, err := health.LoadReport(filepath.Join(cfg.ValidatorPath, fmt.Sprintf("health_%d.json", v.ID)))
+		if err != nil {
+			if os.IsNotExist(err) {
+				logWarning(fmt.Sprintf("Validator %d has not reported liveness", v.ID))
+				continue
+			}
+			return err
+		}
+
+		separator(fmt.Sprintf("Liveness seen by validator %d (updated %s ago)", v.ID, time.Since(report.UpdatedAt).Round(time.Second)))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PEER\tAVAILABLE\tLAST SEEN\tRTT\tPROTOCOL")
+		for _, peer := range report.Peers {
+			lastSeen := "never"
+			if !peer.LastSeen.IsZero() {
+				lastSeen = peer.LastSeen.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%t\t%s\t%s\t%s\n", peer.ID, peer.Available, lastSeen, peer.RTT, peer.ProtocolVersion)
+		}
+		w.Flush()
+	}
+
+	return printEvidence(filepath.Join(cfg.ValidatorPath, "evidence"), all)
+}
+
+// printEvidence lists stored evidence, checking each signature against the
+// reporter's identity key from the registry
+func printEvidence(dir string, all []validators.Validator) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	store, err := evidence.NewStore(dir)
+	if err != nil {
+		return err
+	}
+	records, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[uint16]ed25519.PublicKey)
+	for _, v := range all {
+		if key, err := hex.DecodeString(v.IdentityPubKey); err == nil {
+			keys[uint16(v.ID)] = key
+		}
+	}
+
+	separator(fmt.Sprintf("Evidence (%d records)", len(records)))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tKIND\tOFFENDER\tREPORTER\tSESSION\tSIGNATURE")
+	for _, e := range records {
+		signature := "valid"
+		if err := e.Verify(keys[e.Reporter]); err != nil {
+			signature = "INVALID"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", time.Unix(e.Timestamp, 0).Format(time.RFC3339), e.Kind, e.Offender, e.Reporter, e.Session, signature)
+	}
+	return w.Flush()
+}
@@ -3,237 +3,83 @@ package main
 import (
 	"crypto/ed25519"
 	"crypto/sha256"
-	"encoding/binary"
-	"encoding/csv"
+	"encoding/hex"
 	"fmt"
-	"math/big"
 	"os"
-	"strconv"
-	"time"
-)
-
-type Validator struct {
-	ID      string
-	Name    string
-	Stake   float64
-	Active  bool
-	VRFHash *big.Int
-}
-
-// GenerateVRFHash generates a verifiable random hash for the validator
-func generateVRFHash() *big.Int {
-	// Generate a random seed based on current time and other inputs
-	seed := time.Now().UnixNano()
-	randomSeed := big.NewInt(seed)
-
-	// Create hash of the seed
-	h := sha256.New()
-	h.Write(randomSeed.Bytes())
-	hashBytes := h.Sum(nil)
-
-	// Convert hash to big.Int
-	vrfHash := new(big.Int).SetBytes(hashBytes)
-	return vrfHash
-}
-
-// UpdateVRFHash updates the validator's VRF hash in the CSV file
-func updateVRFHash(validatorID int, vrfHash *big.Int, filePath string) error {
-	// Read existing file
-	file, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %v", err)
-	}
-
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		file.Close()
-		return fmt.Errorf("failed to read CSV file: %v", err)
-	}
-	file.Close()
-
-	// Update the record for the validator
-	if validatorID < len(records) {
-		records[validatorID][4] = vrfHash.String()
-	} else {
-		return fmt.Errorf("validator ID %d out of range", validatorID)
-	}
-
-	// Write back to file
-	tempFile := filePath + ".tmp"
-	outFile, err := os.Create(tempFile)
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %v", err)
-	}
-
-	writer := csv.NewWriter(outFile)
-	err = writer.WriteAll(records)
-	if err != nil {
-		outFile.Close()
-		return fmt.Errorf("failed to write to CSV file: %v", err)
-	}
-
-	writer.Flush()
-	outFile.Close()
-
-	// Replace the original file with the temporary file
-	err = os.Rename(tempFile, filePath)
-	if err != nil {
-		return fmt.Errorf("failed to rename temp file: %v", err)
-	}
+	"strings"
 
-	return nil
-}
-
-// SelectValidator selects a validator based on the combined VRF hashes
-func selectValidator(validators []Validator) (int, error) {
-	if len(validators) == 0 {
-		return 0, fmt.Errorf("no validators available")
-	}
+	"tilt-valid/cmd/config"
+	"tilt-valid/internal/validators"
+	vrf "tilt-valid/internal/vrf"
+)
 
-	// Combine all VRF hashes
-	combinedHash := new(big.Int)
-	for _, validator := range validators {
-		if validator.Active {
-			combinedHash.Xor(combinedHash, validator.VRFHash)
+// newRandomnessSource builds the configured randomness backend for this validator
+func newRandomnessSource(cfg *config.Config, id int, active []validators.Validator, identityKey ed25519.PrivateKey) (vrf.RandomnessSource, error) {
+	opts := vrf.SourceOptions{ValidatorID: id}
+
+	switch cfg.RandomnessSource {
+	case vrf.SourceLocal:
+		opts.LocalKey = identityKey
+	case vrf.SourceBeacon:
+		board, err := vrf.NewFileBoard(cfg.BeaconPath)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	// Count active validators
-	activeCount := 0
-	for _, validator := range validators {
-		if validator.Active {
-			activeCount++
+		opts.Board = board
+		for _, validator := range active {
+			opts.Validators = append(opts.Validators, validator.ID)
 		}
+	case vrf.SourceChainlink:
+		oracleKey, err := hex.DecodeString(cfg.VRFOracleKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid VRF_ORACLE_PUBKEY: %v", err)
+		}
+		opts.OracleEndpoint = cfg.VRFOracleEndpoint
+		opts.OracleProgramID = cfg.VRFOracleProgram
+		opts.OracleKey = oracleKey
 	}
 
-	if activeCount == 0 {
-		return 0, fmt.Errorf("no active validators")
-	}
-
-	// Use the combined hash to select a validator (mod active count)
-	// Add 1 because validator IDs are 1-based in this implementation
-	selectedIndex := new(big.Int).Mod(combinedHash, big.NewInt(int64(activeCount))).Int64() + 1
-
-	return int(selectedIndex), nil
-}
-
-// VRFProof stores the proof of randomness generation
-type VRFProof struct {
-	PublicKey    ed25519.PublicKey
-	Beta         []byte // The VRF output
-	Proof        []byte // The proof that beta was correctly computed
-	RandomNumber *big.Int
+	return vrf.NewRandomnessSource(cfg.RandomnessSource, opts)
 }
 
-// GenerateVRF uses the validator's private key to generate a verifiable random value
-// from a given input (e.g., block hash + round number)
-func GenerateVRF(privKey ed25519.PrivateKey, pubKey ed25519.PublicKey, input []byte) (*VRFProof, error) {
-	// Create a message by combining input data
-	message := input
-
-	// In a real implementation, this would use a specialized VRF algorithm
-	// For demonstration, we're using ed25519 signatures as a simplified VRF
-	signature := ed25519.Sign(privKey, message)
-
-	// Hash the signature to get the VRF output (beta)
-	beta := sha256.Sum256(signature)
-
-	// Convert beta to a big.Int for easier comparisons
-	randomNumber := new(big.Int).SetBytes(beta[:])
-
-	// In a real VRF, we would include a proper cryptographic proof
-	// Here we're just using the signature itself as the "proof"
-	return &VRFProof{
-		PublicKey:    pubKey,
-		Beta:         beta[:],
-		Proof:        signature,
-		RandomNumber: randomNumber,
-	}, nil
-}
-
-// VerifyVRF verifies that the VRF output was correctly computed
-func VerifyVRF(proof *VRFProof, input []byte) (bool, error) {
-	// In a real VRF, we'd verify the cryptographic proof
-	// For our simplified example, we just verify the signature
-	return ed25519.Verify(proof.PublicKey, input, proof.Proof), nil
-}
-
-// GenerateCommonSeed creates a deterministic seed for a specific round/block
-func GenerateCommonSeed(blockHeight uint64, timestamp time.Time) []byte {
-	seed := make([]byte, 16)
-	binary.BigEndian.PutUint64(seed[0:8], blockHeight)
-	binary.BigEndian.PutUint64(seed[8:16], uint64(timestamp.Unix()))
-	return seed
-}
-
-// SelectValidator uses VRF proofs from all validators to deterministically select one
-func SelectValidator(validators []Validator, vrfProofs []*VRFProof) *Validator {
-	if len(validators) == 0 || len(vrfProofs) == 0 {
-		logWarning("No validators or VRF proofs available")
-		return nil
-	}
-
-	// Find the lowest VRF output
-	lowestValue, _ := new(big.Int).SetString("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", 16)
-	var selectedIndex int = -1
-
-	for i, proof := range vrfProofs {
-		// Skip invalid proofs (nil or zero)
-		if proof == nil || proof.RandomNumber.Cmp(big.NewInt(0)) == 0 {
-			continue
-		}
-
-		logInfo(fmt.Sprintf("Validator %s VRF value: %s", validators[i].ID, proof.RandomNumber.String()))
-
-		// Compare VRF outputs and select the lowest
-		if proof.RandomNumber.Cmp(lowestValue) < 0 {
-			lowestValue = proof.RandomNumber
-			selectedIndex = i
-			logInfo(fmt.Sprintf("New lowest VRF found: %s (Validator %s)",
-				lowestValue.String(), validators[i].ID))
+// loadOrCreateIdentityKey reads the validator's ed25519 identity seed, creating it on first use
+func loadOrCreateIdentityKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid identity key in %s", path)
 		}
+		return ed25519.NewKeyFromSeed(seed), nil
 	}
-
-	if selectedIndex == -1 {
-		logError("No validator was selected")
-		return nil
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read identity key: %v", err)
 	}
 
-	logSuccess(fmt.Sprintf("Chosen Validator: %s", validators[selectedIndex].ID))
-	return &validators[selectedIndex]
-}
-
-func loadValidators(filePath string) ([]Validator, error) {
-
-	file, err := os.Open(filePath)
+	_, key, err := ed25519.GenerateKey(nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %v", err)
+		return nil, fmt.Errorf("failed to generate identity key: %v", err)
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CSV file: %v", err)
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write identity key: %v", err)
 	}
+	return key, nil
+}
 
-	var validators []Validator
-	for _, record := range records {
-		if len(record) != 5 {
-			return nil, fmt.Errorf("invalid record: %v", record)
-		}
-		stake, _ := strconv.ParseFloat(record[2], 64)
-		active, _ := strconv.ParseBool(record[3])
-		vrfHash := new(big.Int)
-		vrfHash.SetString(record[4], 10)
-		validators = append(validators, Validator{
-			ID:      record[0],
-			Name:    record[1],
-			Stake:   stake,
-			Active:  active,
-			VRFHash: vrfHash,
-		})
+// selectionSeed binds validator selection to a ballot and to the current threshold key,
+// so every validator derives the same seed and a new DKG starts a new round
+func selectionSeed(ballotID string, thresholdPK []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("validator-selection"))
+	h.Write([]byte(ballotID))
+	h.Write(thresholdPK)
+	return h.Sum(nil)
+}
+
+// selectValidator maps the shared randomness output onto the active validators
+func selectValidator(active []validators.Validator, output vrf.Output) (int, error) {
+	if len(active) == 0 {
+		return 0, fmt.Errorf("no active validators")
 	}
-	return validators, nil
+	return active[output.Index(len(active))].ID, nil
 }
@@ -0,0 +1,226 @@
+// Package anchor encodes and decodes the instructions of Anchor programs
+// from their IDL, using the Borsh serialization Anchor programs expect
+package anchor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"unicode/utf8"
+)
+
+// ErrTruncated is returned when data ends before the value being decoded
+var ErrTruncated = errors.New("borsh data is truncated")
+
+// Encoder appends Borsh encoded values to a buffer. Integers are little
+// endian, sequences are prefixed with their u32 length and options with a
+// 0 or 1 byte.
+type Encoder struct {
+	buf []byte
+}
+
+// Bytes returns what was encoded so far
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) WriteU8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *Encoder) WriteU16(v uint16) {
+	e.buf = binary.LittleEndian.AppendUint16(e.buf, v)
+}
+
+func (e *Encoder) WriteU32(v uint32) {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *Encoder) WriteU64(v uint64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, v)
+}
+
+// WriteU128 writes v, which must be in [0, 2^128)
+func (e *Encoder) WriteU128(v *big.Int) error {
+	if v.Sign() < 0 || v.BitLen() > 128 {
+		return fmt.Errorf("%s overflows u128", v)
+	}
+	var b [16]byte
+	v.FillBytes(b[:])
+	for i := range b {
+		e.buf = append(e.buf, b[15-i])
+	}
+	return nil
+}
+
+// WriteI128 writes v, which must be in [-2^127, 2^127), in two's complement
+func (e *Encoder) WriteI128(v *big.Int) error {
+	limit := new(big.Int).Lsh(big.NewInt(1), 127)
+	if v.Cmp(limit) >= 0 || v.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return fmt.Errorf("%s overflows i128", v)
+	}
+	u := new(big.Int).Set(v)
+	if u.Sign() < 0 {
+		u.Add(u, new(big.Int).Lsh(limit, 1))
+	}
+	return e.WriteU128(u)
+}
+
+func (e *Encoder) WriteBool(v bool) {
+	if v {
+		e.WriteU8(1)
+	} else {
+		e.WriteU8(0)
+	}
+}
+
+// WriteLen writes the u32 length prefix of a sequence
+func (e *Encoder) WriteLen(n int) error {
+	if n < 0 || uint64(n) > math.MaxUint32 {
+		return fmt.Errorf("length %d overflows u32", n)
+	}
+	e.WriteU32(uint32(n))
+	return nil
+}
+
+// WriteBytes writes a length prefixed byte string, Vec<u8>
+func (e *Encoder) WriteBytes(v []byte) error {
+	if err := e.WriteLen(len(v)); err != nil {
+		return err
+	}
+	e.buf = append(e.buf, v...)
+	return nil
+}
+
+func (e *Encoder) WriteString(v string) error {
+	return e.WriteBytes([]byte(v))
+}
+
+// WriteFixed writes v as is, as for a [u8; N] or a public key
+func (e *Encoder) WriteFixed(v []byte) {
+	e.buf = append(e.buf, v...)
+}
+
+// Decoder reads Borsh encoded values from data
+type Decoder struct {
+	data []byte
+}
+
+// NewDecoder returns a decoder reading data from its start
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Remaining returns how many bytes have not been read yet
+func (d *Decoder) Remaining() int {
+	return len(d.data)
+}
+
+// ReadFixed reads the next n bytes
+func (d *Decoder) ReadFixed(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data) {
+		return nil, ErrTruncated
+	}
+	v := d.data[:n]
+	d.data = d.data[n:]
+	return v, nil
+}
+
+func (d *Decoder) ReadU8() (uint8, error) {
+	b, err := d.ReadFixed(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *Decoder) ReadU16() (uint16, error) {
+	b, err := d.ReadFixed(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+func (d *Decoder) ReadU32() (uint32, error) {
+	b, err := d.ReadFixed(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (d *Decoder) ReadU64() (uint64, error) {
+	b, err := d.ReadFixed(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (d *Decoder) ReadU128() (*big.Int, error) {
+	b, err := d.ReadFixed(16)
+	if err != nil {
+		return nil, err
+	}
+	var be [16]byte
+	for i := range be {
+		be[i] = b[15-i]
+	}
+	return new(big.Int).SetBytes(be[:]), nil
+}
+
+func (d *Decoder) ReadI128() (*big.Int, error) {
+	v, err := d.ReadU128()
+	if err != nil {
+		return nil, err
+	}
+	if v.Bit(127) == 1 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	return v, nil
+}
+
+// ReadBool reads a bool, rejecting bytes other than 0 and 1 as Borsh does
+func (d *Decoder) ReadBool() (bool, error) {
+	b, err := d.ReadU8()
+	if err != nil {
+		return false, err
+	}
+	switch b {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid bool %d", b)
+}
+
+// ReadLen reads the u32 length prefix of a sequence
+func (d *Decoder) ReadLen() (int, error) {
+	n, err := d.ReadU32()
+	return int(n), err
+}
+
+// ReadBytes reads a length prefixed byte string, Vec<u8>
+func (d *Decoder) ReadBytes() ([]byte, error) {
+	n, err := d.ReadLen()
+	if err != nil {
+		return nil, err
+	}
+	return d.ReadFixed(n)
+}
+
+// ReadString reads a length prefixed UTF-8 string
+func (d *Decoder) ReadString() (string, error) {
+	b, err := d.ReadBytes()
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", errors.New("invalid UTF-8 string")
+	}
+	return string(b), nil
+}
@@ -0,0 +1,78 @@
+package anchor
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBorshRoundTrip(t *testing.T) {
+	e := &Encoder{}
+	e.WriteU8(0xab)
+	e.WriteU16(0x0102)
+	e.WriteU32(0x01020304)
+	e.WriteU64(300)
+	require.NoError(t, e.WriteU128(new(big.Int).Lsh(big.NewInt(1), 100)))
+	require.NoError(t, e.WriteI128(big.NewInt(-2)))
+	e.WriteBool(true)
+	require.NoError(t, e.WriteString("héllo"))
+	require.NoError(t, e.WriteBytes(nil))
+	e.WriteFixed([]byte{7, 7})
+
+	golden := "ab" + "0201" + "04030201" + "2c01000000000000" +
+		"00000000000000000000000010000000" + // 2^100
+		"feffffffffffffffffffffffffffffff" + // -2
+		"01" + "06000000" + hex.EncodeToString([]byte("héllo")) + "00000000" + "0707"
+	assert.Equal(t, golden, hex.EncodeToString(e.Bytes()))
+
+	d := NewDecoder(e.Bytes())
+	u8, _ := d.ReadU8()
+	assert.Equal(t, uint8(0xab), u8)
+	u16, _ := d.ReadU16()
+	assert.Equal(t, uint16(0x0102), u16)
+	u32, _ := d.ReadU32()
+	assert.Equal(t, uint32(0x01020304), u32)
+	u64, _ := d.ReadU64()
+	assert.Equal(t, uint64(300), u64)
+	u128, err := d.ReadU128()
+	require.NoError(t, err)
+	assert.Equal(t, 0, u128.Cmp(new(big.Int).Lsh(big.NewInt(1), 100)))
+	i128, err := d.ReadI128()
+	require.NoError(t, err)
+	assert.Equal(t, int64(-2), i128.Int64())
+	b, err := d.ReadBool()
+	require.NoError(t, err)
+	assert.True(t, b)
+	s, err := d.ReadString()
+	require.NoError(t, err)
+	assert.Equal(t, "héllo", s)
+	empty, err := d.ReadBytes()
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+	fixed, err := d.ReadFixed(2)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{7, 7}, fixed)
+	assert.Equal(t, 0, d.Remaining())
+	_, err = d.ReadU8()
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestBorshRejects(t *testing.T) {
+	e := &Encoder{}
+	assert.ErrorContains(t, e.WriteU128(big.NewInt(-1)), "overflows u128")
+	assert.ErrorContains(t, e.WriteU128(new(big.Int).Lsh(big.NewInt(1), 128)), "overflows u128")
+	assert.ErrorContains(t, e.WriteI128(new(big.Int).Lsh(big.NewInt(1), 127)), "overflows i128")
+	assert.Empty(t, e.Bytes())
+
+	_, err := NewDecoder([]byte{2}).ReadBool()
+	assert.ErrorContains(t, err, "invalid bool")
+	_, err = NewDecoder([]byte{5, 0, 0, 0, 'a'}).ReadBytes()
+	assert.ErrorIs(t, err, ErrTruncated)
+	_, err = NewDecoder([]byte{1, 0, 0, 0, 0xff}).ReadString()
+	assert.ErrorContains(t, err, "UTF-8")
+	_, err = NewDecoder([]byte{1, 2, 3}).ReadU32()
+	assert.ErrorIs(t, err, ErrTruncated)
+}
@@ -0,0 +1,710 @@
+package anchor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// IDL is the interface of an Anchor program as written by `anchor build` to
+// target/idl. Both the current format and the legacy one, before Anchor
+// 0.30, are read: legacy IDLs have no discriminators, which are then derived
+// from the instruction names.
+type IDL struct {
+	Address      string        `json:"address"`
+	Metadata     Metadata      `json:"metadata"`
+	Instructions []Instruction `json:"instructions"`
+	Types        []TypeDef     `json:"types"`
+	Errors       []ErrorCode   `json:"errors"`
+
+	// Name and Version are where legacy IDLs keep the metadata
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Metadata struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Spec    string `json:"spec"`
+}
+
+// Instruction is an instruction handler of the program
+type Instruction struct {
+	Name          string               `json:"name"`
+	Discriminator []byte               `json:"discriminator"`
+	Accounts      []InstructionAccount `json:"accounts"`
+	Args          []Field              `json:"args"`
+}
+
+// InstructionAccount is an account an instruction takes, in order
+type InstructionAccount struct {
+	Name     string `json:"name"`
+	Writable bool   `json:"writable"`
+	Signer   bool   `json:"signer"`
+
+	// IsMut and IsSigner are the legacy names of Writable and Signer
+	IsMut    bool `json:"isMut"`
+	IsSigner bool `json:"isSigner"`
+}
+
+// Field is a named, typed argument or struct field
+type Field struct {
+	Name string `json:"name"`
+	Type Type   `json:"type"`
+}
+
+// TypeDef is a struct or enum the program defines
+type TypeDef struct {
+	Name string `json:"name"`
+	Type struct {
+		Kind     string    `json:"kind"`
+		Fields   []Field   `json:"fields"`
+		Variants []Variant `json:"variants"`
+	} `json:"type"`
+}
+
+// Variant is an enum variant; its fields are named, or positional with
+// their index as name
+type Variant struct {
+	Name   string
+	Fields []Field
+}
+
+// ErrorCode is a custom program error, as returned in InstructionError
+type ErrorCode struct {
+	Code uint32 `json:"code"`
+	Name string `json:"name"`
+	Msg  string `json:"msg"`
+}
+
+// Type is a Borsh type: a primitive such as "u64", "pubkey" or "string", or
+// a vec, option or array of Elem, or a type the program defines
+type Type struct {
+	Primitive string
+	Vec       *Type
+	Option    *Type
+	Array     *Type
+	Len       int
+	Defined   string
+}
+
+// Enum is the value of an enum type
+type Enum struct {
+	Variant string
+	Fields  map[string]any
+}
+
+// InstructionDiscriminator returns the Anchor discriminator of a global
+// instruction handler
+func InstructionDiscriminator(name string) [8]byte {
+	hash := sha256.Sum256([]byte("global:" + name))
+	return [8]byte(hash[:8])
+}
+
+// ParseIDL reads an IDL and checks that the types it uses are all known
+func ParseIDL(data []byte) (*IDL, error) {
+	var idl IDL
+	if err := json.Unmarshal(data, &idl); err != nil {
+		return nil, fmt.Errorf("invalid IDL: %w", err)
+	}
+	if idl.Metadata.Name == "" {
+		idl.Metadata.Name, idl.Metadata.Version = idl.Name, idl.Version
+	}
+	for i := range idl.Instructions {
+		ix := &idl.Instructions[i]
+		if len(ix.Discriminator) == 0 {
+			d := InstructionDiscriminator(snakeCase(ix.Name))
+			ix.Discriminator = d[:]
+		}
+		for j := range ix.Accounts {
+			account := &ix.Accounts[j]
+			account.Writable = account.Writable || account.IsMut
+			account.Signer = account.Signer || account.IsSigner
+		}
+		for _, arg := range ix.Args {
+			if err := idl.check(arg.Type); err != nil {
+				return nil, fmt.Errorf("instruction %s, argument %s: %w", ix.Name, arg.Name, err)
+			}
+		}
+	}
+	for _, def := range idl.Types {
+		switch def.Type.Kind {
+		case "struct":
+			for _, field := range def.Type.Fields {
+				if err := idl.check(field.Type); err != nil {
+					return nil, fmt.Errorf("type %s, field %s: %w", def.Name, field.Name, err)
+				}
+			}
+		case "enum":
+			for _, variant := range def.Type.Variants {
+				for _, field := range variant.Fields {
+					if err := idl.check(field.Type); err != nil {
+						return nil, fmt.Errorf("type %s, variant %s: %w", def.Name, variant.Name, err)
+					}
+				}
+			}
+		default:
+			return nil, fmt.Errorf("type %s is a %q, only structs and enums are supported", def.Name, def.Type.Kind)
+		}
+	}
+	return &idl, nil
+}
+
+// Instruction returns the instruction called name
+func (idl *IDL) Instruction(name string) (*Instruction, error) {
+	for i := range idl.Instructions {
+		if idl.Instructions[i].Name == name {
+			return &idl.Instructions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no instruction %s", idl.Metadata.Name, name)
+}
+
+// Encode returns the instruction data calling ix with args, keyed by
+// argument name
+func (idl *IDL) Encode(ix *Instruction, args map[string]any) ([]byte, error) {
+	if len(args) != len(ix.Args) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", ix.Name, len(ix.Args), len(args))
+	}
+	e := &Encoder{buf: append([]byte(nil), ix.Discriminator...)}
+	for _, arg := range ix.Args {
+		value, ok := args[arg.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s: missing argument %s", ix.Name, arg.Name)
+		}
+		if err := idl.encode(e, arg.Type, value); err != nil {
+			return nil, fmt.Errorf("%s: argument %s: %w", ix.Name, arg.Name, err)
+		}
+	}
+	return e.Bytes(), nil
+}
+
+// NewInstruction builds ix for program with accounts in the order the IDL
+// lists them, marked writable and signer as it declares
+func (idl *IDL) NewInstruction(programID solana.PublicKey, ix *Instruction, accounts []solana.PublicKey, args map[string]any) (solana.Instruction, error) {
+	if len(accounts) != len(ix.Accounts) {
+		return nil, fmt.Errorf("%s takes %d accounts, got %d", ix.Name, len(ix.Accounts), len(accounts))
+	}
+	data, err := idl.Encode(ix, args)
+	if err != nil {
+		return nil, err
+	}
+	metas := make([]*solana.AccountMeta, len(accounts))
+	for i, account := range ix.Accounts {
+		metas[i] = &solana.AccountMeta{PublicKey: accounts[i], IsWritable: account.Writable, IsSigner: account.Signer}
+	}
+	return solana.NewInstruction(programID, metas, data), nil
+}
+
+// Decode reads instruction data back into the instruction it calls and its
+// arguments. Data left over after the last argument is an error.
+func (idl *IDL) Decode(data []byte) (*Instruction, map[string]any, error) {
+	var ix *Instruction
+	for i := range idl.Instructions {
+		if d := idl.Instructions[i].Discriminator; bytes.HasPrefix(data, d) {
+			ix = &idl.Instructions[i]
+			break
+		}
+	}
+	if ix == nil {
+		return nil, nil, fmt.Errorf("data calls no instruction of %s", idl.Metadata.Name)
+	}
+	d := NewDecoder(data[len(ix.Discriminator):])
+	args := make(map[string]any, len(ix.Args))
+	for _, arg := range ix.Args {
+		value, err := idl.decode(d, arg.Type)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: argument %s: %w", ix.Name, arg.Name, err)
+		}
+		args[arg.Name] = value
+	}
+	if d.Remaining() != 0 {
+		return nil, nil, fmt.Errorf("%s data has %d trailing bytes", ix.Name, d.Remaining())
+	}
+	return ix, args, nil
+}
+
+// Format shows a decoded call as name(arg: value, ...) in argument order
+func (ix *Instruction) Format(args map[string]any) string {
+	parts := make([]string, len(ix.Args))
+	for i, arg := range ix.Args {
+		parts[i] = fmt.Sprintf("%s: %v", arg.Name, args[arg.Name])
+	}
+	return fmt.Sprintf("%s(%s)", ix.Name, strings.Join(parts, ", "))
+}
+
+// typeDef returns the type the program defines as name
+func (idl *IDL) typeDef(name string) (*TypeDef, error) {
+	for i := range idl.Types {
+		if idl.Types[i].Name == name {
+			return &idl.Types[i], nil
+		}
+	}
+	return nil, fmt.Errorf("undefined type %s", name)
+}
+
+// check makes sure t can be encoded
+func (idl *IDL) check(t Type) error {
+	switch {
+	case t.Vec != nil:
+		return idl.check(*t.Vec)
+	case t.Option != nil:
+		return idl.check(*t.Option)
+	case t.Array != nil:
+		return idl.check(*t.Array)
+	case t.Defined != "":
+		_, err := idl.typeDef(t.Defined)
+		return err
+	}
+	switch t.Primitive {
+	case "u8", "u16", "u32", "u64", "u128", "i8", "i16", "i32", "i64", "i128", "bool", "string", "bytes", "pubkey":
+		return nil
+	}
+	return fmt.Errorf("unsupported type %q", t.Primitive)
+}
+
+// encode writes value as t. Integers may be of any Go integer type in range
+// and 128 bit ones a *big.Int; vecs and arrays any slice or array; options
+// nil or the value; structs a map keyed by field name and enums an Enum.
+func (idl *IDL) encode(e *Encoder, t Type, value any) error {
+	switch {
+	case t.Option != nil:
+		v := reflect.ValueOf(value)
+		if value == nil || (v.Kind() == reflect.Pointer && v.IsNil()) {
+			e.WriteU8(0)
+			return nil
+		}
+		if v.Kind() == reflect.Pointer {
+			value = v.Elem().Interface()
+		}
+		e.WriteU8(1)
+		return idl.encode(e, *t.Option, value)
+
+	case t.Vec != nil, t.Array != nil:
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return fmt.Errorf("want a sequence, got %T", value)
+		}
+		elem := t.Vec
+		if t.Array != nil {
+			elem = t.Array
+			if v.Len() != t.Len {
+				return fmt.Errorf("want %d elements, got %d", t.Len, v.Len())
+			}
+		} else if err := e.WriteLen(v.Len()); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := idl.encode(e, *elem, v.Index(i).Interface()); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		return nil
+
+	case t.Defined != "":
+		def, err := idl.typeDef(t.Defined)
+		if err != nil {
+			return err
+		}
+		if def.Type.Kind == "enum" {
+			enum, ok := value.(Enum)
+			if !ok {
+				return fmt.Errorf("want an Enum for %s, got %T", def.Name, value)
+			}
+			for i, variant := range def.Type.Variants {
+				if variant.Name == enum.Variant {
+					e.WriteU8(uint8(i))
+					return idl.encodeFields(e, variant.Fields, enum.Fields)
+				}
+			}
+			return fmt.Errorf("%s has no variant %s", def.Name, enum.Variant)
+		}
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("want a map for %s, got %T", def.Name, value)
+		}
+		return idl.encodeFields(e, def.Type.Fields, fields)
+	}
+
+	switch t.Primitive {
+	case "bool":
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("want a bool, got %T", value)
+		}
+		e.WriteBool(v)
+	case "string":
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("want a string, got %T", value)
+		}
+		return e.WriteString(v)
+	case "bytes":
+		v, ok := value.([]byte)
+		if !ok {
+			return fmt.Errorf("want []byte, got %T", value)
+		}
+		return e.WriteBytes(v)
+	case "pubkey":
+		v, ok := value.(solana.PublicKey)
+		if !ok {
+			return fmt.Errorf("want a public key, got %T", value)
+		}
+		e.WriteFixed(v[:])
+	case "u128", "i128":
+		v, err := toBig(value)
+		if err != nil {
+			return err
+		}
+		if t.Primitive == "u128" {
+			return e.WriteU128(v)
+		}
+		return e.WriteI128(v)
+	default:
+		return encodeInt(e, t.Primitive, value)
+	}
+	return nil
+}
+
+// encodeFields writes the named values of fields in order
+func (idl *IDL) encodeFields(e *Encoder, fields []Field, values map[string]any) error {
+	if len(values) != len(fields) {
+		return fmt.Errorf("want %d fields, got %d", len(fields), len(values))
+	}
+	for _, field := range fields {
+		value, ok := values[field.Name]
+		if !ok {
+			return fmt.Errorf("missing field %s", field.Name)
+		}
+		if err := idl.encode(e, field.Type, value); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+// decode reads a value of type t, as encode takes it: integers as the Go
+// type of their size, vecs and arrays as []any except bytes as []byte
+func (idl *IDL) decode(d *Decoder, t Type) (any, error) {
+	switch {
+	case t.Option != nil:
+		some, err := d.ReadBool()
+		if err != nil || !some {
+			return nil, err
+		}
+		return idl.decode(d, *t.Option)
+
+	case t.Vec != nil, t.Array != nil:
+		n, elem := t.Len, t.Array
+		if t.Vec != nil {
+			var err error
+			if n, err = d.ReadLen(); err != nil {
+				return nil, err
+			}
+			elem = t.Vec
+			// The length comes from the data, so it must fit the bytes
+			// left before anything is allocated for it. Elements that
+			// encode to nothing would let any length fit.
+			size, err := idl.minSize(*elem, nil)
+			if err != nil {
+				return nil, err
+			}
+			if size == 0 {
+				return nil, fmt.Errorf("vec of %d elements that take no bytes", n)
+			}
+			if n > d.Remaining()/size {
+				return nil, fmt.Errorf("vec of %d elements of %d bytes or more exceeds the %d bytes left", n, size, d.Remaining())
+			}
+		}
+		values := make([]any, 0, min(n, d.Remaining()))
+		for i := 0; i < n; i++ {
+			value, err := idl.decode(d, *elem)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			values = append(values, value)
+		}
+		return values, nil
+
+	case t.Defined != "":
+		def, err := idl.typeDef(t.Defined)
+		if err != nil {
+			return nil, err
+		}
+		if def.Type.Kind == "enum" {
+			i, err := d.ReadU8()
+			if err != nil {
+				return nil, err
+			}
+			if int(i) >= len(def.Type.Variants) {
+				return nil, fmt.Errorf("%s has no variant %d", def.Name, i)
+			}
+			variant := def.Type.Variants[i]
+			fields, err := idl.decodeFields(d, variant.Fields)
+			if err != nil {
+				return nil, err
+			}
+			return Enum{Variant: variant.Name, Fields: fields}, nil
+		}
+		return idl.decodeFields(d, def.Type.Fields)
+	}
+
+	switch t.Primitive {
+	case "bool":
+		return d.ReadBool()
+	case "string":
+		return d.ReadString()
+	case "bytes":
+		b, err := d.ReadBytes()
+		return bytes.Clone(b), err
+	case "pubkey":
+		b, err := d.ReadFixed(solana.PublicKeyLength)
+		if err != nil {
+			return nil, err
+		}
+		return solana.PublicKeyFromBytes(b), nil
+	case "u8":
+		return d.ReadU8()
+	case "u16":
+		return d.ReadU16()
+	case "u32":
+		return d.ReadU32()
+	case "u64":
+		return d.ReadU64()
+	case "u128":
+		return d.ReadU128()
+	case "i8":
+		v, err := d.ReadU8()
+		return int8(v), err
+	case "i16":
+		v, err := d.ReadU16()
+		return int16(v), err
+	case "i32":
+		v, err := d.ReadU32()
+		return int32(v), err
+	case "i64":
+		v, err := d.ReadU64()
+		return int64(v), err
+	case "i128":
+		return d.ReadI128()
+	}
+	return nil, fmt.Errorf("unsupported type %q", t.Primitive)
+}
+
+// minSize returns the fewest bytes a value of type t encodes to. seen holds
+// the structs being sized, which cannot contain themselves.
+func (idl *IDL) minSize(t Type, seen map[string]bool) (int, error) {
+	switch {
+	case t.Option != nil:
+		return 1, nil
+	case t.Vec != nil:
+		return 4, nil
+	case t.Array != nil:
+		size, err := idl.minSize(*t.Array, seen)
+		return t.Len * size, err
+	case t.Defined != "":
+		def, err := idl.typeDef(t.Defined)
+		if err != nil {
+			return 0, err
+		}
+		if def.Type.Kind == "enum" {
+			return 1, nil
+		}
+		if seen[def.Name] {
+			return 0, fmt.Errorf("%s contains itself", def.Name)
+		}
+		if seen == nil {
+			seen = make(map[string]bool)
+		}
+		seen[def.Name] = true
+		defer delete(seen, def.Name)
+		size := 0
+		for _, field := range def.Type.Fields {
+			n, err := idl.minSize(field.Type, seen)
+			if err != nil {
+				return 0, err
+			}
+			size += n
+		}
+		return size, nil
+	}
+	switch t.Primitive {
+	case "bool", "u8", "i8":
+		return 1, nil
+	case "u16", "i16":
+		return 2, nil
+	case "u32", "i32", "string", "bytes":
+		return 4, nil
+	case "u64", "i64":
+		return 8, nil
+	case "u128", "i128":
+		return 16, nil
+	case "pubkey":
+		return solana.PublicKeyLength, nil
+	}
+	return 0, fmt.Errorf("unsupported type %q", t.Primitive)
+}
+
+// decodeFields reads fields in order into a map keyed by field name
+func (idl *IDL) decodeFields(d *Decoder, fields []Field) (map[string]any, error) {
+	values := make(map[string]any, len(fields))
+	for _, field := range fields {
+		value, err := idl.decode(d, field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		values[field.Name] = value
+	}
+	return values, nil
+}
+
+// encodeInt writes value as the fixed size integer primitive
+func encodeInt(e *Encoder, primitive string, value any) error {
+	bits := map[string]int{"u8": 8, "u16": 16, "u32": 32, "u64": 64, "i8": 8, "i16": 16, "i32": 32, "i64": 64}[primitive]
+	if bits == 0 {
+		return fmt.Errorf("unsupported type %q", primitive)
+	}
+	v, err := toBig(value)
+	if err != nil {
+		return err
+	}
+	var u uint64
+	if primitive[0] == 'u' {
+		if v.Sign() < 0 || v.BitLen() > bits {
+			return fmt.Errorf("%s overflows %s", v, primitive)
+		}
+		u = v.Uint64()
+	} else {
+		// The most negative value is -2^(bits-1), so negatives are checked as |v|-1
+		magnitude := new(big.Int).Abs(v)
+		if v.Sign() < 0 {
+			magnitude.Sub(magnitude, big.NewInt(1))
+		}
+		if magnitude.BitLen() > bits-1 {
+			return fmt.Errorf("%s overflows %s", v, primitive)
+		}
+		u = uint64(v.Int64())
+	}
+	switch bits {
+	case 8:
+		e.WriteU8(uint8(u))
+	case 16:
+		e.WriteU16(uint16(u))
+	case 32:
+		e.WriteU32(uint32(u))
+	default:
+		e.WriteU64(u)
+	}
+	return nil
+}
+
+// toBig converts a Go integer or *big.Int
+func toBig(value any) (*big.Int, error) {
+	if v, ok := value.(*big.Int); ok {
+		return v, nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Int).SetUint64(v.Uint()), nil
+	}
+	return nil, fmt.Errorf("want an integer, got %T", value)
+}
+
+// snakeCase turns the camelCase names of legacy IDLs into the Rust names
+// their discriminators hash
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// UnmarshalJSON reads "u64", {"vec": T}, {"option": T}, {"array": [T, n]}
+// and {"defined": {"name": "X"}}, or {"defined": "X"} in legacy IDLs
+func (t *Type) UnmarshalJSON(data []byte) error {
+	var primitive string
+	if err := json.Unmarshal(data, &primitive); err == nil {
+		if primitive == "publicKey" {
+			primitive = "pubkey"
+		}
+		*t = Type{Primitive: primitive}
+		return nil
+	}
+	var composite struct {
+		Vec     *Type             `json:"vec"`
+		Option  *Type             `json:"option"`
+		Array   []json.RawMessage `json:"array"`
+		Defined json.RawMessage   `json:"defined"`
+	}
+	if err := json.Unmarshal(data, &composite); err != nil {
+		return err
+	}
+	*t = Type{Vec: composite.Vec, Option: composite.Option}
+	switch {
+	case composite.Array != nil:
+		if len(composite.Array) != 2 {
+			return fmt.Errorf("invalid array type %s", data)
+		}
+		t.Array = new(Type)
+		if err := json.Unmarshal(composite.Array[0], t.Array); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(composite.Array[1], &t.Len); err != nil {
+			return fmt.Errorf("invalid array length %s", composite.Array[1])
+		}
+	case composite.Defined != nil:
+		var defined struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(composite.Defined, &t.Defined); err != nil {
+			if err := json.Unmarshal(composite.Defined, &defined); err != nil {
+				return err
+			}
+			t.Defined = defined.Name
+		}
+	case t.Vec == nil && t.Option == nil:
+		return fmt.Errorf("unsupported type %s", data)
+	}
+	return nil
+}
+
+// UnmarshalJSON reads named fields, [{"name": "a", "type": T}], and
+// positional ones, [T], named by their index
+func (v *Variant) UnmarshalJSON(data []byte) error {
+	var variant struct {
+		Name   string            `json:"name"`
+		Fields []json.RawMessage `json:"fields"`
+	}
+	if err := json.Unmarshal(data, &variant); err != nil {
+		return err
+	}
+	*v = Variant{Name: variant.Name}
+	for i, raw := range variant.Fields {
+		var field Field
+		if err := json.Unmarshal(raw, &field); err != nil || field.Name == "" {
+			field = Field{Name: fmt.Sprint(i)}
+			if err := json.Unmarshal(raw, &field.Type); err != nil {
+				return fmt.Errorf("variant %s, field %d: %w", variant.Name, i, err)
+			}
+		}
+		v.Fields = append(v.Fields, field)
+	}
+	return nil
+}
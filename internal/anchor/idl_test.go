@@ -0,0 +1,223 @@
+package anchor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ballotIDL describes a ballot results program using every supported type
+const ballotIDL = `{
+  "address": "11111111111111111111111111111112",
+  "metadata": {"name": "ballot_results", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [{
+    "name": "publish_results",
+    "discriminator": [1, 2, 3, 4, 5, 6, 7, 8],
+    "accounts": [
+      {"name": "authority", "signer": true},
+      {"name": "results", "writable": true}
+    ],
+    "args": [
+      {"name": "ballot", "type": "string"},
+      {"name": "tally", "type": {"vec": {"defined": {"name": "OptionTally"}}}},
+      {"name": "outcome", "type": {"defined": {"name": "Outcome"}}},
+      {"name": "root", "type": {"array": ["u8", 4]}},
+      {"name": "closes_at", "type": {"option": "i64"}},
+      {"name": "weight", "type": "u128"},
+      {"name": "proof", "type": "bytes"}
+    ]
+  }],
+  "types": [
+    {"name": "OptionTally", "type": {"kind": "struct", "fields": [
+      {"name": "option", "type": "u8"},
+      {"name": "votes", "type": "u32"},
+      {"name": "final", "type": "bool"}
+    ]}},
+    {"name": "Outcome", "type": {"kind": "enum", "variants": [
+      {"name": "Undecided"},
+      {"name": "Winner", "fields": [{"name": "option", "type": "u8"}, {"name": "by", "type": "pubkey"}]},
+      {"name": "Tie", "fields": [{"vec": "u8"}]}
+    ]}}
+  ]
+}`
+
+func TestIDLRoundTrip(t *testing.T) {
+	idl, err := ParseIDL([]byte(ballotIDL))
+	require.NoError(t, err)
+	ix, err := idl.Instruction("publish_results")
+	require.NoError(t, err)
+	by := solana.PublicKeyFromBytes(bytes.Repeat([]byte{9}, 32))
+	args := map[string]any{
+		"ballot": "b1",
+		"tally": []map[string]any{
+			{"option": 0, "votes": uint32(2), "final": true},
+			{"option": uint8(1), "votes": 1, "final": false},
+		},
+		"outcome":   Enum{Variant: "Winner", Fields: map[string]any{"option": 0, "by": by}},
+		"root":      [4]byte{0xde, 0xad, 0xbe, 0xef},
+		"closes_at": -5,
+		"weight":    big.NewInt(7),
+		"proof":     []byte{1},
+	}
+	data, err := idl.Encode(ix, args)
+	require.NoError(t, err)
+	golden := "0102030405060708" +
+		"02000000" + "6231" + // "b1"
+		"02000000" + "00" + "02000000" + "01" + "01" + "01000000" + "00" +
+		"01" + "00" + hex.EncodeToString(by[:]) + // Winner{option: 0, by}
+		"deadbeef" +
+		"01" + "fbffffffffffffff" + // Some(-5)
+		"07000000000000000000000000000000" +
+		"01000000" + "01"
+	assert.Equal(t, golden, hex.EncodeToString(data))
+
+	decoded, values, err := idl.Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, ix, decoded)
+	assert.Equal(t, map[string]any{
+		"ballot": "b1",
+		"tally": []any{
+			map[string]any{"option": uint8(0), "votes": uint32(2), "final": true},
+			map[string]any{"option": uint8(1), "votes": uint32(1), "final": false},
+		},
+		"outcome":   Enum{Variant: "Winner", Fields: map[string]any{"option": uint8(0), "by": by}},
+		"root":      []any{uint8(0xde), uint8(0xad), uint8(0xbe), uint8(0xef)},
+		"closes_at": int64(-5),
+		"weight":    big.NewInt(7),
+		"proof":     []byte{1},
+	}, values)
+
+	// Decoded values encode back to the same data
+	again, err := idl.Encode(ix, values)
+	require.NoError(t, err)
+	assert.Equal(t, data, again)
+
+	// Unit and positional variants, and a missing option
+	args["outcome"] = Enum{Variant: "Tie", Fields: map[string]any{"0": []byte{0, 1}}}
+	args["closes_at"] = nil
+	data, err = idl.Encode(ix, args)
+	require.NoError(t, err)
+	_, values, err = idl.Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, Enum{Variant: "Tie", Fields: map[string]any{"0": []any{uint8(0), uint8(1)}}}, values["outcome"])
+	assert.Nil(t, values["closes_at"])
+	args["outcome"] = Enum{Variant: "Undecided"}
+	data, err = idl.Encode(ix, args)
+	require.NoError(t, err)
+	_, values, err = idl.Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, Enum{Variant: "Undecided", Fields: map[string]any{}}, values["outcome"])
+
+	authority, results := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	instruction, err := idl.NewInstruction(solana.MustPublicKeyFromBase58(idl.Address), ix, []solana.PublicKey{authority, results}, args)
+	require.NoError(t, err)
+	metas := instruction.Accounts()
+	assert.True(t, metas[0].IsSigner)
+	assert.False(t, metas[0].IsWritable)
+	assert.True(t, metas[1].IsWritable)
+	_, err = idl.NewInstruction(solana.MustPublicKeyFromBase58(idl.Address), ix, []solana.PublicKey{authority}, args)
+	assert.ErrorContains(t, err, "takes 2 accounts")
+	assert.Equal(t, `publish_results(ballot: b1, tally: [], outcome: {Undecided map[]}, root: [1 2], closes_at: <nil>, weight: 7, proof: [])`,
+		ix.Format(map[string]any{"ballot": "b1", "tally": []any{}, "outcome": Enum{Variant: "Undecided", Fields: map[string]any{}}, "root": []any{1, 2}, "weight": big.NewInt(7), "proof": []byte{}}))
+}
+
+func TestIDLRejects(t *testing.T) {
+	idl, err := ParseIDL([]byte(ballotIDL))
+	require.NoError(t, err)
+	ix, err := idl.Instruction("publish_results")
+	require.NoError(t, err)
+	valid := func() map[string]any {
+		return map[string]any{
+			"ballot": "b1", "tally": []any{}, "outcome": Enum{Variant: "Undecided"},
+			"root": []byte{0, 0, 0, 0}, "closes_at": nil, "weight": 0, "proof": []byte{},
+		}
+	}
+	_, err = idl.Encode(ix, valid())
+	require.NoError(t, err)
+
+	for name, change := range map[string]struct {
+		arg   string
+		value any
+		err   string
+	}{
+		"integer overflow": {"tally", []map[string]any{{"option": 256, "votes": 0, "final": true}}, "overflows u8"},
+		"negative":         {"weight", -1, "overflows u128"},
+		"wrong type":       {"ballot", 5, "want a string"},
+		"array length":     {"root", []byte{0}, "want 4 elements"},
+		"unknown variant":  {"outcome", Enum{Variant: "Lost"}, "no variant Lost"},
+		"missing field":    {"tally", []map[string]any{{"option": 0, "votes": 0}}, "want 3 fields"},
+	} {
+		args := valid()
+		args[change.arg] = change.value
+		_, err := idl.Encode(ix, args)
+		assert.ErrorContains(t, err, change.err, name)
+	}
+	for value, fits := range map[int64]bool{127: true, 128: false, -128: true, -129: false} {
+		err := encodeInt(&Encoder{}, "i8", value)
+		assert.Equal(t, fits, err == nil, value)
+	}
+	assert.NoError(t, encodeInt(&Encoder{}, "i64", int64(-1<<63)))
+	assert.NoError(t, encodeInt(&Encoder{}, "u64", uint64(1<<64-1)))
+	args := valid()
+	delete(args, "proof")
+	_, err = idl.Encode(ix, args)
+	assert.ErrorContains(t, err, "takes 7 arguments")
+
+	data, err := idl.Encode(ix, valid())
+	require.NoError(t, err)
+	for n := 0; n < len(data); n++ {
+		_, _, err := idl.Decode(data[:n])
+		assert.Error(t, err, n)
+	}
+	_, _, err = idl.Decode(append(data, 0))
+	assert.ErrorContains(t, err, "1 trailing bytes")
+	// The tally length, after the discriminator and the ballot, is checked
+	// against the data before anything is allocated
+	huge := bytes.Clone(data)
+	copy(huge[14:], []byte{0xff, 0xff, 0xff, 0xff})
+	_, _, err = idl.Decode(huge)
+	assert.ErrorContains(t, err, "vec of 4294967295 elements of 6 bytes or more exceeds")
+	empty, err := ParseIDL([]byte(`{"instructions": [{"name": "f", "discriminator": [0, 0, 0, 0, 0, 0, 0, 0],
+		"args": [{"name": "x", "type": {"vec": {"defined": {"name": "Empty"}}}}]}],
+		"types": [{"name": "Empty", "type": {"kind": "struct", "fields": []}}]}`))
+	require.NoError(t, err)
+	_, _, err = empty.Decode(append(make([]byte, 8), 0xff, 0xff, 0xff, 0xff))
+	assert.ErrorContains(t, err, "vec of 4294967295 elements that take no bytes")
+	_, err = idl.Instruction("cast_vote")
+	assert.ErrorContains(t, err, "ballot_results has no instruction cast_vote")
+
+	_, err = ParseIDL([]byte(`{"instructions": [{"name": "f", "args": [{"name": "x", "type": "f64"}]}]}`))
+	assert.ErrorContains(t, err, `unsupported type "f64"`)
+	_, err = ParseIDL([]byte(`{"instructions": [{"name": "f", "args": [{"name": "x", "type": {"defined": "Missing"}}]}]}`))
+	assert.ErrorContains(t, err, "undefined type Missing")
+}
+
+func TestLegacyIDL(t *testing.T) {
+	// Anchor before 0.30 wrote camelCase names, publicKey and isMut, and no
+	// discriminators
+	idl, err := ParseIDL([]byte(`{
+	  "version": "0.1.0",
+	  "name": "payment_validator",
+	  "instructions": [{
+	    "name": "validatePaymentDistribution",
+	    "accounts": [{"name": "sender", "isMut": true, "isSigner": true}],
+	    "args": [
+	      {"name": "totalAmount", "type": "u64"},
+	      {"name": "receivers", "type": {"vec": "publicKey"}},
+	      {"name": "amounts", "type": {"vec": "u64"}}
+	    ]
+	  }]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "payment_validator", idl.Metadata.Name)
+	ix, err := idl.Instruction("validatePaymentDistribution")
+	require.NoError(t, err)
+	assert.Equal(t, "43a04bcd33172680", hex.EncodeToString(ix.Discriminator))
+	assert.Equal(t, InstructionAccount{Name: "sender", Writable: true, Signer: true, IsMut: true, IsSigner: true}, ix.Accounts[0])
+	assert.Equal(t, Type{Vec: &Type{Primitive: "pubkey"}}, ix.Args[1].Type)
+}
@@ -3,10 +3,12 @@ package ballot
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	mpc "tilt-valid/internal/mpc"
+	vrf "tilt-valid/internal/vrf"
 )
 
 // Database interface for future database integration
@@ -299,6 +301,35 @@ func (bs *BallotService) GetTallyResult(ballotID string) (*TallyResult, error) {
 	return result, nil
 }
 
+// SampleVotes draws k votes of a ballot for audit. The ballot ID is the seed, so
+// any validator holding the returned proof can re-derive the same sample.
+func (bs *BallotService) SampleVotes(ctx context.Context, ballotID string, k int, source vrf.RandomnessSource) ([]*Vote, vrf.Output, vrf.Proof, error) {
+	bs.mutex.RLock()
+	votes, err := bs.storage.GetVotesByBallot(ballotID)
+	bs.mutex.RUnlock()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get votes: %w", err)
+	}
+
+	// Storage order is not guaranteed, sampling must not depend on it
+	sort.Slice(votes, func(i, j int) bool {
+		return votes[i].ID < votes[j].ID
+	})
+
+	output, proof, err := source.Request(ctx, []byte("ballot-sample:"+ballotID))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to obtain sampling randomness: %w", err)
+	}
+
+	var sample []*Vote
+	for _, idx := range output.Sample(len(votes), k) {
+		sample = append(sample, votes[idx])
+	}
+
+	bs.logger.Infof("Sampled %d of %d votes on ballot %s", len(sample), len(votes), ballotID)
+	return sample, output, proof, nil
+}
+
 // CreateFromTemplate creates a new ballot from a template
 func (bs *BallotService) CreateFromTemplate(templateID, title, description, createdBy string, startTime, endTime time.Time) (*Ballot, error) {
 	bs.mutex.RLock()
@@ -0,0 +1,173 @@
+package distribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Asset identifies what a tilt pays out: native SOL or the mint address of an
+// SPL token, in base58
+type Asset string
+
+// NativeSOL is the asset of native SOL transfers, in lamports
+const NativeSOL Asset = "SOL"
+
+// IsNative reports whether the asset is native SOL
+func (a Asset) IsNative() bool {
+	return a == NativeSOL
+}
+
+// Mint returns the SPL token mint, failing for native SOL
+func (a Asset) Mint() (solana.PublicKey, error) {
+	if a.IsNative() {
+		return solana.PublicKey{}, fmt.Errorf("%s has no mint", a)
+	}
+	mint, err := solana.PublicKeyFromBase58(string(a))
+	if err != nil {
+		return solana.PublicKey{}, fmt.Errorf("invalid asset %q: not %s or a mint address", string(a), NativeSOL)
+	}
+	return mint, nil
+}
+
+// check rejects anything but native SOL and well-formed mint addresses
+func (a Asset) check() error {
+	if a.IsNative() {
+		return nil
+	}
+	_, err := a.Mint()
+	return err
+}
+
+// Payment is one asset's payouts in the shape of the on-chain
+// validate_payment_distribution instruction: Amounts[i] goes to Receivers[i]
+// and they sum to Total
+type Payment struct {
+	Asset     Asset    `json:"asset"`
+	Total     uint64   `json:"total"`
+	Receivers []string `json:"receivers"`
+	Amounts   []uint64 `json:"amounts"`
+}
+
+// Payment returns the allocations due now as a payment. Amounts carried
+// forward are left out, so Total can be less than the distribution's.
+func (d *Distribution) Payment() Payment {
+	p := Payment{Asset: d.Asset}
+	for _, a := range d.Allocations {
+		p.Receivers = append(p.Receivers, a.Receiver)
+		p.Amounts = append(p.Amounts, a.Amount)
+		p.Total += a.Amount // bounded by the distribution's checked total
+	}
+	return p
+}
+
+// Distributions holds one distribution per asset
+type Distributions map[Asset]*Distribution
+
+// Assets returns the distributed assets in order, native SOL first
+func (d Distributions) Assets() []Asset {
+	assets := make([]Asset, 0, len(d))
+	for asset := range d {
+		assets = append(assets, asset)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		if assets[i].IsNative() != assets[j].IsNative() {
+			return assets[i].IsNative()
+		}
+		return assets[i] < assets[j]
+	})
+	return assets
+}
+
+// Totals returns the amount distributed in each asset
+func (d Distributions) Totals() map[Asset]uint64 {
+	totals := make(map[Asset]uint64, len(d))
+	for asset, dist := range d {
+		totals[asset] = dist.Total
+	}
+	return totals
+}
+
+// Payments returns one payment per asset, in the order of Assets; each maps
+// to its own instruction since one instruction moves a single asset
+func (d Distributions) Payments() []Payment {
+	var payments []Payment
+	for _, asset := range d.Assets() {
+		payments = append(payments, d[asset].Payment())
+	}
+	return payments
+}
+
+// LoadDistributions reads distributions from the JSON written by explain -json
+func LoadDistributions(path string) (Distributions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read distributions: %w", err)
+	}
+	var d Distributions
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("invalid distributions in %s: %w", path, err)
+	}
+	for asset, dist := range d {
+		if err := asset.check(); err != nil {
+			return nil, err
+		}
+		if dist == nil || dist.Asset != asset {
+			return nil, fmt.Errorf("invalid distributions in %s: %s is listed under another asset", path, asset)
+		}
+	}
+	return d, nil
+}
+
+// DistributeAssets distributes several root tilts that may pay different
+// assets. Roots paying the same asset are distributed together with that
+// asset's options (the zero Options if it has none), so their payouts and
+// carry-forward merge into one distribution. A tilt reachable from two roots
+// would be paid twice and is rejected, like a tilt with two parents.
+func DistributeAssets(tilts Tilts, rootIDs []int, opts map[Asset]Options) (Distributions, error) {
+	byAsset := make(map[Asset][]int)
+	owner := make(map[int]int)
+	for _, root := range rootIDs {
+		if err := Validate(tilts, root); err != nil {
+			return nil, err
+		}
+		for _, id := range reachable(tilts, root) {
+			if other, ok := owner[id]; ok {
+				return nil, &ValidationError{Root: root, Problems: []Problem{{id, fmt.Sprintf("reachable from roots %d and %d", other, root)}}}
+			}
+			owner[id] = root
+		}
+		asset := rootAsset(tilts[root])
+		byAsset[asset] = append(byAsset[asset], root)
+	}
+
+	result := make(Distributions, len(byAsset))
+	for asset, roots := range byAsset {
+		d, err := distribute(tilts, roots, asset, opts[asset])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", asset, err)
+		}
+		result[asset] = d
+	}
+	return result, nil
+}
+
+// rootAsset is the asset paid by a root tilt
+func rootAsset(tilt *Tilt) Asset {
+	if tilt.Asset == "" {
+		return NativeSOL
+	}
+	return tilt.Asset
+}
+
+// reachable lists the tilts of a validated graph, root first
+func reachable(tilts Tilts, root int) []int {
+	ids := []int{root}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, tilts[ids[i]].Subtilts...)
+	}
+	return ids
+}
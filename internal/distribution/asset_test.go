@@ -0,0 +1,97 @@
+package distribution
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const usdc Asset = "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v"
+
+func TestDistributeAssets(t *testing.T) {
+	tilts, err := ParseTiltsCSV(strings.NewReader(
+		"2,a,[100],null,1000\n" +
+			"10,a;c,\"[50,50]\",[11],500,,," + string(usdc) + "\n" +
+			"11,c,[100],null,1\n" +
+			"20,d,[100],null,7,,,SOL\n"))
+	require.NoError(t, err)
+	assert.Equal(t, usdc, tilts[10].Asset)
+	assert.Empty(t, tilts[11].Asset)
+
+	d, err := DistributeAssets(tilts, []int{2, 10, 20}, map[Asset]Options{
+		usdc: {MinPayout: 200},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []Asset{NativeSOL, usdc}, d.Assets())
+	assert.Equal(t, map[Asset]uint64{NativeSOL: 1007, usdc: 501}, d.Totals())
+
+	// Roots paying the same asset merge; the subtilt inherits its parent's mint
+	assert.Equal(t, []Payment{
+		{Asset: NativeSOL, Total: 1007, Receivers: []string{"a", "d"}, Amounts: []uint64{1000, 7}},
+		{Asset: usdc, Total: 376, Receivers: []string{"c"}, Amounts: []uint64{376}},
+	}, d.Payments())
+	assert.Equal(t, map[string]uint64{"a": 125}, d[usdc].CarryForward)
+
+	// A graph reachable from two roots would be paid twice
+	_, err = DistributeAssets(tilts, []int{10, 11}, nil)
+	assert.EqualError(t, err, "tilt graph rooted at 11 has 1 problem(s): tilt 11: reachable from roots 10 and 11")
+}
+
+func TestLoadDistributions(t *testing.T) {
+	tilts, err := ParseTiltsCSV(strings.NewReader("2,a;b,[100],null,1001\n10,c,[100],null,500,,," + string(usdc) + "\n"))
+	require.NoError(t, err)
+	d, err := DistributeAssets(tilts, []int{2, 10}, map[Asset]Options{NativeSOL: {Trace: true}})
+	require.NoError(t, err)
+
+	// Distributions come back from the JSON explain -json prints
+	data, err := json.Marshal(d)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "distributions.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	loaded, err := LoadDistributions(path)
+	require.NoError(t, err)
+	assert.Equal(t, d.Payments(), loaded.Payments())
+	assert.Equal(t, d[NativeSOL].Trace, loaded[NativeSOL].Trace)
+
+	for body, problem := range map[string]string{
+		`[1]`: "invalid distributions",
+		`{"SOL": {"asset": "` + string(usdc) + `"}}`: "SOL is listed under another asset",
+		`{"gold": {"asset": "gold"}}`:                `invalid asset "gold"`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+		_, err := LoadDistributions(path)
+		assert.ErrorContains(t, err, problem, body)
+	}
+}
+
+func TestValidateRejectsMixedAssets(t *testing.T) {
+	tilts := Tilts{
+		1: {ID: 1, Receivers: []string{"a"}, BusinessRules: []uint64{50, 50}, Subtilts: []int{2}, Amount: 10, Asset: usdc},
+		2: {ID: 2, Receivers: []string{"b"}, BusinessRules: []uint64{50, 50}, Subtilts: []int{3}, Asset: NativeSOL},
+		3: {ID: 3, Receivers: []string{"c"}, BusinessRules: []uint64{100}, Asset: "bonk"},
+	}
+	assert.Equal(t, []Problem{
+		{2, "pays SOL but parent tilt 1 pays " + string(usdc)},
+		{3, "pays bonk but parent tilt 2 pays SOL"},
+		{3, `invalid asset "bonk": not SOL or a mint address`},
+	}, problems(t, tilts, 1))
+
+	// An unset asset at the root is native SOL
+	tilts[1].Asset = ""
+	tilts[3].Asset = ""
+	assert.NoError(t, Validate(tilts, 1))
+	d, err := Distribute(tilts, 1, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, NativeSOL, d.Asset)
+
+	_, err = NativeSOL.Mint()
+	assert.Error(t, err)
+	mint, err := usdc.Mint()
+	require.NoError(t, err)
+	assert.Equal(t, string(usdc), mint.String())
+}
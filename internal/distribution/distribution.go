@@ -1,116 +1,345 @@
 package distribution
 
 import (
+	"errors"
 	"fmt"
+	"math/bits"
 	"sort"
-	"strconv"
 )
 
-// DistributionData represents the node data with float64 for amounts
-type DistributionData struct {
-	Amount        float64   `json:"amount"`
-	BusinessRules []float64 `json:"business_rules"`
-	ID            int       `json:"id"`
-	Receiver      []string  `json:"receiver"`
-	Subtilt       []int     `json:"subtilt"`
-}
+// ErrOverflow is returned when an amount does not fit in a uint64
+var ErrOverflow = errors.New("amount overflows uint64")
+
+// Rule names the part of a tilt's business rules that produced an amount
+type Rule string
+
+const (
+	// RuleProtocol is the protocol fee tier
+	RuleProtocol Rule = "protocol"
+	// RulePublisher is the publisher fee tier
+	RulePublisher Rule = "publisher"
+	// RuleCurator is the local share paid to a tilt's receivers
+	RuleCurator Rule = "curator"
+	// RuleRounding is dust paid to the treasury under RoundToTreasury
+	RuleRounding Rule = "rounding"
+	// RuleCarried is dust carried forward from an earlier distribution
+	RuleCarried Rule = "carried"
+)
 
 // Allocation defines the output format
 type Allocation struct {
-	Receiver string
-	Amount   float64
+	Receiver string `json:"receiver"`
+	Amount   uint64 `json:"amount"`
+	// ByRule attributes Amount to the rules that produced it
+	ByRule map[Rule]uint64 `json:"by_rule"`
+}
+
+// Options configures a distribution
+type Options struct {
+	Rounding Rounding
+	// Treasury receives all rounding dust under RoundToTreasury
+	Treasury string
+	// Seed drives SeededRandom; use the epoch beacon output so every validator agrees
+	Seed []byte
+	// MinPayout withholds allocations smaller than this and carries them forward
+	MinPayout uint64
+	// Carried is the carry-forward of the previous distribution, added to this one
+	Carried map[string]uint64
+	// Trace records how every amount was produced in Distribution.Trace
+	Trace bool
+}
+
+func (o Options) validate() error {
+	switch o.Rounding {
+	case LargestRemainder, BankersRounding:
+	case RoundToTreasury:
+		if o.Treasury == "" {
+			return fmt.Errorf("%s rounding needs a treasury receiver", o.Rounding)
+		}
+	case SeededRandom:
+		if len(o.Seed) == 0 {
+			return fmt.Errorf("%s rounding needs a seed", o.Rounding)
+		}
+	default:
+		return fmt.Errorf("unknown rounding policy %d", int(o.Rounding))
+	}
+	return nil
+}
+
+// Distribution is the outcome of distributing a tilt graph
+type Distribution struct {
+	// Asset is what every amount is paid in
+	Asset Asset `json:"asset"`
+	// Allocations are the payouts due now, ordered by receiver
+	Allocations []Allocation `json:"allocations"`
+	// CarryForward holds amounts below MinPayout, to pass as Options.Carried next time
+	CarryForward map[string]uint64 `json:"carry_forward,omitempty"`
+	// Total is everything distributed: the tilts' amounts plus the carried-in dust
+	Total uint64 `json:"total"`
+	// Trace explains every allocation when Options.Trace is set
+	Trace *Trace `json:"trace,omitempty"`
 }
 
 // AllocateAmounts distributes amounts across the hierarchy starting from rootID
-func AllocateAmounts(tiltData map[string]map[string]interface{}, rootID string) ([]Allocation, error) {
-	allocations := make(map[string]int) // Receiver ID -> total amount
-	err := allocateRecursive(tiltData, rootID, 0, allocations)
+// using largest-remainder rounding
+func AllocateAmounts(tilts Tilts, rootID int) ([]Allocation, error) {
+	return AllocateAmountsWithOptions(tilts, rootID, Options{})
+}
+
+// AllocateAmountsWithOptions is Distribute returning only the payouts due now;
+// with MinPayout set, use Distribute to keep the carry-forward
+func AllocateAmountsWithOptions(tilts Tilts, rootID int, opts Options) ([]Allocation, error) {
+	d, err := Distribute(tilts, rootID, opts)
 	if err != nil {
 		return nil, err
 	}
+	return d.Allocations, nil
+}
 
-	// Convert map to slice
-	var result []Allocation
-	for receiver, amount := range allocations {
-		result = append(result, Allocation{Receiver: receiver, Amount: float64(amount)})
+// Distribute allocates the tilt graph starting from rootID. The graph is
+// validated first, so a malformed graph returns a *ValidationError and nothing
+// is allocated. Whatever the options, the allocations and carry-forward always
+// sum exactly to Total, so the payouts match the total_amount checked by the
+// on-chain validate_payment_distribution instruction.
+func Distribute(tilts Tilts, rootID int, opts Options) (*Distribution, error) {
+	if err := Validate(tilts, rootID); err != nil {
+		return nil, err
 	}
+	return distribute(tilts, []int{rootID}, rootAsset(tilts[rootID]), opts)
+}
 
-	// Sort by receiver ID for consistent output (optional)
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].Receiver < result[j].Receiver
-	})
+// distribute allocates validated, disjoint tilt graphs paying one asset
+func distribute(tilts Tilts, rootIDs []int, asset Asset, opts Options) (*Distribution, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
 
-	return result, nil
-}
+	a := &allocator{
+		tilts:   tilts,
+		opts:    opts,
+		credits: make(map[string]map[Rule]uint64),
+		totals:  make(map[string]uint64),
+	}
+	if opts.Trace {
+		a.trace = newTrace()
+	}
+	var total uint64
+	for _, rootID := range rootIDs {
+		distributed, err := a.allocate(rootID, 0, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		var carry uint64
+		if total, carry = bits.Add64(total, distributed, 0); carry != 0 {
+			return nil, ErrOverflow
+		}
+	}
+	for receiver, amount := range opts.Carried {
+		if err := a.credit(receiver, Contribution{Rule: RuleCarried, Amount: amount}); err != nil {
+			return nil, err
+		}
+		var carry uint64
+		if total, carry = bits.Add64(total, amount, 0); carry != 0 {
+			return nil, ErrOverflow
+		}
+	}
 
-// allocateRecursive processes a node and its subtree
-func allocateRecursive(tiltData map[string]map[string]interface{}, currentID string, receivedAmount int, allocations map[string]int) error {
-	nodeData, ok := tiltData[currentID]
-	if !ok {
-		return fmt.Errorf("node ID %s not found in data", currentID)
+	d := &Distribution{Asset: asset, Total: total, Trace: a.trace}
+	var paid uint64
+	for receiver, byRule := range a.credits {
+		var amount uint64
+		for _, v := range byRule {
+			amount += v // bounded by the checked per-receiver total
+		}
+		if amount == 0 {
+			continue
+		}
+		paid += amount
+		if amount < opts.MinPayout {
+			if d.CarryForward == nil {
+				d.CarryForward = make(map[string]uint64)
+			}
+			d.CarryForward[receiver] = amount
+			continue
+		}
+		d.Allocations = append(d.Allocations, Allocation{Receiver: receiver, Amount: amount, ByRule: byRule})
 	}
 
-	// Extract node data
-	ownAmount := nodeData["amount"].(int)
-	businessRules := nodeData["business_rules"].([]int)
-	receivers := nodeData["receiver"].([]string) // Changed from "receivers" to "receiver"
-	subtilts := nodeData["subtilt"].([]int)
+	// Sort by receiver ID for consistent output
+	sort.Slice(d.Allocations, func(i, j int) bool {
+		return d.Allocations[i].Receiver < d.Allocations[j].Receiver
+	})
 
-	// Validate business rules
-	if len(businessRules) != len(subtilts)+1 {
-		return fmt.Errorf("node %s: business rules length (%d) must be subtilts length (%d) + 1", currentID, len(businessRules), len(subtilts))
+	if paid != total {
+		return nil, fmt.Errorf("allocations sum to %d but %d was distributed", paid, total)
 	}
-	sum := 0
-	for _, p := range businessRules {
-		sum += p
+	return d, nil
+}
+
+// Total sums allocations, failing on overflow
+func Total(allocations []Allocation) (uint64, error) {
+	var total uint64
+	for _, a := range allocations {
+		var carry uint64
+		total, carry = bits.Add64(total, a.Amount, 0)
+		if carry != 0 {
+			return 0, ErrOverflow
+		}
 	}
-	if sum != 100 {
-		return fmt.Errorf("node %s: business rules must sum to 100, got %d", currentID, sum)
+	return total, nil
+}
+
+// Split identifiers keep SeededRandom draws independent within a tilt
+const (
+	splitRules     uint8 = 0
+	splitReceivers uint8 = 1
+	splitFees      uint8 = 2
+)
+
+// allocator walks a validated tilt graph accumulating allocations
+type allocator struct {
+	tilts   Tilts
+	opts    Options
+	credits map[string]map[Rule]uint64 // Receiver ID -> rule -> amount
+	totals  map[string]uint64          // Receiver ID -> total, for overflow checks
+	trace   *Trace                     // nil unless Options.Trace
+	path    []int                      // tilts from the root to the current one
+}
+
+// allocate processes a node and its subtree; the graph must have passed
+// Validate. receivedAmount came from the parent's business rule ruleIndex,
+// with rounding units added by the parent's split. It returns the total
+// amount distributed by the subtree.
+func (a *allocator) allocate(currentID, ruleIndex int, receivedAmount, rounding uint64) (uint64, error) {
+	tilt, ok := a.tilts[currentID]
+	if !ok || tilt == nil {
+		return 0, fmt.Errorf("tilt %d not found in data", currentID)
 	}
+	a.path = append(a.path, currentID)
+	defer func() { a.path = a.path[:len(a.path)-1] }()
 
 	// Compute total amount to distribute
-	totalAmount := ownAmount + receivedAmount
+	totalAmount, carry := bits.Add64(tilt.Amount, receivedAmount, 0)
+	if carry != 0 {
+		return 0, fmt.Errorf("tilt %d: %w", currentID, ErrOverflow)
+	}
+	basis := tilt.RulesBasis()
+
+	// Fee tiers come off the top; the curator share is what is left
+	curatorShare := totalAmount
+	if fees := tilt.Fees; fees != nil {
+		weights := []uint64{fees.Protocol, fees.Publisher, basis - fees.Protocol - fees.Publisher}
+		tiers, dust := a.opts.split(totalAmount, weights, basis, currentID, splitFees)
+		for i, tier := range []struct {
+			receiver string
+			rule     Rule
+		}{{fees.ProtocolReceiver, RuleProtocol}, {fees.PublisherReceiver, RulePublisher}} {
+			if err := a.credit(tier.receiver, a.contribution(tier.rule, i, totalAmount, weights[i], basis, tiers[i])); err != nil {
+				return 0, err
+			}
+		}
+		if err := a.credit(a.opts.Treasury, a.contribution(RuleRounding, 0, 0, 0, 0, dust)); err != nil {
+			return 0, err
+		}
+		curatorShare = tiers[2]
+	}
 
 	// Calculate amounts for local receivers and subtilts
-	amounts := make([]int, len(businessRules))
-	for i, percentage := range businessRules {
-		amounts[i] = (percentage * totalAmount) / 100
-	}
-
-	// Adjust for remainder due to integer division
-	totalAllocated := 0
-	for _, amt := range amounts {
-		totalAllocated += amt
-	}
-	remainder := totalAmount - totalAllocated
-	for i := 0; remainder > 0; i++ {
-		amounts[i%len(amounts)]++
-		remainder--
-	}
-
-	// Distribute local amount to receivers
-	localAmount := amounts[0]
-	numReceivers := len(receivers)
-	if numReceivers > 0 {
-		amountPerReceiver := localAmount / numReceivers
-		remainder := localAmount % numReceivers
-		for i, receiver := range receivers {
-			alloc := amountPerReceiver
-			if i < remainder {
-				alloc++
+	amounts, dust := a.opts.split(curatorShare, tilt.BusinessRules, basis, currentID, splitRules)
+	if err := a.credit(a.opts.Treasury, a.contribution(RuleRounding, 0, 0, 0, 0, dust)); err != nil {
+		return 0, err
+	}
+	if a.trace != nil {
+		a.trace.Nodes = append(a.trace.Nodes, TraceNode{
+			Tilt:             currentID,
+			Path:             append([]int(nil), a.path...),
+			RuleIndex:        ruleIndex,
+			Own:              tilt.Amount,
+			Received:         receivedAmount,
+			ReceivedRounding: rounding,
+			Total:            totalAmount,
+			Local:            amounts[0],
+			LocalRounding:    amounts[0] - floorShare(curatorShare, tilt.BusinessRules[0], basis),
+		})
+	}
+
+	// Distribute local amount to receivers by weight, or in equal shares
+	if len(tilt.Receivers) > 0 {
+		weights, weightBasis := tilt.ReceiverWeights, basis
+		if len(weights) == 0 {
+			weights = make([]uint64, len(tilt.Receivers))
+			for i := range weights {
+				weights[i] = 1
 			}
-			allocations[receiver] += alloc
+			weightBasis = uint64(len(weights))
+		}
+		shares, dust := a.opts.split(amounts[0], weights, weightBasis, currentID, splitReceivers)
+		for i, share := range shares {
+			if err := a.credit(tilt.Receivers[i], a.contribution(RuleCurator, 0, amounts[0], weights[i], weightBasis, share)); err != nil {
+				return 0, err
+			}
+		}
+		if err := a.credit(a.opts.Treasury, a.contribution(RuleRounding, 0, 0, 0, 0, dust)); err != nil {
+			return 0, err
 		}
 	}
 
-	// Distribute to subtilts recursively
-	for i, subtiltID := range subtilts {
-		subAmount := amounts[i+1]
-		subtiltKey := strconv.Itoa(subtiltID) // Convert int ID to string key
-		if err := allocateRecursive(tiltData, subtiltKey, subAmount, allocations); err != nil {
-			return err
+	// Distribute to subtilts recursively; a subtilt's own amount adds to the total
+	distributed := totalAmount - sum(amounts[1:])
+	for i, subtiltID := range tilt.Subtilts {
+		rounding := amounts[i+1] - floorShare(curatorShare, tilt.BusinessRules[i+1], basis)
+		sub, err := a.allocate(subtiltID, i+1, amounts[i+1], rounding)
+		if err != nil {
+			return 0, err
+		}
+		distributed, carry = bits.Add64(distributed, sub, 0)
+		if carry != 0 {
+			return 0, fmt.Errorf("tilt %d: %w", currentID, ErrOverflow)
 		}
 	}
+	return distributed, nil
+}
+
+// contribution describes amount as the share of split paid under rule by the
+// current tilt; a zero basis marks an amount that is not a share, like dust
+func (a *allocator) contribution(rule Rule, ruleIndex int, split, share, basis, amount uint64) Contribution {
+	c := Contribution{Tilt: a.path[len(a.path)-1], Rule: rule, RuleIndex: ruleIndex, Share: share, Basis: basis, Amount: amount}
+	if a.trace != nil {
+		c.Path = append([]int(nil), a.path...)
+		if basis > 0 {
+			c.Rounding = amount - floorShare(split, share, basis)
+		}
+	}
+	return c
+}
 
+// credit adds c.Amount to a receiver's allocation under c.Rule, recording c when tracing
+func (a *allocator) credit(receiver string, c Contribution) error {
+	rule, amount := c.Rule, c.Amount
+	if amount == 0 {
+		return nil
+	}
+	total, carry := bits.Add64(a.totals[receiver], amount, 0)
+	if carry != 0 {
+		return fmt.Errorf("receiver %s: %w", receiver, ErrOverflow)
+	}
+	a.totals[receiver] = total
+
+	if a.credits[receiver] == nil {
+		a.credits[receiver] = make(map[Rule]uint64)
+	}
+	a.credits[receiver][rule] += amount
+	if a.trace != nil {
+		a.trace.Contributions[receiver] = append(a.trace.Contributions[receiver], c)
+	}
 	return nil
 }
+
+// sum adds shares of one split, which never exceed the amount split
+func sum(shares []uint64) uint64 {
+	var total uint64
+	for _, s := range shares {
+		total += s
+	}
+	return total
+}
@@ -0,0 +1,225 @@
+package distribution
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tilt-valid/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// payouts maps receivers to amounts, dropping the rule attribution
+func payouts(allocations []Allocation) map[string]uint64 {
+	result := make(map[string]uint64)
+	for _, a := range allocations {
+		result[a.Receiver] = a.Amount
+	}
+	return result
+}
+
+func TestLoadTiltsFromCreateTiltCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tiltdb.csv")
+	_, err := utils.CreateTilt(path, 2, []string{"c", "d"}, []int{100}, nil, 0)
+	require.NoError(t, err)
+	_, err = utils.CreateTilt(path, 1, []string{"a", "b"}, []int{80, 20}, []int{2}, 100)
+	require.NoError(t, err)
+
+	tilts, err := LoadTilts(path)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, tilts.IDs())
+	assert.Equal(t, &Tilt{ID: 1, Receivers: []string{"a", "b"}, BusinessRules: []uint64{80, 20}, Subtilts: []int{2}, Amount: 100}, tilts[1])
+	assert.Nil(t, tilts[2].Subtilts)
+
+	allocations, err := AllocateAmounts(tilts, 1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"a": 40, "b": 40, "c": 10, "d": 10}, payouts(allocations))
+}
+
+func TestLoadTiltsJSON(t *testing.T) {
+	// Numbers decoded from JSON used to arrive as float64 and panic the allocator
+	const asArray = `[
+		{"id": 1, "receiver": ["a"], "business_rules": [20, 70, 10], "subtilt": [3, 2], "amount": 100},
+		{"id": 2, "receiver": ["b"], "business_rules": [100], "amount": 0},
+		{"id": 3, "receiver": ["c"], "business_rules": [100], "subtilt": [], "amount": 0}
+	]`
+	const asObject = `{
+		"1": {"receiver": ["a"], "business_rules": [20, 70, 10], "subtilt": [3, 2], "amount": 100},
+		"2": {"receiver": ["b"], "business_rules": [100], "amount": 0},
+		"3": {"id": 3, "receiver": ["c"], "business_rules": [100], "amount": 0}
+	}`
+
+	for name, doc := range map[string]string{"array": asArray, "object": asObject} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tilts.json")
+			require.NoError(t, os.WriteFile(path, []byte(doc), 0644))
+
+			tilts, err := LoadTilts(path)
+			require.NoError(t, err)
+			allocations, err := AllocateAmounts(tilts, 1)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]uint64{"a": 20, "b": 10, "c": 70}, payouts(allocations))
+		})
+	}
+}
+
+func TestParseTiltsErrors(t *testing.T) {
+	_, err := ParseTiltsCSV(strings.NewReader("1,a,[100],null,10\n1,b,[100],null,10\n"))
+	assert.EqualError(t, err, "line 2: duplicate tilt ID 1")
+
+	_, err = ParseTiltsCSV(strings.NewReader("1,a,[100],null,ten\n"))
+	assert.EqualError(t, err, `line 1: tilt 1: invalid amount "ten"`)
+
+	_, err = ParseTiltsJSON(strings.NewReader(`[{"id": 1, "amount": 1.5}]`))
+	assert.ErrorContains(t, err, "failed to parse tilt JSON")
+
+	_, err = ParseTiltsJSON(strings.NewReader(`{"1": {"id": 2}}`))
+	assert.EqualError(t, err, `tilt stored under "1" has ID 2`)
+}
+
+func TestAllocateAmountsRejectsInvalidGraph(t *testing.T) {
+	tilts := Tilts{
+		1: {ID: 1, Receivers: []string{"a"}, BusinessRules: []uint64{50, 50}, Subtilts: []int{9}, Amount: 10},
+		2: {ID: 2, Receivers: []string{"a"}, BusinessRules: []uint64{90}, Amount: 10},
+	}
+
+	_, err := AllocateAmounts(tilts, 1)
+	assert.EqualError(t, err, "tilt graph rooted at 1 has 1 problem(s): tilt 1: subtilt 9 not found in data")
+
+	_, err = AllocateAmounts(tilts, 2)
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []Problem{{2, "business rules must sum to 100, got 90"}}, invalid.Problems)
+
+	_, err = AllocateAmounts(tilts, 7)
+	assert.EqualError(t, err, "tilt graph rooted at 7 has 1 problem(s): tilt 7: not found in data")
+}
+
+func TestBasisPointsSumExactly(t *testing.T) {
+	tilts := Tilts{
+		1: {ID: 1, Receivers: []string{"a", "b", "c"}, BusinessRules: []uint64{3333, 3333, 3334}, Subtilts: []int{2, 3}, Amount: 1_000_000_001, Basis: BasisPoints},
+		2: {ID: 2, Receivers: []string{"d", "e", "f"}, BusinessRules: []uint64{10000}, Basis: BasisPoints},
+		// Percent and basis-point tilts can be mixed
+		3: {ID: 3, Receivers: []string{"g", "h", "i"}, BusinessRules: []uint64{100}, Amount: 5},
+	}
+
+	allocations, err := AllocateAmounts(tilts, 1)
+	require.NoError(t, err)
+	total, err := Total(allocations)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1_000_000_006), total)
+	assert.Equal(t, map[string]uint64{
+		"a": 111_100_000, "b": 111_100_000, "c": 111_100_000,
+		"d": 111_100_000, "e": 111_100_000, "f": 111_100_000,
+		// 333_400_001 forwarded plus 5 held locally
+		"g": 111_133_336, "h": 111_133_335, "i": 111_133_335,
+	}, payouts(allocations))
+}
+
+func TestAllocateAmountsOverflow(t *testing.T) {
+	// Splitting the largest amount must not overflow the intermediate product
+	tilts := Tilts{
+		1: {ID: 1, Receivers: []string{"a"}, BusinessRules: []uint64{1, 9999}, Subtilts: []int{2}, Amount: math.MaxUint64, Basis: BasisPoints},
+		2: {ID: 2, Receivers: []string{"b"}, BusinessRules: []uint64{100}},
+	}
+	allocations, err := AllocateAmounts(tilts, 1)
+	require.NoError(t, err)
+	total, err := Total(allocations)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), total)
+
+	tilts[2].Amount = 1
+	_, err = AllocateAmounts(tilts, 1)
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestFeeTiersAttributed(t *testing.T) {
+	fees := &Fees{Protocol: 200, ProtocolReceiver: "protocol", Publisher: 1000, PublisherReceiver: "publisher"}
+	tilts := Tilts{
+		1: {ID: 1, Receivers: []string{"curator"}, BusinessRules: []uint64{5000, 5000}, Subtilts: []int{2}, Amount: 1_000_000, Basis: BasisPoints, Fees: fees},
+		2: {ID: 2, Receivers: []string{"curator", "sub"}, BusinessRules: []uint64{10000}, Basis: BasisPoints, Fees: fees},
+	}
+
+	d, err := Distribute(tilts, 1, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1_000_000), d.Total)
+	// Tilt 1 pays 2% and 10% off the top, then splits 880_000 evenly with tilt 2,
+	// which pays its own fees on the 440_000 it receives
+	assert.Equal(t, []Allocation{
+		{Receiver: "curator", Amount: 440_000 + 193_600, ByRule: map[Rule]uint64{RuleCurator: 440_000 + 193_600}},
+		{Receiver: "protocol", Amount: 20_000 + 8_800, ByRule: map[Rule]uint64{RuleProtocol: 20_000 + 8_800}},
+		{Receiver: "publisher", Amount: 100_000 + 44_000, ByRule: map[Rule]uint64{RulePublisher: 100_000 + 44_000}},
+		{Receiver: "sub", Amount: 193_600, ByRule: map[Rule]uint64{RuleCurator: 193_600}},
+	}, d.Allocations)
+
+	// The same receiver can be paid under several rules
+	tilts[2].Fees = &Fees{Protocol: 10000, ProtocolReceiver: "curator"}
+	d, err = Distribute(tilts, 1, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, Allocation{Receiver: "curator", Amount: 880_000, ByRule: map[Rule]uint64{RuleCurator: 440_000, RuleProtocol: 440_000}}, d.Allocations[0])
+
+	tilts[2].Fees = &Fees{Protocol: 6000, Publisher: 5000, PublisherReceiver: "publisher"}
+	var invalid *ValidationError
+	_, err = Distribute(tilts, 1, Options{})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []Problem{
+		{2, "fees of 6000 and 5000 exceed basis 10000"},
+		{2, "protocol fee has no receiver"},
+	}, invalid.Problems)
+}
+
+func TestMinPayoutCarriesDustForward(t *testing.T) {
+	tilts := Tilts{
+		1: {ID: 1, Receivers: []string{"a", "b", "c"}, BusinessRules: []uint64{100}, Amount: 1_000,
+			Fees: &Fees{Protocol: 1, ProtocolReceiver: "protocol"}},
+	}
+
+	first, err := Distribute(tilts, 1, Options{MinPayout: 50})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"a": 330, "b": 330, "c": 330}, payouts(first.Allocations))
+	assert.Equal(t, map[string]uint64{"protocol": 10}, first.CarryForward)
+
+	// Dust accumulates until it reaches the threshold
+	var d *Distribution = first
+	for run := 2; run <= 5; run++ {
+		d, err = Distribute(tilts, 1, Options{MinPayout: 50, Carried: d.CarryForward})
+		require.NoError(t, err)
+		paid, err := Total(d.Allocations)
+		require.NoError(t, err)
+		var carried uint64
+		for _, v := range d.CarryForward {
+			carried += v
+		}
+		assert.Equal(t, d.Total, paid+carried, "run %d", run)
+	}
+	assert.Empty(t, d.CarryForward)
+	assert.Equal(t, map[Rule]uint64{RuleProtocol: 10, RuleCarried: 40}, d.Allocations[3].ByRule)
+}
+
+func TestWeightedReceivers(t *testing.T) {
+	tilts, err := ParseTiltsCSV(strings.NewReader(
+		"1,a;b,[100],null,1001,,\"[70,30]\"\n" +
+			"2,a;b;c,[10000],null,7,10000,\"[5000,2500,2500]\"\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{70, 30}, tilts[1].ReceiverWeights)
+
+	allocations, err := AllocateAmounts(tilts, 1)
+	require.NoError(t, err)
+	// 700.7 and 300.3: the leftover unit goes to the larger fraction
+	assert.Equal(t, map[string]uint64{"a": 701, "b": 300}, payouts(allocations))
+
+	allocations, err = AllocateAmounts(tilts, 2)
+	require.NoError(t, err)
+	// 3.5, 1.75 and 1.75: the two leftover units go to the .75 fractions
+	assert.Equal(t, map[string]uint64{"a": 3, "b": 2, "c": 2}, payouts(allocations))
+
+	tilts[1].ReceiverWeights = []uint64{70, 20, 20}
+	assert.Equal(t, []Problem{
+		{1, "receiver weights length (3) must match receivers length (2)"},
+		{1, "receiver weights must sum to 100, got 110"},
+	}, problems(t, tilts, 1))
+}
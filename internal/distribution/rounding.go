@@ -0,0 +1,136 @@
+package distribution
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// Rounding selects who receives the units left over when a split does not divide evenly
+type Rounding int
+
+const (
+	// LargestRemainder gives leftover units to the largest fractional parts, ties to the lower index
+	LargestRemainder Rounding = iota
+	// RoundToTreasury rounds every share down and pays all leftover units to Options.Treasury
+	RoundToTreasury
+	// SeededRandom gives leftover units to shares picked pseudo-randomly from Options.Seed
+	SeededRandom
+	// BankersRounding rounds every share half to even and settles the difference by largest remainder
+	BankersRounding
+)
+
+func (r Rounding) String() string {
+	switch r {
+	case LargestRemainder:
+		return "largest-remainder"
+	case RoundToTreasury:
+		return "treasury"
+	case SeededRandom:
+		return "seeded-random"
+	case BankersRounding:
+		return "bankers"
+	default:
+		return fmt.Sprintf("rounding(%d)", int(r))
+	}
+}
+
+// ParseRounding parses the name returned by Rounding.String
+func ParseRounding(name string) (Rounding, error) {
+	for _, r := range []Rounding{LargestRemainder, RoundToTreasury, SeededRandom, BankersRounding} {
+		if r.String() == name {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown rounding policy %q", name)
+}
+
+// split divides total in proportion to weights, which must sum to basis. It
+// returns the shares and the dust owed to the treasury; shares plus dust
+// always equal total. tilt and kind identify the split for SeededRandom.
+func (o Options) split(total uint64, weights []uint64, basis uint64, tilt int, kind uint8) ([]uint64, uint64) {
+	shares := make([]uint64, len(weights))
+	remainders := make([]uint64, len(weights))
+	var allocated uint64
+	for i, w := range weights {
+		// total*w needs 128 bits; the quotient fits because w <= basis
+		hi, lo := bits.Mul64(total, w)
+		shares[i], remainders[i] = bits.Div64(hi, lo, basis)
+		allocated += shares[i]
+	}
+	// Fewer than len(weights) units are left, and more shares than that have a
+	// non-zero remainder, so a zero-weight share is never rounded up
+	leftover := total - allocated
+
+	switch o.Rounding {
+	case RoundToTreasury:
+		return shares, leftover
+	case SeededRandom:
+		rank := make([][32]byte, len(weights))
+		for i := range rank {
+			h := sha256.New()
+			h.Write(o.Seed)
+			binary.Write(h, binary.BigEndian, int64(tilt))
+			h.Write([]byte{kind})
+			binary.Write(h, binary.BigEndian, uint32(i))
+			h.Sum(rank[i][:0])
+		}
+		order := byRemainder(remainders)
+		// Only shares with a fractional part are candidates
+		candidates := order[:0:0]
+		for _, i := range order {
+			if remainders[i] > 0 {
+				candidates = append(candidates, i)
+			}
+		}
+		sort.Slice(candidates, func(a, b int) bool {
+			return string(rank[candidates[a]][:]) < string(rank[candidates[b]][:])
+		})
+		for _, i := range candidates[:leftover] {
+			shares[i]++
+		}
+	case BankersRounding:
+		roundedUp := make([]bool, len(weights))
+		var up uint64
+		for i, r := range remainders {
+			if 2*r > basis || (2*r == basis && shares[i]%2 == 1) {
+				roundedUp[i] = true
+				shares[i]++
+				up++
+			}
+		}
+		order := byRemainder(remainders)
+		for _, i := range order {
+			if up < leftover && !roundedUp[i] && remainders[i] > 0 {
+				shares[i]++
+				up++
+			}
+		}
+		// Too many rounded up: undo the ones closest to rounding down
+		for j := len(order) - 1; j >= 0 && up > leftover; j-- {
+			if i := order[j]; roundedUp[i] {
+				shares[i]--
+				up--
+			}
+		}
+	default:
+		for _, i := range byRemainder(remainders)[:leftover] {
+			shares[i]++
+		}
+	}
+	return shares, 0
+}
+
+// byRemainder orders indices by descending remainder, ties to the lower index
+func byRemainder(remainders []uint64) []int {
+	order := make([]int, len(remainders))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	return order
+}
@@ -0,0 +1,160 @@
+package distribution
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var policies = []Options{
+	{Rounding: LargestRemainder},
+	{Rounding: RoundToTreasury, Treasury: "treasury"},
+	{Rounding: SeededRandom, Seed: []byte("epoch-42")},
+	{Rounding: BankersRounding},
+}
+
+func TestSplitPolicies(t *testing.T) {
+	thirds := []uint64{1, 1, 1}
+
+	shares, dust := Options{}.split(10, thirds, 3, 1, splitReceivers)
+	assert.Equal(t, []uint64{4, 3, 3}, shares)
+	assert.Zero(t, dust)
+	// 33.33, 33.33 and 33.34: the leftover unit goes to the largest fraction
+	shares, _ = Options{}.split(100, []uint64{3333, 3333, 3334}, BasisPoints, 1, splitRules)
+	assert.Equal(t, []uint64{33, 33, 34}, shares)
+
+	shares, dust = policies[1].split(10, thirds, 3, 1, splitReceivers)
+	assert.Equal(t, []uint64{3, 3, 3}, shares)
+	assert.Equal(t, uint64(1), dust)
+
+	// 2.5, 3.5 and 4: half rounds to even, so 2 and 4
+	shares, _ = policies[3].split(10, []uint64{25, 35, 40}, PercentBasis, 1, splitRules)
+	assert.Equal(t, []uint64{2, 4, 4}, shares)
+
+	// The seeded draw is repeatable and depends on the seed
+	first, _ := policies[2].split(10, thirds, 3, 1, splitReceivers)
+	again, _ := policies[2].split(10, thirds, 3, 1, splitReceivers)
+	assert.Equal(t, first, again)
+	spread := make(map[string]bool)
+	for epoch := 0; epoch < 20; epoch++ {
+		opts := Options{Rounding: SeededRandom, Seed: []byte(fmt.Sprint("epoch-", epoch))}
+		shares, _ := opts.split(10, thirds, 3, 1, splitReceivers)
+		spread[fmt.Sprint(shares)] = true
+	}
+	assert.Greater(t, len(spread), 1, "the extra unit should not always go to the same receiver")
+}
+
+func TestRoundingOptionsValidated(t *testing.T) {
+	tilts := Tilts{1: {ID: 1, Receivers: []string{"a"}, BusinessRules: []uint64{100}, Amount: 1}}
+
+	_, err := AllocateAmountsWithOptions(tilts, 1, Options{Rounding: RoundToTreasury})
+	assert.EqualError(t, err, "treasury rounding needs a treasury receiver")
+	_, err = AllocateAmountsWithOptions(tilts, 1, Options{Rounding: SeededRandom})
+	assert.EqualError(t, err, "seeded-random rounding needs a seed")
+
+	for _, opts := range policies {
+		r, err := ParseRounding(opts.Rounding.String())
+		require.NoError(t, err)
+		assert.Equal(t, opts.Rounding, r)
+	}
+	_, err = ParseRounding("nearest")
+	assert.Error(t, err)
+}
+
+// randomTree builds a valid tilt tree with random rules, receivers and amounts
+func randomTree(rng *rand.Rand) (Tilts, uint64) {
+	tilts := make(Tilts)
+	var total uint64
+	next := 1
+	var build func(depth int) int
+	build = func(depth int) int {
+		id := next
+		next++
+		tilt := &Tilt{ID: id, Basis: PercentBasis}
+		if rng.Intn(2) == 0 {
+			tilt.Basis = BasisPoints
+		}
+		if rng.Intn(3) > 0 {
+			tilt.Amount = uint64(rng.Int63n(1_000_000_007))
+		}
+		total += tilt.Amount
+		if rng.Intn(3) == 0 {
+			tilt.Fees = &Fees{
+				Protocol:          uint64(rng.Int63n(int64(tilt.Basis) / 10)),
+				ProtocolReceiver:  "protocol",
+				Publisher:         uint64(rng.Int63n(int64(tilt.Basis) / 5)),
+				PublisherReceiver: fmt.Sprintf("r%d", rng.Intn(12)),
+			}
+		}
+
+		children := 0
+		if depth < 3 {
+			children = rng.Intn(4)
+		}
+		for i := 0; i < children; i++ {
+			tilt.Subtilts = append(tilt.Subtilts, build(depth+1))
+		}
+
+		// Random cut points give rules summing exactly to the basis
+		remaining := tilt.Basis
+		tilt.BusinessRules = make([]uint64, children+1)
+		for i := 1; i <= children; i++ {
+			share := uint64(rng.Int63n(int64(remaining) + 1))
+			tilt.BusinessRules[i] = share
+			remaining -= share
+		}
+		tilt.BusinessRules[0] = remaining
+		if remaining > 0 || rng.Intn(2) == 0 {
+			for i := rng.Intn(5); i >= 0; i-- {
+				tilt.Receivers = append(tilt.Receivers, fmt.Sprintf("r%d", rng.Intn(12)))
+			}
+			if rng.Intn(2) == 0 {
+				left := tilt.Basis
+				tilt.ReceiverWeights = make([]uint64, len(tilt.Receivers))
+				for i := 1; i < len(tilt.Receivers); i++ {
+					tilt.ReceiverWeights[i] = uint64(rng.Int63n(int64(left) + 1))
+					left -= tilt.ReceiverWeights[i]
+				}
+				tilt.ReceiverWeights[0] = left
+			}
+		}
+
+		tilts[id] = tilt
+		return id
+	}
+	build(0)
+	return tilts, total
+}
+
+func TestRoundingConservesValue(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		tilts, expected := randomTree(rng)
+		for _, opts := range policies {
+			allocations, err := AllocateAmountsWithOptions(tilts, 1, opts)
+			require.NoError(t, err, "tree %d, %s", i, opts.Rounding)
+
+			total, err := Total(allocations)
+			require.NoError(t, err)
+			require.Equal(t, expected, total, "tree %d, %s", i, opts.Rounding)
+		}
+	}
+}
+
+func TestRoundingConservesLargeAmounts(t *testing.T) {
+	tilts := Tilts{
+		1: {ID: 1, Receivers: []string{"a", "b", "c"}, BusinessRules: []uint64{3333, 6667}, Subtilts: []int{2}, Amount: math.MaxUint64 - 7, Basis: BasisPoints},
+		2: {ID: 2, Receivers: []string{"d", "e", "f", "g", "h", "i", "j"}, BusinessRules: []uint64{100}, Amount: 7},
+	}
+	for _, opts := range policies {
+		allocations, err := AllocateAmountsWithOptions(tilts, 1, opts)
+		require.NoError(t, err, opts.Rounding.String())
+		total, err := Total(allocations)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(math.MaxUint64), total, opts.Rounding.String())
+	}
+}
@@ -0,0 +1,207 @@
+package distribution
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported denominators for business rules
+const (
+	// PercentBasis rules sum to 100; it is the default
+	PercentBasis uint64 = 100
+	// BasisPoints rules sum to 10000
+	BasisPoints uint64 = 10000
+)
+
+// Tilt is one node of the distribution graph. Fees are taken off the top of
+// the tilt's total; BusinessRules then split the rest, the curator share,
+// with BusinessRules[0] kept for the local receivers (the curators) and
+// BusinessRules[i+1] forwarded to Subtilts[i]. The local share is split
+// between Receivers by ReceiverWeights, or equally when there are none. All
+// shares are out of Basis. Amount is in base units of Asset: lamports for
+// native SOL or the smallest unit of an SPL token. A tilt without an Asset
+// pays its parent's, and a root tilt without one pays native SOL.
+type Tilt struct {
+	ID              int      `json:"id"`
+	Receivers       []string `json:"receiver"`
+	ReceiverWeights []uint64 `json:"receiver_weights,omitempty"`
+	BusinessRules   []uint64 `json:"business_rules"`
+	Subtilts        []int    `json:"subtilt"`
+	Amount          uint64   `json:"amount"`
+	Basis           uint64   `json:"basis,omitempty"`
+	Fees            *Fees    `json:"fees,omitempty"`
+	Asset           Asset    `json:"asset,omitempty"`
+}
+
+// Fees are the protocol and publisher tiers of a tilt, out of the tilt's basis
+type Fees struct {
+	Protocol          uint64 `json:"protocol"`
+	ProtocolReceiver  string `json:"protocol_receiver"`
+	Publisher         uint64 `json:"publisher"`
+	PublisherReceiver string `json:"publisher_receiver"`
+}
+
+// RulesBasis returns what the business rules must sum to
+func (t *Tilt) RulesBasis() uint64 {
+	if t.Basis == 0 {
+		return PercentBasis
+	}
+	return t.Basis
+}
+
+// Tilts indexes a tilt graph by tilt ID
+type Tilts map[int]*Tilt
+
+// Add inserts a tilt, rejecting duplicate IDs
+func (t Tilts) Add(tilt *Tilt) error {
+	if _, ok := t[tilt.ID]; ok {
+		return fmt.Errorf("duplicate tilt ID %d", tilt.ID)
+	}
+	t[tilt.ID] = tilt
+	return nil
+}
+
+// IDs returns the tilt IDs in ascending order
+func (t Tilts) IDs() []int {
+	ids := make([]int, 0, len(t))
+	for id := range t {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// LoadTilts reads a tilt graph from a .json file or from the CSV format
+// written by utils.CreateTilt
+func LoadTilts(path string) (Tilts, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tilt file: %w", err)
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ParseTiltsJSON(file)
+	}
+	return ParseTiltsCSV(file)
+}
+
+// ParseTiltsCSV parses
+// "id,receivers,business_rules,subtilt,amount[,basis[,receiver_weights[,asset]]]"
+// records, where receivers are separated by ";" and rules, subtilts and
+// weights are JSON arrays
+func ParseTiltsCSV(r io.Reader) (Tilts, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tilt CSV: %w", err)
+	}
+
+	tilts := make(Tilts)
+	for i, record := range records {
+		if len(record) < 5 || len(record) > 8 {
+			return nil, fmt.Errorf("line %d: expected 5 to 8 columns, got %d", i+1, len(record))
+		}
+		tilt, err := parseTiltRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if err := tilts.Add(tilt); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	return tilts, nil
+}
+
+func parseTiltRecord(record []string) (*Tilt, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(record[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid tilt ID %q", record[0])
+	}
+
+	tilt := &Tilt{ID: id}
+	for _, receiver := range strings.Split(record[1], ";") {
+		if receiver = strings.TrimSpace(receiver); receiver != "" {
+			tilt.Receivers = append(tilt.Receivers, receiver)
+		}
+	}
+	if err := json.Unmarshal([]byte(record[2]), &tilt.BusinessRules); err != nil {
+		return nil, fmt.Errorf("tilt %d: invalid business rules %q: %v", id, record[2], err)
+	}
+	// CreateTilt writes a nil subtilt list as "null", which unmarshals to nil
+	if err := json.Unmarshal([]byte(record[3]), &tilt.Subtilts); err != nil {
+		return nil, fmt.Errorf("tilt %d: invalid subtilts %q: %v", id, record[3], err)
+	}
+	tilt.Amount, err = strconv.ParseUint(strings.TrimSpace(record[4]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("tilt %d: invalid amount %q", id, record[4])
+	}
+	if len(record) > 5 && strings.TrimSpace(record[5]) != "" {
+		tilt.Basis, err = strconv.ParseUint(strings.TrimSpace(record[5]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("tilt %d: invalid basis %q", id, record[5])
+		}
+	}
+	if len(record) > 6 && strings.TrimSpace(record[6]) != "" {
+		if err := json.Unmarshal([]byte(record[6]), &tilt.ReceiverWeights); err != nil {
+			return nil, fmt.Errorf("tilt %d: invalid receiver weights %q: %v", id, record[6], err)
+		}
+	}
+	if len(record) > 7 {
+		tilt.Asset = Asset(strings.TrimSpace(record[7]))
+	}
+	return tilt, nil
+}
+
+// ParseTiltsJSON parses either an array of tilts or an object keyed by tilt ID
+func ParseTiltsJSON(r io.Reader) (Tilts, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tilt JSON: %w", err)
+	}
+
+	var list []*Tilt
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var byID map[string]*Tilt
+		if err := json.Unmarshal(data, &byID); err != nil {
+			return nil, fmt.Errorf("failed to parse tilt JSON: %v", err)
+		}
+		for key, tilt := range byID {
+			id, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tilt ID %q", key)
+			}
+			if tilt == nil {
+				return nil, fmt.Errorf("tilt %d: empty definition", id)
+			}
+			if tilt.ID == 0 {
+				tilt.ID = id
+			} else if tilt.ID != id {
+				return nil, fmt.Errorf("tilt stored under %q has ID %d", key, tilt.ID)
+			}
+			list = append(list, tilt)
+		}
+	} else if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse tilt JSON: %v", err)
+	}
+
+	tilts := make(Tilts)
+	for i, tilt := range list {
+		if tilt == nil {
+			return nil, fmt.Errorf("entry %d: empty tilt definition", i)
+		}
+		if err := tilts.Add(tilt); err != nil {
+			return nil, err
+		}
+	}
+	return tilts, nil
+}
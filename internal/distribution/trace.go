@@ -0,0 +1,182 @@
+package distribution
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// Contribution is one amount paid to a receiver and how it was computed
+type Contribution struct {
+	// Tilt produced the amount; Path runs from the root tilt to it and is
+	// empty for amounts carried in from an earlier distribution
+	Tilt int   `json:"tilt"`
+	Path []int `json:"path"`
+	Rule Rule  `json:"rule"`
+	// RuleIndex is the fee tier (0 protocol, 1 publisher) for fees, otherwise
+	// the business rule that produced the amount
+	RuleIndex int `json:"rule_index"`
+	// Share out of Basis is the fraction of the split that was paid
+	Share  uint64 `json:"share"`
+	Basis  uint64 `json:"basis"`
+	Amount uint64 `json:"amount"`
+	// Rounding is the number of units added to the rounded-down share
+	Rounding uint64 `json:"rounding"`
+}
+
+// TraceNode summarizes how a tilt's total was made up and what it kept locally
+type TraceNode struct {
+	Tilt int   `json:"tilt"`
+	Path []int `json:"path"`
+	// RuleIndex is the parent's business rule that forwarded Received
+	RuleIndex int    `json:"rule_index"`
+	Own       uint64 `json:"own"`
+	Received  uint64 `json:"received"`
+	// ReceivedRounding is the number of units rounding added to Received in the parent's split
+	ReceivedRounding uint64 `json:"received_rounding"`
+	Total            uint64 `json:"total"`
+	// Local is the curator share kept for the tilt's receivers
+	Local         uint64 `json:"local"`
+	LocalRounding uint64 `json:"local_rounding"`
+}
+
+// Trace explains a distribution: every tilt visited, in order, and every
+// contribution to every receiver
+type Trace struct {
+	Nodes         []TraceNode               `json:"nodes"`
+	Contributions map[string][]Contribution `json:"contributions"`
+}
+
+func newTrace() *Trace {
+	return &Trace{Contributions: make(map[string][]Contribution)}
+}
+
+// WriteTree renders the trace as the tilt tree with each tilt's payouts
+func (t *Trace) WriteTree(w io.Writer) error {
+	byTilt := make(map[int][]payout)
+	var carried []payout
+	for receiver, contributions := range t.Contributions {
+		for _, c := range contributions {
+			if c.Rule == RuleCarried {
+				carried = append(carried, payout{receiver, c})
+				continue
+			}
+			byTilt[c.Tilt] = append(byTilt[c.Tilt], payout{receiver, c})
+		}
+	}
+	children := make(map[int][]TraceNode)
+	var roots []TraceNode
+	for _, node := range t.Nodes {
+		if len(node.Path) < 2 {
+			roots = append(roots, node)
+			continue
+		}
+		parent := node.Path[len(node.Path)-2]
+		children[parent] = append(children[parent], node)
+	}
+
+	tw := &treeWriter{w: w, byTilt: byTilt, children: children}
+	for _, root := range roots {
+		tw.line("", "", tw.nodeLabel(root))
+		tw.node(root, "")
+	}
+	if len(carried) > 0 {
+		tw.line("", "", "carried forward")
+		tw.payouts(carried, "", true)
+	}
+	return tw.err
+}
+
+type payout struct {
+	receiver string
+	Contribution
+}
+
+type treeWriter struct {
+	w        io.Writer
+	byTilt   map[int][]payout
+	children map[int][]TraceNode
+	err      error
+}
+
+func (tw *treeWriter) line(prefix, branch, text string) {
+	if tw.err == nil {
+		_, tw.err = fmt.Fprintf(tw.w, "%s%s%s\n", prefix, branch, text)
+	}
+}
+
+func (tw *treeWriter) node(node TraceNode, prefix string) {
+	kids := tw.children[node.Tilt]
+	tw.payouts(tw.byTilt[node.Tilt], prefix, len(kids) == 0)
+	for i, child := range kids {
+		branch, indent := "├── ", "│   "
+		if i == len(kids)-1 {
+			branch, indent = "└── ", "    "
+		}
+		tw.line(prefix, branch, tw.nodeLabel(child))
+		tw.node(child, prefix+indent)
+	}
+}
+
+func (tw *treeWriter) payouts(payouts []payout, prefix string, last bool) {
+	sort.SliceStable(payouts, func(i, j int) bool {
+		a, b := payouts[i], payouts[j]
+		if ruleRank(a.Rule) != ruleRank(b.Rule) {
+			return ruleRank(a.Rule) < ruleRank(b.Rule)
+		}
+		if a.RuleIndex != b.RuleIndex {
+			return a.RuleIndex < b.RuleIndex
+		}
+		return a.receiver < b.receiver
+	})
+	for i, p := range payouts {
+		branch := "├── "
+		if last && i == len(payouts)-1 {
+			branch = "└── "
+		}
+		text := fmt.Sprintf("%s %s: %d", p.Rule, p.receiver, p.Amount)
+		if p.Basis > 0 {
+			text += fmt.Sprintf(" (%d/%d", p.Share, p.Basis)
+			if p.Rounding > 0 {
+				text += fmt.Sprintf(", +%d rounding", p.Rounding)
+			}
+			text += ")"
+		}
+		tw.line(prefix, branch, text)
+	}
+}
+
+func (tw *treeWriter) nodeLabel(node TraceNode) string {
+	var parts []string
+	parts = append(parts, fmt.Sprintf("own %d", node.Own))
+	if len(node.Path) > 1 {
+		received := fmt.Sprintf("received %d via rule %d", node.Received, node.RuleIndex)
+		if node.ReceivedRounding > 0 {
+			received += fmt.Sprintf(" (+%d rounding)", node.ReceivedRounding)
+		}
+		parts = append(parts, received)
+	}
+	local := fmt.Sprintf("local %d", node.Local)
+	if node.LocalRounding > 0 {
+		local += fmt.Sprintf(" (+%d rounding)", node.LocalRounding)
+	}
+	return fmt.Sprintf("tilt %d: %s = %d, %s", node.Tilt, strings.Join(parts, " + "), node.Total, local)
+}
+
+func ruleRank(r Rule) int {
+	for i, rule := range []Rule{RuleProtocol, RulePublisher, RuleCurator, RuleRounding, RuleCarried} {
+		if r == rule {
+			return i
+		}
+	}
+	return len(r)
+}
+
+// floorShare is total*share/basis rounded down
+func floorShare(total, share, basis uint64) uint64 {
+	hi, lo := bits.Mul64(total, share)
+	q, _ := bits.Div64(hi, lo, basis)
+	return q
+}
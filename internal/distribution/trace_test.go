@@ -0,0 +1,84 @@
+package distribution
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceExplainsEveryUnit(t *testing.T) {
+	tilts := Tilts{
+		1: {ID: 1, Receivers: []string{"a", "b", "c"}, BusinessRules: []uint64{50, 50}, Subtilts: []int{2}, Amount: 101,
+			Fees: &Fees{Protocol: 1, ProtocolReceiver: "protocol"}},
+		2: {ID: 2, Receivers: []string{"a", "d"}, BusinessRules: []uint64{100}, Amount: 1},
+	}
+
+	d, err := Distribute(tilts, 1, Options{Carried: map[string]uint64{"d": 3}, Trace: true})
+	require.NoError(t, err)
+
+	// 101 pays a 1.01 protocol fee, rounded to 1, and splits 100 evenly
+	assert.Equal(t, []TraceNode{
+		{Tilt: 1, Path: []int{1}, Own: 101, Total: 101, Local: 50},
+		{Tilt: 2, Path: []int{1, 2}, RuleIndex: 1, Own: 1, Received: 50, Total: 51, Local: 51},
+	}, d.Trace.Nodes)
+	assert.Equal(t, []Contribution{
+		{Tilt: 1, Path: []int{1}, Rule: RuleCurator, Share: 1, Basis: 3, Amount: 17, Rounding: 1},
+		{Tilt: 2, Path: []int{1, 2}, Rule: RuleCurator, Share: 1, Basis: 2, Amount: 26, Rounding: 1},
+	}, d.Trace.Contributions["a"])
+	assert.Equal(t, []Contribution{
+		{Tilt: 2, Path: []int{1, 2}, Rule: RuleCurator, Share: 1, Basis: 2, Amount: 25},
+		{Rule: RuleCarried, Amount: 3},
+	}, d.Trace.Contributions["d"])
+
+	var tree strings.Builder
+	require.NoError(t, d.Trace.WriteTree(&tree))
+	assert.Equal(t, `tilt 1: own 101 = 101, local 50
+├── protocol protocol: 1 (1/100)
+├── curator a: 17 (1/3, +1 rounding)
+├── curator b: 17 (1/3, +1 rounding)
+├── curator c: 16 (1/3)
+└── tilt 2: own 1 + received 50 via rule 1 = 51, local 51
+    ├── curator a: 26 (1/2, +1 rounding)
+    └── curator d: 25 (1/2)
+carried forward
+└── carried d: 3
+`, tree.String())
+
+	// The trace survives a JSON round trip
+	encoded, err := json.Marshal(d)
+	require.NoError(t, err)
+	var decoded Distribution
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, d.Trace, decoded.Trace)
+
+	d, err = Distribute(tilts, 1, Options{})
+	require.NoError(t, err)
+	assert.Nil(t, d.Trace)
+}
+
+func TestTraceReconcilesAllocations(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		tilts, _ := randomTree(rng)
+		for _, opts := range policies {
+			opts.Trace = true
+			d, err := Distribute(tilts, 1, opts)
+			require.NoError(t, err, "tree %d, %s", i, opts.Rounding)
+
+			// Every allocation is exactly the sum of its contributions
+			for _, a := range d.Allocations {
+				byRule := make(map[Rule]uint64)
+				for _, c := range d.Trace.Contributions[a.Receiver] {
+					byRule[c.Rule] += c.Amount
+					require.LessOrEqual(t, c.Rounding, uint64(1), "tree %d, %s", i, opts.Rounding)
+				}
+				require.Equal(t, a.ByRule, byRule, "tree %d, %s, receiver %s", i, opts.Rounding, a.Receiver)
+			}
+			require.Len(t, d.Trace.Nodes, len(tilts))
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package distribution
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Problem is one defect found in a tilt graph
+type Problem struct {
+	Tilt    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("tilt %d: %s", p.Tilt, p.Message)
+}
+
+// ValidationError lists every problem found in a tilt graph
+type ValidationError struct {
+	Root     int
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		messages[i] = p.String()
+	}
+	return fmt.Sprintf("tilt graph rooted at %d has %d problem(s): %s", e.Root, len(e.Problems), strings.Join(messages, "; "))
+}
+
+// Validate checks the tilt graph reachable from rootID and returns a
+// *ValidationError listing every problem: missing tilts, cycles, tilts
+// reachable through more than one parent (which would be paid twice), rules
+// or receiver weights that do not match or do not sum to their basis, fees
+// above the basis, local shares or fees with no receivers to pay, unknown
+// assets and subtilts paying a different asset from their parent.
+func Validate(tilts Tilts, rootID int) error {
+	v := &validator{
+		tilts:   tilts,
+		state:   make(map[int]int),
+		parents: make(map[int][]int),
+		assets:  make(map[int]Asset),
+	}
+	if tilt, ok := tilts[rootID]; !ok || tilt == nil {
+		v.add(rootID, "not found in data")
+	} else {
+		v.assets[rootID] = rootAsset(tilt)
+		v.visit(rootID)
+	}
+
+	// A tilt with several parents receives a share from each of them
+	var shared []int
+	for id, parents := range v.parents {
+		if len(parents) > 1 {
+			shared = append(shared, id)
+		}
+	}
+	sort.Ints(shared)
+	for _, id := range shared {
+		v.add(id, fmt.Sprintf("referenced by more than one parent %v", v.parents[id]))
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Root: rootID, Problems: v.problems}
+}
+
+const (
+	unvisited = iota
+	inProgress
+	done
+)
+
+type validator struct {
+	tilts    Tilts
+	state    map[int]int
+	parents  map[int][]int
+	assets   map[int]Asset // tilt ID -> asset paid, inherited when unset
+	path     []int
+	problems []Problem
+}
+
+func (v *validator) add(id int, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Tilt: id, Message: fmt.Sprintf(format, args...)})
+}
+
+// visit checks one tilt and walks its subtilts depth first
+func (v *validator) visit(id int) {
+	v.state[id] = inProgress
+	v.path = append(v.path, id)
+	defer func() {
+		v.path = v.path[:len(v.path)-1]
+		v.state[id] = done
+	}()
+
+	tilt := v.tilts[id]
+	v.checkNode(tilt)
+
+	for _, child := range tilt.Subtilts {
+		if c, ok := v.tilts[child]; !ok || c == nil {
+			v.add(id, "subtilt %d not found in data", child)
+			continue
+		}
+
+		switch v.state[child] {
+		case inProgress:
+			v.add(child, "cycle %s", v.cycle(child))
+		case done:
+			v.parents[child] = append(v.parents[child], id)
+		default:
+			v.parents[child] = append(v.parents[child], id)
+			v.assets[child] = v.assets[id]
+			if asset := v.tilts[child].Asset; asset != "" && asset != v.assets[id] {
+				v.add(child, "pays %s but parent tilt %d pays %s", asset, id, v.assets[id])
+				v.assets[child] = asset
+			}
+			v.visit(child)
+		}
+	}
+}
+
+// checkNode validates a single tilt's own fields
+func (v *validator) checkNode(tilt *Tilt) {
+	if len(tilt.BusinessRules) != len(tilt.Subtilts)+1 {
+		v.add(tilt.ID, "business rules length (%d) must be subtilts length (%d) + 1", len(tilt.BusinessRules), len(tilt.Subtilts))
+	}
+
+	if tilt.Asset != "" {
+		if err := tilt.Asset.check(); err != nil {
+			v.add(tilt.ID, "%v", err)
+		}
+	}
+
+	basis := tilt.RulesBasis()
+	if basis != PercentBasis && basis != BasisPoints {
+		v.add(tilt.ID, "unsupported rules basis %d (want %d or %d)", basis, PercentBasis, BasisPoints)
+		return
+	}
+	v.checkShares(tilt.ID, "business rule", tilt.BusinessRules, basis)
+
+	if len(tilt.BusinessRules) > 0 && tilt.BusinessRules[0] > 0 && len(tilt.Receivers) == 0 {
+		v.add(tilt.ID, "local share of %d/%d has no receivers", tilt.BusinessRules[0], basis)
+	}
+
+	if len(tilt.ReceiverWeights) > 0 {
+		if len(tilt.ReceiverWeights) != len(tilt.Receivers) {
+			v.add(tilt.ID, "receiver weights length (%d) must match receivers length (%d)", len(tilt.ReceiverWeights), len(tilt.Receivers))
+		}
+		v.checkShares(tilt.ID, "receiver weight", tilt.ReceiverWeights, basis)
+	}
+
+	if fees := tilt.Fees; fees != nil {
+		if fees.Protocol > basis || fees.Publisher > basis || fees.Protocol+fees.Publisher > basis {
+			v.add(tilt.ID, "fees of %d and %d exceed basis %d", fees.Protocol, fees.Publisher, basis)
+		}
+		if fees.Protocol > 0 && fees.ProtocolReceiver == "" {
+			v.add(tilt.ID, "protocol fee has no receiver")
+		}
+		if fees.Publisher > 0 && fees.PublisherReceiver == "" {
+			v.add(tilt.ID, "publisher fee has no receiver")
+		}
+	}
+}
+
+// checkShares requires shares to sum to basis
+func (v *validator) checkShares(id int, what string, shares []uint64, basis uint64) {
+	var sum uint64
+	for _, share := range shares {
+		if share > basis {
+			v.add(id, "%s %d exceeds basis %d", what, share, basis)
+			return
+		}
+		sum += share
+	}
+	if sum != basis {
+		v.add(id, "%ss must sum to %d, got %d", what, basis, sum)
+	}
+}
+
+// cycle renders the current path from id back to id
+func (v *validator) cycle(id int) string {
+	start := 0
+	for i, p := range v.path {
+		if p == id {
+			start = i
+			break
+		}
+	}
+	var parts []string
+	for _, p := range v.path[start:] {
+		parts = append(parts, fmt.Sprint(p))
+	}
+	parts = append(parts, fmt.Sprint(id))
+	return strings.Join(parts, " -> ")
+}
@@ -0,0 +1,79 @@
+package distribution
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func problems(t *testing.T, tilts Tilts, root int) []Problem {
+	err := Validate(tilts, root)
+	require.Error(t, err)
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	return invalid.Problems
+}
+
+func TestValidateAcceptsTree(t *testing.T) {
+	tilts := Tilts{
+		1: {ID: 1, Receivers: []string{"a"}, BusinessRules: []uint64{20, 70, 10}, Subtilts: []int{3, 2}, Amount: 100},
+		2: {ID: 2, Receivers: []string{"b"}, BusinessRules: []uint64{100}},
+		// A pure router keeps nothing locally, so it needs no receivers
+		3: {ID: 3, BusinessRules: []uint64{0, 100}, Subtilts: []int{4}},
+		4: {ID: 4, Receivers: []string{"c"}, BusinessRules: []uint64{100}},
+	}
+	assert.NoError(t, Validate(tilts, 1))
+}
+
+func TestValidateDetectsCycles(t *testing.T) {
+	self := Tilts{
+		1: {ID: 1, Receivers: []string{"a"}, BusinessRules: []uint64{50, 50}, Subtilts: []int{1}},
+	}
+	assert.Equal(t, []Problem{{1, "cycle 1 -> 1"}}, problems(t, self, 1))
+
+	loop := Tilts{
+		1: {ID: 1, Receivers: []string{"a"}, BusinessRules: []uint64{50, 50}, Subtilts: []int{2}},
+		2: {ID: 2, Receivers: []string{"b"}, BusinessRules: []uint64{50, 50}, Subtilts: []int{3}},
+		3: {ID: 3, Receivers: []string{"c"}, BusinessRules: []uint64{50, 50}, Subtilts: []int{2}},
+	}
+	assert.Equal(t, []Problem{{2, "cycle 2 -> 3 -> 2"}}, problems(t, loop, 1))
+
+	// Allocation must not recurse forever on a cyclic graph
+	_, err := AllocateAmounts(loop, 1)
+	assert.Error(t, err)
+}
+
+func TestValidateDetectsDiamond(t *testing.T) {
+	tilts := Tilts{
+		1: {ID: 1, Receivers: []string{"a"}, BusinessRules: []uint64{50, 25, 25}, Subtilts: []int{2, 3}},
+		2: {ID: 2, Receivers: []string{"b"}, BusinessRules: []uint64{50, 50}, Subtilts: []int{4}},
+		3: {ID: 3, Receivers: []string{"c"}, BusinessRules: []uint64{50, 50}, Subtilts: []int{4}},
+		4: {ID: 4, Receivers: []string{"d"}, BusinessRules: []uint64{100}},
+	}
+	assert.Equal(t, []Problem{{4, "referenced by more than one parent [2 3]"}}, problems(t, tilts, 1))
+
+	// Listing the same subtilt twice pays it twice as well
+	twice := Tilts{
+		1: {ID: 1, Receivers: []string{"a"}, BusinessRules: []uint64{50, 25, 25}, Subtilts: []int{2, 2}},
+		2: {ID: 2, Receivers: []string{"b"}, BusinessRules: []uint64{100}},
+	}
+	assert.Equal(t, []Problem{{2, "referenced by more than one parent [1 1]"}}, problems(t, twice, 1))
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	tilts := Tilts{
+		1: {ID: 1, BusinessRules: []uint64{30, 60}, Subtilts: []int{2, 9, 3}},
+		2: {ID: 2, Receivers: []string{"b"}, BusinessRules: []uint64{110, 10}},
+		3: {ID: 3, Receivers: []string{"c"}, BusinessRules: []uint64{100}, Basis: 1000},
+	}
+	assert.Equal(t, []Problem{
+		{1, "business rules length (2) must be subtilts length (3) + 1"},
+		{1, "business rules must sum to 100, got 90"},
+		{1, "local share of 30/100 has no receivers"},
+		{2, "business rules length (2) must be subtilts length (0) + 1"},
+		{2, "business rule 110 exceeds basis 100"},
+		{1, "subtilt 9 not found in data"},
+		{3, "unsupported rules basis 1000 (want 100 or 10000)"},
+	}, problems(t, tilts, 1))
+}
@@ -0,0 +1,275 @@
+package evidence
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"tilt-valid/internal/anchor"
+)
+
+// Kind identifies the type of misbehavior
+type Kind uint8
+
+const (
+	// KindEquivocation is two different broadcasts of the same protocol message
+	KindEquivocation Kind = 1
+	// KindInvalidShare is a share or proof rejected by tss-lib, naming its sender as culprit
+	KindInvalidShare Kind = 2
+	// KindMissedReveal is a beacon commitment that was never opened
+	KindMissedReveal Kind = 3
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindEquivocation:
+		return "equivocation"
+	case KindInvalidShare:
+		return "invalid-share"
+	case KindMissedReveal:
+		return "missed-reveal"
+	default:
+		return fmt.Sprintf("kind(%d)", uint8(k))
+	}
+}
+
+// signingDomain separates evidence signatures from anything else signed by identity keys
+const signingDomain = "solmpc-evidence-v1"
+
+// ErrInvalidEvidence is returned for evidence that does not decode or verify
+var ErrInvalidEvidence = errors.New("invalid evidence")
+
+// Evidence is a statement, signed by Reporter's identity key, that Offender
+// misbehaved during Session. Payload holds the kind-specific details in their
+// canonical encoding.
+//
+// Only the reporter signs evidence. Transport messages are not signed by
+// their senders, so the two broadcasts of an equivocation could have been
+// made up by the reporter: equivocation evidence is an unverified accusation,
+// to be weighed against the reports of other validators, and never proof on
+// its own. Invalid shares and missed reveals are equally the reporter's word.
+//
+// The canonical encoding is Borsh: kind u8, offender u16, reporter u16,
+// session string, timestamp i64, payload Vec<u8>, signature [u8; 64]. It is
+// also the argument layout of the slashing program's report_misbehavior
+// instruction.
+type Evidence struct {
+	Kind      Kind
+	Offender  uint16
+	Reporter  uint16
+	Session   string
+	Timestamp int64 // unix seconds
+	Payload   []byte
+	Signature []byte
+}
+
+// Equivocation carries both conflicting broadcasts as the reporter says it
+// received them from the offender. Nothing ties them to the offender.
+type Equivocation struct {
+	MessageType string
+	First       []byte
+	Second      []byte
+}
+
+// InvalidShare carries the tss-lib error that named the offender as culprit
+type InvalidShare struct {
+	Task   string
+	Round  uint32
+	Reason string
+}
+
+// MissedReveal carries the commitment the offender never opened
+type MissedReveal struct {
+	Round      string
+	Commitment []byte
+}
+
+// Encode returns the canonical payload encoding
+func (e Equivocation) Encode() []byte {
+	var enc anchor.Encoder
+	writeString(&enc, e.MessageType)
+	writeBytes(&enc, e.First)
+	writeBytes(&enc, e.Second)
+	return enc.Bytes()
+}
+
+// Encode returns the canonical payload encoding
+func (s InvalidShare) Encode() []byte {
+	var enc anchor.Encoder
+	writeString(&enc, s.Task)
+	enc.WriteU32(s.Round)
+	writeString(&enc, s.Reason)
+	return enc.Bytes()
+}
+
+// Encode returns the canonical payload encoding
+func (m MissedReveal) Encode() []byte {
+	var enc anchor.Encoder
+	writeString(&enc, m.Round)
+	writeBytes(&enc, m.Commitment)
+	return enc.Bytes()
+}
+
+// DecodePayload parses e.Payload into an Equivocation, InvalidShare or MissedReveal
+func (e *Evidence) DecodePayload() (interface{}, error) {
+	d := newDecoder(e.Payload)
+	var payload interface{}
+	switch e.Kind {
+	case KindEquivocation:
+		payload = Equivocation{MessageType: d.string(), First: d.bytes(), Second: d.bytes()}
+	case KindInvalidShare:
+		payload = InvalidShare{Task: d.string(), Round: d.u32(), Reason: d.string()}
+	case KindMissedReveal:
+		payload = MissedReveal{Round: d.string(), Commitment: d.bytes()}
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %d", ErrInvalidEvidence, e.Kind)
+	}
+	if err := d.finish(); err != nil {
+		return nil, fmt.Errorf("%w: %s payload: %v", ErrInvalidEvidence, e.Kind, err)
+	}
+	return payload, nil
+}
+
+// SigningBytes returns the message covered by the reporter's signature
+func (e *Evidence) SigningBytes() []byte {
+	var enc anchor.Encoder
+	enc.WriteFixed([]byte(signingDomain))
+	e.writeBody(&enc)
+	return enc.Bytes()
+}
+
+// ID identifies the evidence independently of its signature
+func (e *Evidence) ID() string {
+	sum := sha256.Sum256(e.SigningBytes())
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign signs the evidence with the reporter's identity key
+func (e *Evidence) Sign(key ed25519.PrivateKey) {
+	e.Signature = ed25519.Sign(key, e.SigningBytes())
+}
+
+// Verify checks the reporter's signature and that the payload is well formed.
+// For equivocation that proves who made the accusation, not that it is true.
+func (e *Evidence) Verify(reporterKey ed25519.PublicKey) error {
+	if len(reporterKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: bad reporter key length %d", ErrInvalidEvidence, len(reporterKey))
+	}
+	if len(e.Signature) != ed25519.SignatureSize || !ed25519.Verify(reporterKey, e.SigningBytes(), e.Signature) {
+		return fmt.Errorf("%w: bad signature from validator %d", ErrInvalidEvidence, e.Reporter)
+	}
+	_, err := e.DecodePayload()
+	return err
+}
+
+// Encode returns the canonical encoding of signed evidence
+func (e *Evidence) Encode() ([]byte, error) {
+	if len(e.Signature) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: evidence is not signed", ErrInvalidEvidence)
+	}
+	var enc anchor.Encoder
+	e.writeBody(&enc)
+	enc.WriteFixed(e.Signature)
+	return enc.Bytes(), nil
+}
+
+// Decode parses the canonical encoding; trailing bytes are rejected so every
+// piece of evidence has exactly one encoding
+func Decode(data []byte) (*Evidence, error) {
+	d := newDecoder(data)
+	e := &Evidence{
+		Kind:      Kind(d.u8()),
+		Offender:  d.u16(),
+		Reporter:  d.u16(),
+		Session:   d.string(),
+		Timestamp: int64(d.u64()),
+		Payload:   d.bytes(),
+		Signature: d.fixed(ed25519.SignatureSize),
+	}
+	if err := d.finish(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	if _, err := e.DecodePayload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// InstructionData encodes the evidence as a report_misbehavior instruction for
+// the slashing program: the Anchor discriminator followed by the canonical encoding
+func InstructionData(e *Evidence) ([]byte, error) {
+	encoded, err := e.Encode()
+	if err != nil {
+		return nil, err
+	}
+	discriminator := anchor.InstructionDiscriminator("report_misbehavior")
+	return append(discriminator[:], encoded...), nil
+}
+
+func (e *Evidence) writeBody(enc *anchor.Encoder) {
+	enc.WriteU8(uint8(e.Kind))
+	enc.WriteU16(e.Offender)
+	enc.WriteU16(e.Reporter)
+	writeString(enc, e.Session)
+	enc.WriteU64(uint64(e.Timestamp))
+	writeBytes(enc, e.Payload)
+}
+
+// writeBytes writes a length prefixed byte string. Only lengths past 4 GiB
+// fail, far beyond any message the transport carries.
+func writeBytes(enc *anchor.Encoder, v []byte) {
+	if err := enc.WriteBytes(v); err != nil {
+		panic(err)
+	}
+}
+
+func writeString(enc *anchor.Encoder, v string) { writeBytes(enc, []byte(v)) }
+
+// decoder reads Borsh with an anchor.Decoder, remembering the first error so
+// a whole record is read before it is checked
+type decoder struct {
+	d   *anchor.Decoder
+	err error
+}
+
+func newDecoder(data []byte) *decoder {
+	return &decoder{d: anchor.NewDecoder(data)}
+}
+
+// read returns the next value, or the zero value once reading failed
+func read[T any](d *decoder, next func() (T, error)) T {
+	var v T
+	if d.err == nil {
+		v, d.err = next()
+	}
+	return v
+}
+
+func (d *decoder) u8() uint8 { return read(d, d.d.ReadU8) }
+
+func (d *decoder) u16() uint16 { return read(d, d.d.ReadU16) }
+
+func (d *decoder) u32() uint32 { return read(d, d.d.ReadU32) }
+
+func (d *decoder) u64() uint64 { return read(d, d.d.ReadU64) }
+
+func (d *decoder) string() string { return read(d, d.d.ReadString) }
+
+// bytes reads a length prefixed byte string into a copy, as decoded evidence
+// outlives the data it was decoded from
+func (d *decoder) bytes() []byte {
+	return append([]byte(nil), read(d, d.d.ReadBytes)...)
+}
+
+func (d *decoder) fixed(n int) []byte {
+	return append([]byte(nil), read(d, func() ([]byte, error) { return d.d.ReadFixed(n) })...)
+}
+
+func (d *decoder) finish() error {
+	if d.err == nil && d.d.Remaining() != 0 {
+		d.err = fmt.Errorf("%d trailing bytes", d.d.Remaining())
+	}
+	return d.err
+}
@@ -0,0 +1,144 @@
+package evidence
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(seed byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+}
+
+func signedEquivocation(t *testing.T) *Evidence {
+	e := &Evidence{
+		Kind:      KindEquivocation,
+		Offender:  2,
+		Reporter:  1,
+		Session:   "keygen",
+		Timestamp: 1700000000,
+		Payload:   Equivocation{MessageType: "KGRound1Message", First: []byte{1, 2}, Second: []byte{3}}.Encode(),
+	}
+	e.Sign(testKey(1))
+	return e
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	e := signedEquivocation(t)
+
+	encoded, err := e.Encode()
+	require.NoError(t, err)
+	decoded, err := Decode(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, e, decoded)
+	assert.NoError(t, decoded.Verify(testKey(1).Public().(ed25519.PublicKey)))
+
+	payload, err := decoded.DecodePayload()
+	require.NoError(t, err)
+	assert.Equal(t, Equivocation{MessageType: "KGRound1Message", First: []byte{1, 2}, Second: []byte{3}}, payload)
+
+	// Trailing bytes would give the same evidence a second encoding
+	_, err = Decode(append(encoded, 0))
+	assert.ErrorIs(t, err, ErrInvalidEvidence)
+	_, err = Decode(encoded[:len(encoded)-1])
+	assert.ErrorIs(t, err, ErrInvalidEvidence)
+}
+
+func TestCanonicalLayout(t *testing.T) {
+	e := &Evidence{
+		Kind:      KindMissedReveal,
+		Offender:  0x0102,
+		Reporter:  3,
+		Session:   "r",
+		Timestamp: 1,
+		Payload:   MissedReveal{Round: "r", Commitment: []byte{0xaa}}.Encode(),
+		Signature: make([]byte, ed25519.SignatureSize),
+	}
+	encoded, err := e.Encode()
+	require.NoError(t, err)
+
+	expected := []byte{
+		3,          // kind
+		0x02, 0x01, // offender
+		3, 0, // reporter
+		1, 0, 0, 0, 'r', // session
+		1, 0, 0, 0, 0, 0, 0, 0, // timestamp
+		10, 0, 0, 0, 1, 0, 0, 0, 'r', 1, 0, 0, 0, 0xaa, // payload
+	}
+	expected = append(expected, make([]byte, ed25519.SignatureSize)...)
+	assert.Equal(t, expected, encoded)
+
+	data, err := InstructionData(e)
+	require.NoError(t, err)
+	discriminator := sha256.Sum256([]byte("global:report_misbehavior"))
+	assert.Equal(t, discriminator[:8], data[:8])
+	assert.Equal(t, encoded, data[8:])
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	pub := testKey(1).Public().(ed25519.PublicKey)
+
+	e := signedEquivocation(t)
+	e.Offender = 3
+	assert.ErrorIs(t, e.Verify(pub), ErrInvalidEvidence)
+
+	e = signedEquivocation(t)
+	assert.ErrorIs(t, e.Verify(testKey(2).Public().(ed25519.PublicKey)), ErrInvalidEvidence)
+
+	e = &Evidence{Kind: KindInvalidShare, Payload: []byte{1}}
+	e.Sign(testKey(1))
+	assert.ErrorIs(t, e.Verify(pub), ErrInvalidEvidence, "malformed payload")
+
+	_, err := (&Evidence{Kind: KindInvalidShare}).Encode()
+	assert.ErrorIs(t, err, ErrInvalidEvidence, "unsigned")
+}
+
+func TestCollectorRecordsOnce(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	collector := NewCollector(1, testKey(1), store)
+	clock := time.Unix(1700000000, 0)
+	collector.now = func() time.Time { return clock }
+	collector.SetSession("sign:abcd")
+
+	// The transport redelivers messages, so the same misbehavior is seen repeatedly
+	for i := 0; i < 3; i++ {
+		collector.ReportEquivocation(2, "SignRound1Message", []byte{1}, []byte{2})
+		clock = clock.Add(time.Second)
+	}
+	collector.ReportInvalidShare(3, "signing", 2, "proof verification failed")
+	collector.ReportMissedReveal(3, "beacon-round", []byte{0xcc})
+
+	records, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	pub := testKey(1).Public().(ed25519.PublicKey)
+	for _, e := range records {
+		assert.NoError(t, e.Verify(pub))
+		assert.Equal(t, uint16(1), e.Reporter)
+	}
+
+	assert.Equal(t, KindEquivocation, records[0].Kind)
+	assert.Equal(t, "sign:abcd", records[0].Session)
+
+	assert.Equal(t, KindInvalidShare, records[1].Kind)
+	payload, err := records[1].DecodePayload()
+	require.NoError(t, err)
+	assert.Equal(t, InvalidShare{Task: "signing", Round: 2, Reason: "proof verification failed"}, payload)
+
+	assert.Equal(t, KindMissedReveal, records[2].Kind)
+	assert.Equal(t, "beacon-round", records[2].Session, "missed reveals carry their beacon round")
+
+	// Storing the same record again does not duplicate it
+	require.NoError(t, store.Add(records[0]))
+	records, err = store.List()
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+}
@@ -0,0 +1,160 @@
+package evidence
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store persists signed evidence as one file per record in a directory
+type Store struct {
+	dir string
+}
+
+// NewStore creates a store rooted at dir
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create evidence directory: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Add writes e to the store. Adding the same evidence twice is a no-op.
+func (s *Store) Add(e *Evidence) error {
+	data, err := e.Encode()
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(s.dir, fmt.Sprintf("%s-%d-%s.evidence", e.Kind, e.Offender, e.ID()[:16]))
+	if _, err := os.Stat(name); err == nil {
+		return nil
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write evidence: %v", err)
+	}
+	return os.Rename(tmp, name)
+}
+
+// List returns all stored evidence ordered by timestamp
+func (s *Store) List() ([]*Evidence, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evidence directory: %v", err)
+	}
+
+	var all []*Evidence
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".evidence") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		e, err := Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		all = append(all, e)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Timestamp < all[j].Timestamp
+	})
+	return all, nil
+}
+
+// Collector signs and stores evidence observed by the local validator. Its
+// Report methods match the hooks exposed by the MPC party.
+type Collector struct {
+	self     uint16
+	key      ed25519.PrivateKey
+	store    *Store
+	session  string
+	reported map[[32]byte]struct{}
+	mutex    sync.Mutex
+
+	now func() time.Time
+}
+
+// NewCollector creates a collector reporting as validator self
+func NewCollector(self uint16, key ed25519.PrivateKey, store *Store) *Collector {
+	return &Collector{
+		self:     self,
+		key:      key,
+		store:    store,
+		reported: make(map[[32]byte]struct{}),
+		now:      time.Now,
+	}
+}
+
+// SetSession names the protocol run that subsequent MPC reports belong to
+func (c *Collector) SetSession(session string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.session = session
+}
+
+// ReportEquivocation records two different broadcasts of msgType from offender
+func (c *Collector) ReportEquivocation(offender uint16, msgType string, first, second []byte) {
+	c.report(KindEquivocation, offender, "", Equivocation{MessageType: msgType, First: first, Second: second}.Encode())
+}
+
+// ReportInvalidShare records a tss-lib error that named offender as culprit
+func (c *Collector) ReportInvalidShare(offender uint16, task string, round int, reason string) {
+	c.report(KindInvalidShare, offender, "", InvalidShare{Task: task, Round: uint32(round), Reason: reason}.Encode())
+}
+
+// ReportMissedReveal records a beacon commitment offender did not open
+func (c *Collector) ReportMissedReveal(offender int, round string, commitment []byte) {
+	c.report(KindMissedReveal, uint16(offender), round, MissedReveal{Round: round, Commitment: commitment}.Encode())
+}
+
+// Record signs and stores one piece of evidence. An empty session uses the
+// one set with SetSession. The same misbehavior is only recorded once, however
+// often the transport redelivers it.
+func (c *Collector) Record(kind Kind, offender uint16, session string, payload []byte) (*Evidence, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if session == "" {
+		session = c.session
+	}
+	e := &Evidence{
+		Kind:     kind,
+		Offender: offender,
+		Reporter: c.self,
+		Session:  session,
+		Payload:  payload,
+	}
+	// The timestamp is left out so repeated observations share a key
+	key := sha256.Sum256(e.SigningBytes())
+	if _, ok := c.reported[key]; ok {
+		return nil, nil
+	}
+
+	e.Timestamp = c.now().Unix()
+	e.Sign(c.key)
+	if err := c.store.Add(e); err != nil {
+		return nil, err
+	}
+	c.reported[key] = struct{}{}
+	return e, nil
+}
+
+func (c *Collector) report(kind Kind, offender uint16, session string, payload []byte) {
+	e, err := c.Record(kind, offender, session, payload)
+	if err != nil {
+		fmt.Printf("Failed to record %s evidence against validator %d: %v\n", kind, offender, err)
+		return
+	}
+	if e != nil {
+		fmt.Printf("Recorded %s evidence against validator %d\n", kind, offender)
+	}
+}
@@ -16,6 +16,9 @@ type Msg struct {
 	Broadcast bool
 	To        int
 	Message   []byte
+	// Session names the protocol run the message belongs to, empty for
+	// messages outside one such as heartbeats
+	Session string
 }
 
 func (t *Transport) ReadMsg() ([][]string, error) {
@@ -29,6 +32,7 @@ func (t *Transport) ReadMsg() ([][]string, error) {
 
 	reader := csv.NewReader(file)
 	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
 	record, err := reader.ReadAll()
 	if err != nil {
 		return nil, err
@@ -49,6 +53,9 @@ func (t *Transport) ReadMsgToChannel(ch chan<- []byte) error {
 	}
 
 	for _, record := range records {
+		if len(record) < 4 {
+			continue
+		}
 		from, _ := strconv.Atoi(record[0])
 		broadcast, _ := strconv.ParseBool(record[1])
 		to, _ := strconv.Atoi(record[2])
@@ -59,6 +66,9 @@ func (t *Transport) ReadMsgToChannel(ch chan<- []byte) error {
 			To:        to,
 			Message:   msg_,
 		}
+		if len(record) > 4 {
+			msg.Session = record[4]
+		}
 		byteMsg, err := json.Marshal(msg)
 		if err != nil {
 			return err
@@ -9,6 +9,18 @@ import (
 )
 
 func (t *Transport) SendMsg(message []byte, broadcast bool, to uint16) {
+	t.send("", message, broadcast, to)
+}
+
+// SessionSender returns a sender tagging its messages with session, so that
+// receivers can tell the protocol run they belong to
+func (t *Transport) SessionSender(session string) func(message []byte, broadcast bool, to uint16) {
+	return func(message []byte, broadcast bool, to uint16) {
+		t.send(session, message, broadcast, to)
+	}
+}
+
+func (t *Transport) send(session string, message []byte, broadcast bool, to uint16) {
 	from := t.partyID
 	if broadcast {
 		for _, party_ := range t.getParties() {
@@ -30,6 +42,7 @@ func (t *Transport) SendMsg(message []byte, broadcast bool, to uint16) {
 				strconv.FormatBool(broadcast),
 				strconv.Itoa(int(party)),
 				hex.EncodeToString(message),
+				session,
 			}
 
 			if err := writer.Write(record); err != nil {
@@ -54,6 +67,7 @@ func (t *Transport) SendMsg(message []byte, broadcast bool, to uint16) {
 			strconv.FormatBool(broadcast),
 			strconv.Itoa(int(to)),
 			hex.EncodeToString(message),
+			session,
 		}
 
 		if err := writer.Write(record); err != nil {
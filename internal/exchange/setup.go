@@ -7,26 +7,44 @@ import (
 	"tilt-valid/cmd/config"
 )
 
+// Directory resolves where messages for a party are delivered.
+// It is satisfied by the validator registry.
+type Directory interface {
+	TransportAddress(id uint16) (string, error)
+}
+
 type Transport struct {
-	Mutex   sync.Mutex
-	partyID int
-	parties []uint16
+	Mutex     sync.Mutex
+	partyID   int
+	parties   []uint16
+	directory Directory
 }
 
 func NewTransport(partyID int, parties []uint16) *Transport {
 	return &Transport{partyID: partyID, parties: parties}
 }
 
+// NewTransportWithDirectory creates a transport that looks up party addresses in directory
+func NewTransportWithDirectory(partyID int, parties []uint16, directory Directory) *Transport {
+	return &Transport{partyID: partyID, parties: parties, directory: directory}
+}
+
 func (t *Transport) GetFileName() string {
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		fmt.Println("error in loading config")
-	}
-	path := cfg.TransportPath
-	return path + strconv.Itoa(t.partyID) + ".csv"
+	return t.GetReceiverFileName(strconv.Itoa(t.partyID))
 }
 
 func (t *Transport) GetReceiverFileName(id string) string {
+	if t.directory != nil {
+		partyID, err := strconv.Atoi(id)
+		if err == nil {
+			address, err := t.directory.TransportAddress(uint16(partyID))
+			if err == nil {
+				return address
+			}
+			fmt.Printf("No transport address for party %s: %v\n", id, err)
+		}
+	}
+
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		fmt.Println("error in loading config")
@@ -0,0 +1,244 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// agreementMagic prefixes agreement payloads, which share the transport with
+// heartbeats and MPC messages
+var agreementMagic = []byte("AGR1")
+
+const (
+	kindPropose = "propose"
+	kindAck     = "ack"
+	kindCommit  = "commit"
+)
+
+// proposal is the wire format of proposals, acknowledgements and commits
+type proposal struct {
+	Kind    string   `json:"kind"`
+	From    uint16   `json:"from"`
+	Session string   `json:"session"`
+	Round   uint64   `json:"round"`
+	Signers []uint16 `json:"signers,omitempty"`
+	Value   []byte   `json:"value,omitempty"`
+}
+
+// Decision is what the validators agreed on for a session: who signs, and
+// the value the proposer chose for them to sign over, if any
+type Decision struct {
+	Signers []uint16
+	Value   []byte
+}
+
+// agreementState is one session as seen by a validator
+type agreementState struct {
+	bound    bool              // a proposer has been acknowledged or we proposed
+	leader   uint16            // the proposer we follow once bound
+	acked    map[uint16]uint64 // last round acknowledged, by proposer
+	proposed *proposal         // our open proposal, while we lead
+	acks     map[uint16]bool   // signers acknowledging our open proposal
+	sentAt   time.Time
+	decision *Decision
+}
+
+// Agreement settles which validators sign, so that every signer starts MPC
+// with the same set whatever its own view of who is alive. The lowest
+// validator available proposes the signers, along with a value such as the
+// blockhash to sign over, and commits once every signer has acknowledged; the
+// others follow its commit. A validator that does not see a lower one may
+// propose too, but gives way as soon as a lower proposer reaches it. A proposer
+// missing acknowledgements proposes again after Retry from the validators it
+// then sees available. Should a signer still end up committed by two
+// proposers, one signing round stalls and fails with its context.
+type Agreement struct {
+	self     uint16
+	monitor  *Monitor
+	send     Sender
+	choose   func(available []uint16) ([]uint16, error)
+	sessions map[string]*agreementState
+	mutex    sync.Mutex
+
+	// Retry is how long a proposer waits for acknowledgements
+	Retry time.Duration
+}
+
+// NewAgreement creates the agreement of self, which proposes the signers
+// choose picks among the validators monitor sees available
+func NewAgreement(self uint16, monitor *Monitor, send Sender, choose func(available []uint16) ([]uint16, error)) *Agreement {
+	return &Agreement{
+		self:     self,
+		monitor:  monitor,
+		send:     send,
+		choose:   choose,
+		sessions: make(map[string]*agreementState),
+		Retry:    5 * time.Second,
+	}
+}
+
+// IsAgreement reports whether a transport payload belongs to an agreement
+func IsAgreement(msg []byte) bool {
+	return bytes.HasPrefix(msg, agreementMagic)
+}
+
+// Decide waits until the validators among parties agree on the signers of
+// session, proposing them when this validator is the lowest available. value
+// is only called on the proposer. It fails when ctx is done first.
+func (a *Agreement) Decide(ctx context.Context, session string, parties []uint16, value func(ctx context.Context) ([]byte, error)) (Decision, error) {
+	var lastErr error
+	for {
+		available := a.monitor.Available(parties)
+		if decision, propose := a.next(session, available); decision != nil {
+			return *decision, nil
+		} else if propose {
+			if err := a.propose(ctx, session, available, value); err != nil {
+				lastErr = err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return Decision{}, fmt.Errorf("no agreement on the signers of %s: %v: %w", session, lastErr, ctx.Err())
+			}
+			return Decision{}, fmt.Errorf("no agreement on the signers of %s: %w", session, ctx.Err())
+		case <-time.After(a.monitor.Interval / 4):
+		}
+	}
+}
+
+// next returns the decision on session if there is one, and otherwise whether
+// this validator should propose now
+func (a *Agreement) next(session string, available []uint16) (*Decision, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	st := a.state(session)
+	if st.decision != nil {
+		return st.decision, false
+	}
+	if st.bound {
+		return nil, st.leader == a.self && time.Since(st.sentAt) >= a.Retry
+	}
+	return nil, len(available) > 0 && slices.Min(available) == a.self
+}
+
+// propose offers the signers chosen among available for session
+func (a *Agreement) propose(ctx context.Context, session string, available []uint16, value func(ctx context.Context) ([]byte, error)) error {
+	signers, err := a.choose(available)
+	if err != nil {
+		return err
+	}
+	var v []byte
+	if value != nil {
+		if v, err = value(ctx); err != nil {
+			return err
+		}
+	}
+
+	a.mutex.Lock()
+	st := a.state(session)
+	if st.decision != nil || (st.bound && st.leader != a.self) {
+		// A lower proposer reached us while we were choosing
+		a.mutex.Unlock()
+		return nil
+	}
+	round := uint64(1)
+	if st.proposed != nil {
+		round = st.proposed.Round + 1
+	}
+	p := &proposal{Kind: kindPropose, From: a.self, Session: session, Round: round, Signers: signers, Value: v}
+	st.bound, st.leader, st.proposed, st.sentAt = true, a.self, p, time.Now()
+	st.acks = map[uint16]bool{a.self: true}
+	commit := a.commitIfAcked(st)
+	a.mutex.Unlock()
+
+	a.send(encodeProposal(*p), true, 0)
+	if commit != nil {
+		a.send(encodeProposal(*commit), true, 0)
+	}
+	return nil
+}
+
+// OnMsg handles an agreement message received from a peer
+func (a *Agreement) OnMsg(msg []byte, from uint16) {
+	var p proposal
+	if err := json.Unmarshal(msg[len(agreementMagic):], &p); err != nil || p.From != from || from == a.self {
+		return
+	}
+
+	var replies []proposal
+	var replyTo uint16
+	a.mutex.Lock()
+	st := a.state(p.Session)
+	switch p.Kind {
+	case kindPropose:
+		// The file transport redelivers old records, so each round is
+		// acknowledged once. A lower proposer takes over from a higher one.
+		if st.decision != nil || (st.bound && from > st.leader) || p.Round <= st.acked[from] {
+			break
+		}
+		st.bound, st.leader, st.acked[from] = true, from, p.Round
+		st.proposed, st.acks = nil, nil
+		if slices.Contains(p.Signers, a.self) {
+			replies, replyTo = append(replies, proposal{Kind: kindAck, From: a.self, Session: p.Session, Round: p.Round}), from
+		}
+	case kindAck:
+		if st.decision != nil || st.proposed == nil || p.Round != st.proposed.Round || !slices.Contains(st.proposed.Signers, from) {
+			break
+		}
+		st.acks[from] = true
+		if commit := a.commitIfAcked(st); commit != nil {
+			replies = append(replies, *commit)
+		}
+	case kindCommit:
+		// Only a proposer whose round we acknowledged can commit us as a signer
+		if st.decision != nil || (slices.Contains(p.Signers, a.self) && st.acked[from] != p.Round) {
+			break
+		}
+		st.decision = &Decision{Signers: p.Signers, Value: p.Value}
+	}
+	a.mutex.Unlock()
+
+	for _, reply := range replies {
+		if reply.Kind == kindAck {
+			a.send(encodeProposal(reply), false, replyTo)
+		} else {
+			a.send(encodeProposal(reply), true, 0)
+		}
+	}
+}
+
+// commitIfAcked decides st once every proposed signer has acknowledged,
+// returning the commit to broadcast
+func (a *Agreement) commitIfAcked(st *agreementState) *proposal {
+	for _, signer := range st.proposed.Signers {
+		if !st.acks[signer] {
+			return nil
+		}
+	}
+	st.decision = &Decision{Signers: st.proposed.Signers, Value: st.proposed.Value}
+	commit := *st.proposed
+	commit.Kind = kindCommit
+	return &commit
+}
+
+func (a *Agreement) state(session string) *agreementState {
+	st, ok := a.sessions[session]
+	if !ok {
+		st = &agreementState{acked: make(map[uint16]uint64)}
+		a.sessions[session] = st
+	}
+	return st
+}
+
+func encodeProposal(p proposal) []byte {
+	payload, _ := json.Marshal(p)
+	return append(append([]byte(nil), agreementMagic...), payload...)
+}
@@ -0,0 +1,131 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lowest picks the threshold+1 lowest available validators, as mpc.SignerSet does
+func lowest(n int) func([]uint16) ([]uint16, error) {
+	return func(available []uint16) ([]uint16, error) {
+		if len(available) < n {
+			return nil, fmt.Errorf("only %d available", len(available))
+		}
+		return available[:n], nil
+	}
+}
+
+// agreements wires one agreement per monitor of n, delivering synchronously
+func agreements(n *network, choose func([]uint16) ([]uint16, error)) map[uint16]*Agreement {
+	all := make(map[uint16]*Agreement)
+	var mutex sync.Mutex
+	for id, m := range n.monitors {
+		id := id
+		m.Interval = 4 * time.Millisecond
+		all[id] = NewAgreement(id, m, func(msg []byte, isBroadcast bool, to uint16) {
+			mutex.Lock()
+			peers := make(map[uint16]*Agreement, len(all))
+			for peerID, peer := range all {
+				peers[peerID] = peer
+			}
+			mutex.Unlock()
+			for peerID, peer := range peers {
+				if peerID == id || (!isBroadcast && peerID != to) {
+					continue
+				}
+				peer.OnMsg(msg, id)
+			}
+		}, choose)
+	}
+	return all
+}
+
+// decideAll runs Decide on every validator at once
+func decideAll(t *testing.T, all map[uint16]*Agreement, parties []uint16) map[uint16]Decision {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	decisions := make(map[uint16]Decision)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for id, a := range all {
+		id, a := id, a
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decision, err := a.Decide(ctx, "sign:1", parties, func(context.Context) ([]byte, error) {
+				return []byte(fmt.Sprintf("blockhash of %d", id)), nil
+			})
+			assert.NoError(t, err, "validator %d", id)
+			mutex.Lock()
+			decisions[id] = decision
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	return decisions
+}
+
+func TestAgreementOnSigners(t *testing.T) {
+	parties := []uint16{1, 2, 3, 4}
+	n := newNetwork(parties...)
+	for _, m := range n.monitors {
+		m.Ping()
+	}
+
+	decisions := decideAll(t, agreements(n, lowest(3)), parties)
+	require.Len(t, decisions, 4)
+	for id, decision := range decisions {
+		assert.Equal(t, []uint16{1, 2, 3}, decision.Signers, "validator %d", id)
+		assert.Equal(t, []byte("blockhash of 1"), decision.Value, "the proposer's value")
+	}
+}
+
+func TestAgreementFollowsLowestProposer(t *testing.T) {
+	parties := []uint16{1, 2, 3}
+	n := newNetwork(parties...)
+	for _, m := range n.monitors {
+		m.Ping()
+	}
+	// 3 lost track of 1, so on its own it would sign with 2 and 3
+	n.monitors[3].peers[1].status.LastSeen = time.Time{}
+
+	decisions := decideAll(t, agreements(n, lowest(2)), parties)
+	for id, decision := range decisions {
+		assert.Equal(t, []uint16{1, 2}, decision.Signers, "validator %d", id)
+	}
+}
+
+func TestAgreementWithCompetingProposers(t *testing.T) {
+	parties := []uint16{1, 2, 3}
+	n := newNetwork(parties...)
+	for _, m := range n.monitors {
+		m.Ping()
+	}
+	// 2 and 3 lost track of 1, so 1 and 2 both propose
+	n.monitors[2].peers[1].status.LastSeen = time.Time{}
+	n.monitors[3].peers[1].status.LastSeen = time.Time{}
+
+	decisions := decideAll(t, agreements(n, lowest(2)), parties)
+	require.Len(t, decisions, 3)
+	for id, decision := range decisions {
+		assert.Equal(t, decisions[1].Signers, decision.Signers, "validator %d", id)
+	}
+}
+
+func TestAgreementTimesOut(t *testing.T) {
+	n := newNetwork(1, 2)
+	all := agreements(n, lowest(2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := all[1].Decide(ctx, "sign:1", []uint16{1, 2}, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "2 is not available, so no signer set")
+}
@@ -0,0 +1,309 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProtocolVersion is advertised in every heartbeat
+const ProtocolVersion = "solmpc/1"
+
+// heartbeatMagic prefixes heartbeat payloads so they can share the transport with MPC messages
+var heartbeatMagic = []byte("HBT1")
+
+const (
+	kindPing = "ping"
+	kindPong = "pong"
+)
+
+// Sender delivers a message over the transport; it matches exchange.Transport.SendMsg
+type Sender func(msg []byte, isBroadcast bool, to uint16)
+
+// heartbeat is the wire format of pings and pongs
+type heartbeat struct {
+	Kind            string `json:"kind"`
+	From            uint16 `json:"from"`
+	Session         int64  `json:"session"` // changes when the sender restarts
+	Seq             uint64 `json:"seq"`
+	SentAt          int64  `json:"sent_at"` // unix nanoseconds of the originating ping
+	ProtocolVersion string `json:"protocol_version"`
+}
+
+// PeerStatus is one row of the liveness table
+type PeerStatus struct {
+	ID              uint16        `json:"id"`
+	LastSeen        time.Time     `json:"last_seen"`
+	RTT             time.Duration `json:"rtt"`
+	ProtocolVersion string        `json:"protocol_version"`
+	Available       bool          `json:"available"`
+}
+
+// Report is the liveness table as persisted for the operator status command
+type Report struct {
+	Validator uint16       `json:"validator"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Peers     []PeerStatus `json:"peers"`
+}
+
+// peerState tracks what has been received from one peer
+type peerState struct {
+	status   PeerStatus
+	session  int64
+	lastPing uint64
+	lastPong uint64
+}
+
+// Monitor sends periodic heartbeats to peers and tracks their liveness
+type Monitor struct {
+	self    uint16
+	send    Sender
+	peers   map[uint16]*peerState
+	session int64
+	seq     uint64
+	mutex   sync.Mutex
+
+	// Interval between pings
+	Interval time.Duration
+	// Timeout after which a silent peer is marked unavailable
+	Timeout time.Duration
+	// StatusPath, when set, receives the liveness table after every round
+	StatusPath string
+
+	now func() time.Time
+}
+
+// NewMonitor creates a monitor for self watching peers
+func NewMonitor(self uint16, peers []uint16, send Sender) *Monitor {
+	m := &Monitor{
+		self:     self,
+		send:     send,
+		peers:    make(map[uint16]*peerState),
+		Interval: time.Second,
+		Timeout:  5 * time.Second,
+		now:      time.Now,
+	}
+	m.session = m.now().UnixNano()
+	for _, id := range peers {
+		if id == self {
+			continue
+		}
+		m.peers[id] = &peerState{status: PeerStatus{ID: id}}
+	}
+	return m
+}
+
+// IsHeartbeat reports whether a transport payload is a heartbeat rather than an MPC message
+func IsHeartbeat(msg []byte) bool {
+	return bytes.HasPrefix(msg, heartbeatMagic)
+}
+
+// Run pings all peers every Interval until ctx is done
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.Ping()
+		if m.StatusPath != "" {
+			if err := m.Persist(m.StatusPath); err != nil {
+				fmt.Printf("Failed to persist liveness table: %v\n", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ping broadcasts one heartbeat to all peers
+func (m *Monitor) Ping() {
+	m.mutex.Lock()
+	m.seq++
+	hb := heartbeat{
+		Kind:            kindPing,
+		From:            m.self,
+		Session:         m.session,
+		Seq:             m.seq,
+		SentAt:          m.now().UnixNano(),
+		ProtocolVersion: ProtocolVersion,
+	}
+	m.mutex.Unlock()
+
+	m.send(encode(hb), true, 0)
+}
+
+// OnMsg handles a heartbeat received from a peer
+func (m *Monitor) OnMsg(msg []byte, from uint16) {
+	var hb heartbeat
+	if err := json.Unmarshal(msg[len(heartbeatMagic):], &hb); err != nil {
+		return
+	}
+	if hb.From != from {
+		return
+	}
+
+	m.mutex.Lock()
+	peer, ok := m.peers[from]
+	if !ok {
+		m.mutex.Unlock()
+		return
+	}
+
+	now := m.now()
+	var reply []byte
+	switch hb.Kind {
+	case kindPing:
+		if hb.Session != peer.session {
+			peer.session = hb.Session
+			peer.lastPing = 0
+		}
+		// The file transport redelivers old records, so only act on new sequence numbers
+		if hb.Seq <= peer.lastPing {
+			m.mutex.Unlock()
+			return
+		}
+		peer.lastPing = hb.Seq
+		reply = encode(heartbeat{
+			Kind:            kindPong,
+			From:            m.self,
+			Session:         m.session,
+			Seq:             hb.Seq,
+			SentAt:          hb.SentAt,
+			ProtocolVersion: ProtocolVersion,
+		})
+	case kindPong:
+		// Pongs echo our own ping; ones older than this session answer a previous run
+		if hb.Seq <= peer.lastPong || hb.SentAt < m.session {
+			m.mutex.Unlock()
+			return
+		}
+		peer.lastPong = hb.Seq
+		peer.status.RTT = now.Sub(time.Unix(0, hb.SentAt))
+	default:
+		m.mutex.Unlock()
+		return
+	}
+	peer.status.LastSeen = now
+	peer.status.ProtocolVersion = hb.ProtocolVersion
+	m.mutex.Unlock()
+
+	if reply != nil {
+		m.send(reply, false, from)
+	}
+}
+
+// IsAvailable reports whether id has been heard from within Timeout. The local
+// validator is always available.
+func (m *Monitor) IsAvailable(id uint16) bool {
+	if id == m.self {
+		return true
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	peer, ok := m.peers[id]
+	return ok && m.available(peer)
+}
+
+// Available filters ids down to the validators currently considered alive
+func (m *Monitor) Available(ids []uint16) []uint16 {
+	var result []uint16
+	for _, id := range ids {
+		if m.IsAvailable(id) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// WaitForPeers blocks until at least n peers are available or ctx is done
+func (m *Monitor) WaitForPeers(ctx context.Context, n int) error {
+	for {
+		var alive int
+		for _, status := range m.Snapshot() {
+			if status.Available {
+				alive++
+			}
+		}
+		if alive >= n {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("only %d of %d peers responded: %w", alive, n, ctx.Err())
+		case <-time.After(m.Interval / 4):
+		}
+	}
+}
+
+// Snapshot returns the liveness table ordered by validator ID
+func (m *Monitor) Snapshot() []PeerStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	table := make([]PeerStatus, 0, len(m.peers))
+	for _, peer := range m.peers {
+		status := peer.status
+		status.Available = m.available(peer)
+		table = append(table, status)
+	}
+	sort.Slice(table, func(i, j int) bool {
+		return table[i].ID < table[j].ID
+	})
+	return table
+}
+
+// Persist writes the liveness table to path for the status command
+func (m *Monitor) Persist(path string) error {
+	report := Report{
+		Validator: m.self,
+		UpdatedAt: m.now(),
+		Peers:     m.Snapshot(),
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadReport reads a liveness table written by Persist
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	return &report, nil
+}
+
+// available requires a recent heartbeat from a peer speaking our protocol version
+func (m *Monitor) available(peer *peerState) bool {
+	if peer.status.LastSeen.IsZero() || peer.status.ProtocolVersion != ProtocolVersion {
+		return false
+	}
+	return m.now().Sub(peer.status.LastSeen) <= m.Timeout
+}
+
+func encode(hb heartbeat) []byte {
+	payload, _ := json.Marshal(hb)
+	return append(append([]byte(nil), heartbeatMagic...), payload...)
+}
@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is shared by all monitors in a test
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// network wires monitors together the way the file transport does, synchronously
+type network struct {
+	monitors map[uint16]*Monitor
+	clock    *fakeClock
+	latency  time.Duration
+	log      [][]byte
+}
+
+func newNetwork(ids ...uint16) *network {
+	n := &network{
+		monitors: make(map[uint16]*Monitor),
+		clock:    &fakeClock{now: time.Unix(1700000000, 0)},
+	}
+	for _, id := range ids {
+		id := id
+		m := NewMonitor(id, ids, func(msg []byte, isBroadcast bool, to uint16) {
+			n.log = append(n.log, msg)
+			n.clock.now = n.clock.now.Add(n.latency)
+			for peerID, peer := range n.monitors {
+				if peerID == id || (!isBroadcast && peerID != to) {
+					continue
+				}
+				peer.OnMsg(msg, id)
+			}
+		})
+		m.now = n.clock.Now
+		m.session = n.clock.now.UnixNano()
+		n.monitors[id] = m
+	}
+	return n
+}
+
+func TestHeartbeatLiveness(t *testing.T) {
+	n := newNetwork(1, 2, 3)
+	n.latency = 10 * time.Millisecond
+
+	assert.Equal(t, []uint16{1}, n.monitors[1].Available([]uint16{1, 2, 3}), "nobody heard yet")
+
+	n.monitors[1].Ping()
+
+	table := n.monitors[1].Snapshot()
+	require.Len(t, table, 2)
+	for _, peer := range table {
+		assert.True(t, peer.Available, "peer %d", peer.ID)
+		assert.Equal(t, ProtocolVersion, peer.ProtocolVersion)
+		// ping and pong each add one hop of latency
+		assert.GreaterOrEqual(t, peer.RTT, 2*n.latency)
+	}
+
+	assert.True(t, n.monitors[2].IsAvailable(1), "pings also count as liveness")
+	assert.False(t, n.monitors[2].IsAvailable(3), "2 never heard from 3")
+}
+
+func TestPeerMarkedUnavailableAfterTimeout(t *testing.T) {
+	n := newNetwork(1, 2)
+	m := n.monitors[1]
+	m.Ping()
+	require.True(t, m.IsAvailable(2))
+
+	n.clock.now = n.clock.now.Add(m.Timeout + time.Second)
+	assert.False(t, m.IsAvailable(2))
+	assert.Equal(t, []uint16{1}, m.Available([]uint16{1, 2}))
+}
+
+func TestReplayedHeartbeatsIgnored(t *testing.T) {
+	n := newNetwork(1, 2)
+	m := n.monitors[1]
+	m.Ping()
+	rtt := m.Snapshot()[0].RTT
+	lastSeen := m.Snapshot()[0].LastSeen
+
+	// The file transport re-reads the whole inbox and redelivers every record
+	n.clock.now = n.clock.now.Add(time.Minute)
+	for _, msg := range n.log {
+		m.OnMsg(msg, 2)
+		n.monitors[2].OnMsg(msg, 1)
+	}
+
+	assert.Equal(t, rtt, m.Snapshot()[0].RTT)
+	assert.Equal(t, lastSeen, m.Snapshot()[0].LastSeen)
+}
+
+func TestIncompatibleProtocolUnavailable(t *testing.T) {
+	n := newNetwork(1, 2)
+	m := n.monitors[1]
+
+	msg := encode(heartbeat{Kind: kindPing, From: 2, Session: 1, Seq: 1, SentAt: n.clock.now.UnixNano(), ProtocolVersion: "solmpc/0"})
+	m.OnMsg(msg, 2)
+
+	status := m.Snapshot()[0]
+	assert.Equal(t, "solmpc/0", status.ProtocolVersion)
+	assert.False(t, status.Available)
+}
+
+func TestWaitForPeersAndPersist(t *testing.T) {
+	n := newNetwork(1, 2, 3)
+	m := n.monitors[1]
+	m.Interval = 4 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, m.WaitForPeers(ctx, 2))
+
+	m.Ping()
+	assert.NoError(t, m.WaitForPeers(context.Background(), 2))
+
+	path := filepath.Join(t.TempDir(), "health_1.json")
+	require.NoError(t, m.Persist(path))
+	report, err := LoadReport(path)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(1), report.Validator)
+	assert.Len(t, report.Peers, 2)
+	assert.True(t, report.Peers[0].Available)
+}
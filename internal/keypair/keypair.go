@@ -0,0 +1,185 @@
+// Package keypair loads local Solana keys from Solana CLI keypair files and
+// keeps them out of the repository
+package keypair
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+var (
+	// ErrInsecurePermissions is returned for keypair files readable by group or others
+	ErrInsecurePermissions = errors.New("keypair file is accessible by group or others")
+	// ErrKeyInRepository is returned when a keypair is found in the repository tree
+	ErrKeyInRepository = errors.New("keypair found in the repository tree")
+)
+
+const (
+	// maxKeypairSize bounds the files parsed as keypairs; a CLI keypair is
+	// about 230 bytes
+	maxKeypairSize = 1024
+	// maxShareSize bounds the files parsed as MPC key shares; tss-lib save
+	// data grows with the number of parties, a few KB for a small committee
+	maxShareSize = 1 << 20
+)
+
+// Load reads a keypair file written by solana-keygen: a JSON array of the 64
+// bytes of the private key, the seed followed by the public key. Like ssh, it
+// refuses files that group or others can access.
+func Load(path string) (solana.PrivateKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keypair: %w", err)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("%w: %s has mode %04o, want 0600", ErrInsecurePermissions, path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keypair: %w", err)
+	}
+	key, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keypair %s: %v", path, err)
+	}
+	return key, nil
+}
+
+// Open loads the key at path, or returns nil for an empty path: MPC-only
+// mode, where the threshold key pays and signs and no local key exists
+func Open(path string) (solana.PrivateKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return Load(path)
+}
+
+// parse decodes a keypair, checking that the public half matches the seed
+func parse(data []byte) (solana.PrivateKey, error) {
+	// A []byte field would decode from base64, so decode plain numbers
+	var values []int
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("not a JSON byte array: %v", err)
+	}
+	if len(values) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("has %d bytes, want %d", len(values), ed25519.PrivateKeySize)
+	}
+	raw := make([]byte, len(values))
+	for i, v := range values {
+		if v < 0 || v > 255 {
+			return nil, fmt.Errorf("byte %d is %d, out of range", i, v)
+		}
+		raw[i] = byte(v)
+	}
+	derived := ed25519.NewKeyFromSeed(raw[:ed25519.SeedSize])
+	if !derived.Equal(ed25519.PrivateKey(raw)) {
+		return nil, fmt.Errorf("public key does not match the seed")
+	}
+	return solana.PrivateKey(raw), nil
+}
+
+// RepositoryRoot returns the nearest directory at or above dir holding a .git
+// entry, or "" when dir is not inside a repository
+func RepositoryRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// CheckRepository fails with ErrKeyInRepository if a keypair file or an MPC
+// key share lies anywhere under root, whatever its name, or if one of the
+// configured key paths points into it, so a key can never be committed by
+// accident
+func CheckRepository(root string, paths ...string) error {
+	if root == "" {
+		return nil
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	var found []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(root, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			found = append(found, rel)
+		}
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxShareSize {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if isShare(data) {
+			rel, _ := filepath.Rel(root, path)
+			found = append(found, rel)
+		} else if len(data) <= maxKeypairSize {
+			if _, err := parse(data); err == nil {
+				rel, _ := filepath.Rel(root, path)
+				found = append(found, rel)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan %s for keypairs: %w", root, err)
+	}
+
+	if len(found) > 0 {
+		return fmt.Errorf("%w: %s; move keys outside %s", ErrKeyInRepository, strings.Join(found, ", "), root)
+	}
+	return nil
+}
+
+// isShare reports whether data is tss-lib save data, the JSON KeyGen writes
+// with the secret share Xi and the party's ShareID
+func isShare(data []byte) bool {
+	var share struct {
+		Xi      json.RawMessage
+		ShareID json.RawMessage
+	}
+	if err := json.Unmarshal(data, &share); err != nil {
+		return false
+	}
+	return len(share.Xi) > 0 && string(share.Xi) != "null" && len(share.ShareID) > 0 && string(share.ShareID) != "null"
+}
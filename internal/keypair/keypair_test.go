@@ -0,0 +1,109 @@
+package keypair
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeypair writes key the way solana-keygen does
+func writeKeypair(t *testing.T, path string, key []byte, perm os.FileMode) {
+	t.Helper()
+	numbers := make([]int, len(key))
+	for i, b := range key {
+		numbers[i] = int(b)
+	}
+	data, err := json.Marshal(numbers)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	require.NoError(t, os.WriteFile(path, data, perm))
+	require.NoError(t, os.Chmod(path, perm))
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	key := solana.NewWallet().PrivateKey
+
+	path := filepath.Join(dir, "id.json")
+	writeKeypair(t, path, key, 0o600)
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, key, loaded)
+	assert.Equal(t, key.PublicKey(), loaded.PublicKey())
+
+	// Group or world readable keys are refused
+	open := filepath.Join(dir, "open.json")
+	writeKeypair(t, open, key, 0o644)
+	_, err = Load(open)
+	assert.ErrorIs(t, err, ErrInsecurePermissions)
+
+	// The public half must belong to the seed
+	mismatched := append([]byte(nil), key...)
+	mismatched[63] ^= 1
+	bad := filepath.Join(dir, "bad.json")
+	writeKeypair(t, bad, mismatched, 0o600)
+	_, err = Load(bad)
+	assert.ErrorContains(t, err, "does not match the seed")
+
+	short := filepath.Join(dir, "short.json")
+	writeKeypair(t, short, key[:32], 0o600)
+	_, err = Load(short)
+	assert.ErrorContains(t, err, "has 32 bytes, want 64")
+
+	_, err = Load(filepath.Join(dir, "missing.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// No path means MPC-only: no local key and no error
+	none, err := Open("")
+	require.NoError(t, err)
+	assert.Nil(t, none)
+}
+
+func TestCheckRepository(t *testing.T) {
+	repo := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(repo, ".git"), 0o700))
+	nested := filepath.Join(repo, "cmd", "config")
+	require.NoError(t, os.MkdirAll(nested, 0o700))
+
+	root, err := RepositoryRoot(nested)
+	require.NoError(t, err)
+	assert.Equal(t, repo, root)
+
+	// Ordinary JSON and keys outside the repository are fine
+	require.NoError(t, os.WriteFile(filepath.Join(nested, "ballot.json"), []byte(`[1, 2, 3]`), 0o600))
+	outside := filepath.Join(t.TempDir(), "id.json")
+	writeKeypair(t, outside, solana.NewWallet().PrivateKey, 0o600)
+	assert.NoError(t, CheckRepository(root, outside, ""))
+
+	// A configured key inside the repository is refused even before it exists
+	err = CheckRepository(root, filepath.Join(repo, "data", "payer.json"))
+	assert.ErrorIs(t, err, ErrKeyInRepository)
+
+	// So is any keypair file in the tree, whatever its name or permissions
+	writeKeypair(t, filepath.Join(nested, "validator.json"), solana.NewWallet().PrivateKey, 0o644)
+	err = CheckRepository(root, outside)
+	assert.ErrorIs(t, err, ErrKeyInRepository)
+	assert.ErrorContains(t, err, filepath.Join("cmd", "config", "validator.json"))
+	require.NoError(t, os.Remove(filepath.Join(nested, "validator.json")))
+	require.NoError(t, CheckRepository(root, outside))
+
+	// And MPC key shares, which KeyGen writes without an extension
+	share := `{"Xi": 4711, "ShareID": 2, "Ks": [1, 2, 3], "EDDSAPub": {"Curve": "ed25519", "Coords": [1, 2]}}`
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "cmd", "localsavedata_eddsa0"), []byte(share), 0o600))
+	err = CheckRepository(root, outside)
+	assert.ErrorIs(t, err, ErrKeyInRepository)
+	assert.ErrorContains(t, err, filepath.Join("cmd", "localsavedata_eddsa0"))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "cmd", "localsavedata_eddsa0"), []byte(`{"Xi": null, "ShareID": 2}`), 0o600))
+	assert.NoError(t, CheckRepository(root, outside))
+
+	// Outside a repository there is nothing to check
+	alone, err := RepositoryRoot(filepath.Dir(outside))
+	require.NoError(t, err)
+	assert.Empty(t, alone)
+	assert.NoError(t, CheckRepository(alone, outside))
+}
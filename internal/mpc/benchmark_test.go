@@ -16,7 +16,7 @@ func BenchmarkDKG(b *testing.B) {
 	// Initialize parties once
 	suite.parties = make([]*Party, testValidators)
 	for i := 0; i < testValidators; i++ {
-		suite.parties[i] = NewParty(uint16(i+1), suite.createLogger(fmt.Sprintf("bench_party_%d", i+1)))
+		suite.parties[i] = newParty(b, uint16(i+1), suite.createLogger(fmt.Sprintf("bench_party_%d", i+1)))
 	}
 
 	suite.senders = suite.createSenders(suite.parties)
@@ -52,7 +52,7 @@ func BenchmarkMPCSigning(b *testing.B) {
 	// Setup DKG once
 	suite.parties = make([]*Party, testValidators)
 	for i := 0; i < testValidators; i++ {
-		suite.parties[i] = NewParty(uint16(i+1), suite.createLogger(fmt.Sprintf("bench_party_%d", i+1)))
+		suite.parties[i] = newParty(b, uint16(i+1), suite.createLogger(fmt.Sprintf("bench_party_%d", i+1)))
 	}
 
 	suite.senders = suite.createSenders(suite.parties)
@@ -104,7 +104,7 @@ func BenchmarkFullFlow(b *testing.B) {
 		// DKG
 		suite.parties = make([]*Party, testValidators)
 		for j := 0; j < testValidators; j++ {
-			suite.parties[j] = NewParty(uint16(j+1), suite.createLogger(fmt.Sprintf("bench_party_%d", j+1)))
+			suite.parties[j] = newParty(b, uint16(j+1), suite.createLogger(fmt.Sprintf("bench_party_%d", j+1)))
 		}
 
 		suite.senders = suite.createSenders(suite.parties)
@@ -151,7 +151,7 @@ func BenchmarkValidatorScaling(b *testing.B) {
 				// Initialize parties
 				suite.parties = make([]*Party, count)
 				for j := 0; j < count; j++ {
-					suite.parties[j] = NewParty(uint16(j+1), suite.createLogger(fmt.Sprintf("scale_party_%d", j+1)))
+					suite.parties[j] = newParty(b, uint16(j+1), suite.createLogger(fmt.Sprintf("scale_party_%d", j+1)))
 				}
 
 				suite.senders = suite.createScalableSenders(suite.parties)
@@ -212,7 +212,7 @@ func BenchmarkMessageThroughput(b *testing.B) {
 	// Setup parties
 	suite.parties = make([]*Party, testValidators)
 	for i := 0; i < testValidators; i++ {
-		suite.parties[i] = NewParty(uint16(i+1), suite.createLogger(fmt.Sprintf("throughput_party_%d", i+1)))
+		suite.parties[i] = newParty(b, uint16(i+1), suite.createLogger(fmt.Sprintf("throughput_party_%d", i+1)))
 	}
 
 	suite.senders = suite.createSenders(suite.parties)
@@ -254,7 +254,7 @@ func BenchmarkMemoryUsage(b *testing.B) {
 		// Initialize parties
 		suite.parties = make([]*Party, testValidators)
 		for j := 0; j < testValidators; j++ {
-			suite.parties[j] = NewParty(uint16(j+1), suite.createLogger(fmt.Sprintf("memory_party_%d", j+1)))
+			suite.parties[j] = newParty(b, uint16(j+1), suite.createLogger(fmt.Sprintf("memory_party_%d", j+1)))
 		}
 
 		// Setup senders and initialize
@@ -3,7 +3,6 @@ package ecdsa
 import (
 	"context"
 	"crypto/ed25519"
-	"encoding/binary"
 	"fmt"
 	"strings"
 	"sync"
@@ -11,7 +10,11 @@ import (
 	"testing"
 	"time"
 
+	"tilt-valid/internal/solanarpc"
+	"tilt-valid/internal/solanatx"
+
 	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
@@ -60,6 +63,7 @@ type IntegrationTestSuite struct {
 	metrics         []PhaseMetrics
 	errorInjector   *ErrorInjector
 	securityAuditor *SecurityAuditor
+	cluster         *solanarpc.Fake
 	t               *testing.T
 }
 
@@ -88,6 +92,7 @@ func NewIntegrationTestSuite(t *testing.T) *IntegrationTestSuite {
 			failedValidators: make(map[int]bool),
 		},
 		securityAuditor: &SecurityAuditor{},
+		cluster:         solanarpc.NewFake(solanatx.ProgramID),
 	}
 }
 
@@ -158,14 +163,11 @@ func (suite *IntegrationTestSuite) runFullIntegrationTest(t *testing.T) {
 	suite.endPhase("Signature_Verification", nil)
 	assert.True(t, isValid, "Transaction signature should be valid")
 
-	// Phase 7: Simulate Solana Submission (DevNet test)
+	// Phase 7: Solana Submission to the in-memory cluster
 	suite.startPhase("Solana_Submission")
-	err = suite.simulateSolanaSubmission(signedTx)
+	err = suite.submitSolanaTransaction(ctx, signedTx)
 	suite.endPhase("Solana_Submission", err)
-	// Note: We allow this to fail in testing since we're using DevNet
-	if err != nil {
-		t.Logf("Solana submission failed (expected in test): %v", err)
-	}
+	require.NoError(t, err, "Submission should succeed")
 
 	t.Log("✅ Full end-to-end MPC flow completed successfully")
 }
@@ -175,22 +177,10 @@ func (suite *IntegrationTestSuite) performDKG(ctx context.Context) ([][]byte, er
 	// Initialize parties
 	suite.parties = make([]*Party, testValidators)
 	for i := 0; i < testValidators; i++ {
-		suite.parties[i] = NewParty(uint16(i+1), suite.createLogger(fmt.Sprintf("party_%d", i+1)))
+		suite.parties[i] = newParty(suite.t, uint16(i+1), suite.createLogger(fmt.Sprintf("party_%d", i+1)))
 	}
 
-	// Set up senders
-	suite.senders = suite.createSenders(suite.parties)
-
-	// Initialize parties with senders
-	for i, party := range suite.parties {
-		var parties []uint16
-		for j := 0; j < testValidators; j++ {
-			if j != i {
-				parties = append(parties, uint16(j+1))
-			}
-		}
-		party.Init(parties, testThreshold, suite.senders[i])
-	}
+	suite.initParties()
 
 	// Perform DKG
 	shares := make([][]byte, testValidators)
@@ -223,6 +213,27 @@ func (suite *IntegrationTestSuite) performDKG(ctx context.Context) ([][]byte, er
 	return shares, nil
 }
 
+// initParties starts a new protocol round on every party. Each party knows
+// all of them, itself included, and a round ends with the protocol it runs.
+func (suite *IntegrationTestSuite) initParties() {
+	suite.senders = suite.createSenders(suite.parties)
+	var ids []uint16
+	for i := range suite.parties {
+		ids = append(ids, uint16(i+1))
+	}
+	for i, party := range suite.parties {
+		party.Init(ids, testThreshold, suite.senders[i])
+	}
+}
+
+// prepareSigning starts the signing round after DKG with every party's share
+func (suite *IntegrationTestSuite) prepareSigning(shares [][]byte) {
+	suite.initParties()
+	for i, party := range suite.parties {
+		party.SetShareData(shares[i])
+	}
+}
+
 // createTestBallot creates a sample ballot for testing
 func (suite *IntegrationTestSuite) createTestBallot() *Ballot {
 	return &Ballot{
@@ -260,35 +271,41 @@ func (suite *IntegrationTestSuite) tallyVotes(votes []Vote, ballot *Ballot) ([]u
 
 // createAndSignSolanaTransaction creates and signs a transaction using MPC
 func (suite *IntegrationTestSuite) createAndSignSolanaTransaction(ctx context.Context, shares [][]byte, voteCounts []uint64, totalVotes uint64) (*solana.Transaction, error) {
-	// Set share data for all parties
-	for i, party := range suite.parties {
-		party.SetShareData(shares[i])
-	}
+	suite.prepareSigning(shares)
 
-	// Create mock Solana transaction
-	programID, _ := solana.PublicKeyFromBase58("EM7AAngMgQPXizeuwAKaBvci79DhRxJMBYjRVoJWYEH3")
+	// Create a Solana transaction paid and signed by the threshold key
+	programID := solanatx.ProgramID
 	recipient, _ := solana.PublicKeyFromBase58("11111111111111111111111111111112")
-
-	// Create instruction data
-	instructionData, err := suite.serializeInstructionData(voteCounts, totalVotes)
+	pk, err := suite.parties[0].ThresholdPK()
 	if err != nil {
 		return nil, err
 	}
-
-	// Create accounts
-	accounts := []*solana.AccountMeta{
-		{PublicKey: recipient, IsSigner: false, IsWritable: true},
+	feePayer, err := solanatx.ThresholdAccount(pk)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create instruction
-	instruction := solana.NewInstruction(programID, accounts, instructionData)
+	// Create instruction with one receiver entry per ballot option
+	payment := solanatx.Payment{TotalAmount: totalVotes, Amounts: voteCounts}
+	for range voteCounts {
+		payment.Receivers = append(payment.Receivers, recipient)
+	}
+	instruction, err := solanatx.NewPaymentInstruction(programID, feePayer, payment)
+	if err != nil {
+		return nil, err
+	}
 
-	// Create transaction with mock blockhash
-	blockhash := solana.Hash{} // Mock blockhash for testing
+	// Create transaction with a blockhash from the in-memory cluster, which
+	// also funds the threshold account for the fee
+	suite.cluster.Fund(feePayer, 1_000_000)
+	recent, err := suite.cluster.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	if err != nil {
+		return nil, err
+	}
 	tx, err := solana.NewTransaction(
 		[]solana.Instruction{instruction},
-		blockhash,
-		solana.TransactionPayer(recipient),
+		recent.Hash,
+		solana.TransactionPayer(feePayer),
 	)
 	if err != nil {
 		return nil, err
@@ -300,15 +317,16 @@ func (suite *IntegrationTestSuite) createAndSignSolanaTransaction(ctx context.Co
 		return nil, err
 	}
 
-	// Sign with MPC
-	digest := Digest(txMessage)
-	signature, err := suite.performMPCSign(ctx, digest)
+	// Sign the raw message with MPC, as Solana verifies it
+	signature, err := suite.performMPCSign(ctx, txMessage)
 	if err != nil {
 		return nil, err
 	}
 
-	// Apply signature
-	tx.Signatures = []solana.Signature{solana.SignatureFromBytes(signature)}
+	// Apply signature at the fee payer's index
+	if err := solanatx.AddSignature(tx, feePayer, signature); err != nil {
+		return nil, err
+	}
 
 	return tx, nil
 }
@@ -359,40 +377,31 @@ func (suite *IntegrationTestSuite) verifyTransactionSignature(tx *solana.Transac
 		return false
 	}
 
-	// Get threshold public key from first party
-	pk, err := suite.parties[0].ThresholdPK()
-	if err != nil {
-		suite.t.Logf("Failed to get threshold public key: %v", err)
+	// Verify every signature against the raw message, as Solana does
+	if err := tx.VerifySignatures(); err != nil {
+		suite.t.Logf("Transaction signature verification failed: %v", err)
 		return false
 	}
+	return true
+}
 
-	// Get transaction message
-	txMessage, err := tx.Message.MarshalBinary()
+// submitSolanaTransaction submits to the in-memory cluster, which verifies
+// the signature and the program's checks, and waits for finalization
+func (suite *IntegrationTestSuite) submitSolanaTransaction(ctx context.Context, tx *solana.Transaction) error {
+	signature, err := suite.cluster.SendTransaction(ctx, tx)
 	if err != nil {
-		suite.t.Logf("Failed to marshal transaction message: %v", err)
-		return false
+		return err
 	}
-
-	// Verify signature
-	return ed25519.Verify(pk, Digest(txMessage), tx.Signatures[0][:])
-}
-
-// simulateSolanaSubmission simulates submitting to Solana network
-func (suite *IntegrationTestSuite) simulateSolanaSubmission(tx *solana.Transaction) error {
-	// This would normally submit to DevNet, but for testing we just validate format
-	if len(tx.Signatures) == 0 {
-		return fmt.Errorf("transaction has no signatures")
+	suite.cluster.Advance(32)
+	finalized, err := suite.cluster.Confirm(ctx, signature, rpc.CommitmentFinalized)
+	if err != nil {
+		return err
 	}
-
-	if len(tx.Message.Instructions) == 0 {
-		return fmt.Errorf("transaction has no instructions")
+	if !finalized {
+		return fmt.Errorf("transaction %s was not finalized", signature)
 	}
 
-	// In a real scenario, you would:
-	// client := rpc.New("https://api.devnet.solana.com")
-	// sig, err := client.SendTransaction(ctx, tx)
-
-	suite.t.Log("✅ Transaction format validated for Solana submission")
+	suite.t.Logf("✅ Transaction %s finalized", signature)
 	return nil
 }
 
@@ -416,25 +425,14 @@ func (suite *IntegrationTestSuite) testValidatorFailures(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
 	defer cancel()
 
-	// Test: Single validator failure (should still work with threshold=2, validators=3)
-	suite.errorInjector.failedValidators[2] = true
-
-	_, err := suite.performDKG(ctx)
-
-	// Should succeed with 2 out of 3 validators
-	assert.NoError(t, err, "DKG should succeed with single validator failure")
-
-	// Reset error injection
-	suite.errorInjector.failedValidators = make(map[int]bool)
+	defer func() { suite.errorInjector.failedValidators = make(map[int]bool) }()
 
-	// Test: Too many validator failures (should fail)
-	suite.errorInjector.failedValidators[1] = true
+	// Test: Single validator failure. DKG needs every validator, so it fails
+	// even though signing would not need the failed one with more validators
 	suite.errorInjector.failedValidators[2] = true
 
-	_, err = suite.performDKG(ctx)
-
-	// Should fail with insufficient validators
-	assert.Error(t, err, "DKG should fail with too many validator failures")
+	_, err := suite.performDKG(ctx)
+	assert.Error(t, err, "DKG should fail with a validator down")
 
 	t.Log("✅ Validator failure scenarios tested successfully")
 }
@@ -491,9 +489,10 @@ func (suite *IntegrationTestSuite) runPerformanceTests(t *testing.T) {
 
 	// Run performance test
 	suite.startPhase("Performance_DKG")
-	_, err := suite.performDKG(ctx)
+	shares, err := suite.performDKG(ctx)
 	suite.endPhase("Performance_DKG", err)
 	require.NoError(t, err)
+	suite.prepareSigning(shares)
 
 	suite.startPhase("Performance_Signing")
 	testMessage := []byte("performance test message")
@@ -536,7 +535,7 @@ func (suite *IntegrationTestSuite) testSingleValidatorSigning(t *testing.T) {
 	require.NoError(t, err)
 
 	// Try to sign with only one party
-	suite.parties[0].SetShareData(shares[0])
+	suite.prepareSigning(shares)
 
 	testMessage := []byte("security test message")
 	signature, err := suite.parties[0].Sign(ctx, Digest(testMessage))
@@ -563,9 +562,7 @@ func (suite *IntegrationTestSuite) testSignatureManipulation(t *testing.T) {
 	require.NoError(t, err)
 
 	// Set share data for signing
-	for i, party := range suite.parties {
-		party.SetShareData(shares[i])
-	}
+	suite.prepareSigning(shares)
 
 	// Create valid signature
 	testMessage := []byte("manipulation test message")
@@ -594,7 +591,7 @@ func (suite *IntegrationTestSuite) testSignatureManipulation(t *testing.T) {
 // testThresholdEnforcement ensures threshold requirements are enforced
 func (suite *IntegrationTestSuite) testThresholdEnforcement(t *testing.T) {
 	// Test with insufficient parties (below threshold)
-	singleParty := NewParty(1, suite.createLogger("single_party"))
+	singleParty := newParty(suite.t, 1, suite.createLogger("single_party"))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -666,34 +663,6 @@ func (suite *IntegrationTestSuite) createLogger(id string) Logger {
 	return logger.With(zap.String("id", id)).Sugar()
 }
 
-// serializeInstructionData creates instruction data for testing
-func (suite *IntegrationTestSuite) serializeInstructionData(amounts []uint64, totalAmount uint64) ([]byte, error) {
-	var data []byte
-
-	// Add discriminator
-	discriminator := make([]byte, 8)
-	data = append(data, discriminator...)
-
-	// Add total amount
-	totalBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(totalBytes, totalAmount)
-	data = append(data, totalBytes...)
-
-	// Add amounts length
-	lengthBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(lengthBytes, uint32(len(amounts)))
-	data = append(data, lengthBytes...)
-
-	// Add amounts
-	for _, amount := range amounts {
-		amountBytes := make([]byte, 8)
-		binary.LittleEndian.PutUint64(amountBytes, amount)
-		data = append(data, amountBytes...)
-	}
-
-	return data, nil
-}
-
 // Performance tracking methods
 
 func (suite *IntegrationTestSuite) startPhase(phaseName string) {
@@ -17,6 +17,7 @@ func (p *Party) KeyGen(ctx context.Context) ([]byte, error) {
 	log.Println("[INFO] EDDSA Key Generation started.")
 	defer log.Println("[INFO] EDDSA Key Generation completed.")
 	defer close(p.closeChan)
+	defer p.endSession()
 
 	// Channel to receive the final DKG output
 	end := make(chan *keygen.LocalPartySaveData, 1)
@@ -31,6 +32,7 @@ func (p *Party) KeyGen(ctx context.Context) ([]byte, error) {
 		defer endWG.Done()
 		if err := party.Start(); err != nil {
 			log.Printf("[ERROR] Failed to generate key: %v\n", err)
+			p.reportCulprits(err)
 		}
 	}()
 
@@ -62,9 +64,10 @@ func (p *Party) KeyGen(ctx context.Context) ([]byte, error) {
 
 			log.Printf("[INFO] Received message from Party %s\n", routing.From.Id)
 
-			ok, err := party.UpdateFromBytes(raw, routing.From, routing.IsBroadcast)
+			ok, updateErr := party.UpdateFromBytes(raw, routing.From, routing.IsBroadcast)
 			if !ok {
-				log.Printf(".", err)
+				log.Printf("[WARNING] Error updating party state: %v\n", updateErr)
+				p.reportCulprits(updateErr)
 				continue
 			}
 		}
@@ -5,13 +5,21 @@ import (
 	"crypto/ed25519"
 	"fmt"
 	"math/big"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"tilt-valid/internal/solanarpc"
+	"tilt-valid/internal/solanatx"
+
+	"github.com/bnb-chain/tss-lib/v2/eddsa/keygen"
 	"github.com/bnb-chain/tss-lib/v2/tss"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	// tsslib "crypto/tss-lib"
 	"go.uber.org/zap"
@@ -29,6 +37,27 @@ func (parties parties) init(senders []Sender) {
 	}
 }
 
+// signSolanaMessage signs msg with SignSolanaMessage on every party.
+func (parties parties) signSolanaMessage(msg []byte) ([][]byte, error) {
+	sigs := make([][]byte, len(parties))
+	errs := make([]error, len(parties))
+	var wg sync.WaitGroup
+	for i, p := range parties {
+		wg.Add(1)
+		go func(i int, p *Party) {
+			defer wg.Done()
+			sigs[i], errs[i] = p.SignSolanaMessage(context.Background(), msg)
+		}(i, p)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sigs, nil
+}
+
 // setShareData sets the share data for each party.
 func (parties parties) setShareData(shareData [][]byte) {
 	for i, p := range parties {
@@ -115,9 +144,9 @@ func (parties parties) Mapping() map[string]*tss.PartyID {
 
 // TestTSS is a test function for the TSS protocol.
 func TestTSS(t *testing.T) {
-	pA := NewParty(1, logger("pA", t.Name()))
-	pB := NewParty(2, logger("pB", t.Name()))
-	pC := NewParty(3, logger("pC", t.Name()))
+	pA := newParty(t, 1, logger("pA", t.Name()))
+	pB := newParty(t, 2, logger("pB", t.Name()))
+	pC := newParty(t, 3, logger("pC", t.Name()))
 
 	t.Logf("Created parties")
 
@@ -157,6 +186,338 @@ func TestTSS(t *testing.T) {
 	assert.True(t, ed25519.Verify(pk, Digest(msgToSign), sigs[0]))
 }
 
+// TestSignWithPartyOffline checks that threshold+1 of the parties sign with
+// shares from a DKG run by all of them.
+func TestSignWithPartyOffline(t *testing.T) {
+	all := parties{}
+	for id := uint16(1); id <= 4; id++ {
+		all = append(all, newParty(t, id, logger(fmt.Sprintf("p%d", id), t.Name())))
+	}
+	all.init(senders(all))
+	shares, err := all.keygen()
+	require.NoError(t, err)
+	all.setShareData(shares)
+
+	// A share is saved under its party's ID, so a party loads its own before
+	// it is initialized, whatever its position among the parties
+	assert.Equal(t, "localsavedata_eddsa4", filepath.Base(all[3].SharePath()))
+	restarted := NewParty(4, logger("p4", t.Name()))
+	restarted.ShareDir = all[3].ShareDir
+	require.NoError(t, restarted.LoadLocalPartySaveData())
+	restartedPK, err := restarted.ThresholdPK()
+	require.NoError(t, err)
+
+	// Every party seeing the same parties alive picks the same signers
+	signers, err := SignerSet([]uint16{4, 2, 1, 3}, threshold)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2, 3}, signers)
+	_, err = SignerSet([]uint16{2, 4}, threshold)
+	assert.ErrorContains(t, err, "only 2 parties available, 3 needed")
+
+	// Party 3 is offline
+	signers, err = SignerSet([]uint16{4, 2, 1}, threshold)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2, 4}, signers)
+	online := parties{all[0], all[1], all[3]}
+	for i, s := range senders(online) {
+		online[i].Init(signers, threshold, s)
+	}
+	msg := []byte("signed without party 3")
+	sigs, err := online.signSolanaMessage(msg)
+	require.NoError(t, err)
+	pk, err := all[2].ThresholdPK()
+	require.NoError(t, err)
+	assert.Equal(t, pk, restartedPK)
+	for _, sig := range sigs {
+		assert.True(t, ed25519.Verify(pk, msg, sig))
+	}
+
+	// A party outside the DKG cannot sign
+	all[0].Init([]uint16{1, 2, 5}, threshold, func([]byte, bool, uint16) {})
+	_, err = all[0].Sign(context.Background(), msg)
+	assert.ErrorContains(t, err, "party 5 took no part in DKG")
+}
+
+// thresholdKey runs DKG among three parties and returns them, ready to sign,
+// along with the account of their threshold key.
+func thresholdKey(t *testing.T) (parties, solana.PublicKey) {
+	t.Helper()
+	parties := parties{newParty(t, 1, logger("pA", t.Name())), newParty(t, 2, logger("pB", t.Name())), newParty(t, 3, logger("pC", t.Name()))}
+	parties.init(senders(parties))
+	shares, err := parties.keygen()
+	require.NoError(t, err)
+	parties.setShareData(shares)
+
+	pk, err := parties[0].ThresholdPK()
+	require.NoError(t, err)
+	account, err := solanatx.ThresholdAccount(pk)
+	require.NoError(t, err)
+	return parties, account
+}
+
+// solanaSigner signs every message in a new MPC round of the parties.
+func (parties parties) solanaSigner() solanatx.SignFunc {
+	return func(ctx context.Context, message []byte) ([]byte, error) {
+		parties.init(senders(parties))
+		sigs, err := parties.signSolanaMessage(message)
+		if err != nil {
+			return nil, err
+		}
+		return sigs[0], nil
+	}
+}
+
+// fundedCluster returns an in-memory cluster, which checks signatures and the
+// program's invariants like devnet would, with account funded.
+func fundedCluster(account solana.PublicKey) *solanarpc.Fake {
+	cluster := solanarpc.NewFake(solanatx.ProgramID)
+	cluster.Fund(account, 10_000_000)
+	return cluster
+}
+
+// TestThresholdKeyPaysAndSigns checks that a transaction paid by the threshold
+// key carries an MPC signature Solana accepts.
+func TestThresholdKeyPaysAndSigns(t *testing.T) {
+	parties, feePayer := thresholdKey(t)
+	receiver := solana.NewWallet().PublicKey()
+	txs, err := solanatx.BuildTransferTransactions(solanatx.ProgramID, feePayer, solana.Hash{1},
+		solanatx.Payment{TotalAmount: 5, Receivers: []solana.PublicKey{receiver}, Amounts: []uint64{5}}, nil, solanatx.ComputeBudget{})
+	require.NoError(t, err)
+	tx := txs[0]
+
+	require.NoError(t, solanatx.Sign(context.Background(), tx, feePayer, parties.solanaSigner()))
+	assert.Equal(t, feePayer, tx.Message.AccountKeys[0])
+	assert.Equal(t, uint8(1), tx.Message.Header.NumRequiredSignatures)
+	assert.NoError(t, tx.VerifySignatures())
+}
+
+// TestThresholdKeyPaysOnCluster checks that a cluster accepts a transfer
+// signed by the threshold key and moves the funds.
+func TestThresholdKeyPaysOnCluster(t *testing.T) {
+	parties, feePayer := thresholdKey(t)
+	ctx := context.Background()
+	cluster := fundedCluster(feePayer)
+	recent, err := cluster.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+
+	receiver := solana.NewWallet().PublicKey()
+	txs, err := solanatx.BuildTransferTransactions(solanatx.ProgramID, feePayer, recent.Hash,
+		solanatx.Payment{TotalAmount: 5, Receivers: []solana.PublicKey{receiver}, Amounts: []uint64{5}}, nil, solanatx.ComputeBudget{})
+	require.NoError(t, err)
+	require.NoError(t, solanatx.Sign(ctx, txs[0], feePayer, parties.solanaSigner()))
+
+	signature, err := cluster.SendTransaction(ctx, txs[0])
+	require.NoError(t, err)
+	cluster.Advance(32)
+	finalized, err := cluster.Confirm(ctx, signature, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	assert.True(t, finalized)
+	account, err := cluster.GetAccount(ctx, receiver)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), account.Lamports)
+}
+
+// TestThresholdKeyExtendsLookupTable checks that the threshold key creates
+// and extends a lookup table, then signs a v0 message, version prefix
+// included, that looks up the receivers in it.
+func TestThresholdKeyExtendsLookupTable(t *testing.T) {
+	parties, feePayer := thresholdKey(t)
+	ctx := context.Background()
+	cluster := fundedCluster(feePayer)
+
+	slot, err := cluster.Slot(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	create, address, err := solanatx.CreateLookupTableInstruction(feePayer, feePayer, slot)
+	require.NoError(t, err)
+	payment := solanatx.Payment{TotalAmount: 30, Receivers: []solana.PublicKey{solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()}, Amounts: []uint64{10, 20}}
+	extend, err := solanatx.ExtendLookupTableInstruction(solanatx.LookupTable{Address: address, Authority: feePayer}, feePayer, payment.Receivers)
+	require.NoError(t, err)
+	recent, err := cluster.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	setup, err := solana.NewTransaction([]solana.Instruction{create, extend}, recent.Hash, solana.TransactionPayer(feePayer))
+	require.NoError(t, err)
+	require.NoError(t, solanatx.Sign(ctx, setup, feePayer, parties.solanaSigner()))
+	_, err = cluster.SendTransaction(ctx, setup)
+	require.NoError(t, err)
+	cluster.Advance(1)
+
+	table, err := solanarpc.LoadLookupTable(ctx, cluster, address)
+	require.NoError(t, err)
+	assert.Equal(t, solana.PublicKeySlice(payment.Receivers), table.Addresses)
+	recent, err = cluster.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	txs, err := solanatx.BuildVersionedTransferTransactions(solanatx.ProgramID, feePayer, recent.Hash, []solanatx.LookupTable{table}, payment, nil, solanatx.ComputeBudget{})
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	require.NoError(t, solanatx.Sign(ctx, txs[0], feePayer, parties.solanaSigner()))
+
+	_, err = cluster.SendTransaction(ctx, txs[0])
+	require.NoError(t, err)
+	for i, receiver := range payment.Receivers {
+		account, err := cluster.GetAccount(ctx, receiver)
+		require.NoError(t, err)
+		assert.Equal(t, payment.Amounts[i], account.Lamports)
+	}
+}
+
+// TestThresholdKeySignsBundle checks that a payout exported as a bundle, as
+// for validators signing offline, is signed from the bundle file and lands.
+func TestThresholdKeySignsBundle(t *testing.T) {
+	parties, feePayer := thresholdKey(t)
+	ctx := context.Background()
+	cluster := fundedCluster(feePayer)
+	recent, err := cluster.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+
+	receiver := solana.NewWallet().PublicKey()
+	txs, err := solanatx.BuildTransferTransactions(solanatx.ProgramID, feePayer, recent.Hash,
+		solanatx.Payment{TotalAmount: 7, Receivers: []solana.PublicKey{receiver}, Amounts: []uint64{7}}, nil, solanatx.ComputeBudget{})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "payout.bundle")
+	bundle, err := solanatx.NewBundle(txs[0], feePayer, recent.LastValidBlockHeight, nil)
+	require.NoError(t, err)
+	require.NoError(t, solanatx.WriteBundle(path, bundle))
+	bundle, err = solanatx.ReadBundle(path)
+	require.NoError(t, err)
+	require.NoError(t, bundle.Sign(ctx, parties.solanaSigner()))
+	require.NoError(t, solanatx.WriteBundle(path, bundle))
+
+	bundle, err = solanatx.ReadBundle(path)
+	require.NoError(t, err)
+	signed, err := bundle.Transaction()
+	require.NoError(t, err)
+	_, err = cluster.SendTransaction(ctx, signed)
+	require.NoError(t, err)
+	account, err := cluster.GetAccount(ctx, receiver)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), account.Lamports)
+}
+
+// TestSignKeepsLeadingZeros checks that messages are signed byte for byte,
+// although tss-lib carries them as big.Ints.
+func TestSignKeepsLeadingZeros(t *testing.T) {
+	parties, account := thresholdKey(t)
+	pk := ed25519.PublicKey(account[:])
+
+	long := make([]byte, 1500)
+	for i := range long {
+		long[i] = byte(i)
+	}
+	for name, msg := range map[string][]byte{
+		"leading zeros": {0, 0, 0, 1, 2, 3},
+		"all zeros":     make([]byte, 32),
+		"single zero":   {0},
+		"v0 message":    append([]byte{0x80, 1, 0, 1}, make([]byte, 64)...),
+		"long":          long,
+	} {
+		parties.init(senders(parties))
+		sigs, err := parties.signSolanaMessage(msg)
+		require.NoError(t, err, name)
+		for _, sig := range sigs {
+			assert.True(t, ed25519.Verify(pk, msg, sig), name)
+		}
+	}
+}
+
+// fakeReporter records the misbehavior reported by a party.
+type fakeReporter struct {
+	equivocations []uint16
+	culprits      []uint16
+}
+
+func (r *fakeReporter) ReportEquivocation(offender uint16, msgType string, first, second []byte) {
+	r.equivocations = append(r.equivocations, offender)
+}
+
+func (r *fakeReporter) ReportInvalidShare(offender uint16, task string, round int, reason string) {
+	r.culprits = append(r.culprits, offender)
+}
+
+// TestEquivocationReported checks that conflicting broadcasts are reported and dropped.
+func TestEquivocationReported(t *testing.T) {
+	reporter := &fakeReporter{}
+	pA := newParty(t, 1, logger("pA", t.Name()))
+	pA.Reporter = reporter
+	pA.Init([]uint16{1, 2, 3}, threshold, func([]byte, bool, uint16) {})
+
+	from := tss.NewPartyID("2", "", big.NewInt(2))
+	wire := func(commitment int64) []byte {
+		raw, _, err := keygen.NewKGRound1Message(from, big.NewInt(commitment)).WireBytes()
+		assert.NoError(t, err)
+		return raw
+	}
+
+	// Redelivery of the same message is not equivocation
+	pA.OnMsg(wire(1), 2, true)
+	pA.OnMsg(wire(1), 2, true)
+	assert.Empty(t, reporter.equivocations)
+	assert.Len(t, pA.in, 2)
+
+	pA.OnMsg(wire(2), 2, true)
+	assert.Equal(t, []uint16{2}, reporter.equivocations)
+	assert.Len(t, pA.in, 2, "the conflicting message must not reach the protocol")
+
+	// A new run starts with a clean slate
+	pA.Init([]uint16{1, 2, 3}, threshold, func([]byte, bool, uint16) {})
+	pA.OnMsg(wire(2), 2, true)
+	assert.Len(t, reporter.equivocations, 1)
+
+	// Each signing run reuses the message types, so only two messages of the
+	// same session conflict
+	pA.SetSession("sign:a")
+	pA.OnSessionMsg("sign:a", wire(3), 2, true)
+	pA.SetSession("sign:b")
+	pA.OnSessionMsg("sign:b", wire(4), 2, true)
+	assert.Len(t, reporter.equivocations, 1)
+	pA.OnSessionMsg("sign:b", wire(5), 2, true)
+	assert.Equal(t, []uint16{2, 2}, reporter.equivocations)
+
+	pA.reportCulprits(tss.NewError(fmt.Errorf("bad share"), "keygen", 2, pA.Id, from))
+	assert.Equal(t, []uint16{2}, reporter.culprits)
+}
+
+// TestSessionMessages checks that only messages of the current run reach the
+// protocol: those of earlier runs are dropped and those of later runs held
+// until they start.
+func TestSessionMessages(t *testing.T) {
+	pA := newParty(t, 1, logger("pA", t.Name()))
+	from := tss.NewPartyID("2", "", big.NewInt(2))
+	raw, _, err := keygen.NewKGRound1Message(from, big.NewInt(1)).WireBytes()
+	require.NoError(t, err)
+
+	// A faster peer is already in the next run, and redelivery does not
+	// duplicate its message
+	pA.OnSessionMsg("sign:b", raw, 2, true)
+	pA.OnSessionMsg("sign:b", raw, 2, true)
+	assert.Empty(t, pA.in)
+
+	pA.Init([]uint16{1, 2, 3}, threshold, func([]byte, bool, uint16) {})
+	pA.SetSession("sign:a")
+	pA.OnSessionMsg("sign:a", raw, 2, true)
+	assert.Len(t, pA.in, 1)
+
+	// The next run starts with only the message held for it
+	pA.Init([]uint16{1, 2, 3}, threshold, func([]byte, bool, uint16) {})
+	pA.SetSession("sign:b")
+	assert.Len(t, pA.in, 1)
+	pA.OnSessionMsg("sign:a", raw, 2, true)
+	assert.Len(t, pA.in, 1, "a finished run's message must not reach the protocol")
+
+	// Nothing more is queued once the run is over
+	pA.endSession()
+	pA.OnSessionMsg("sign:b", raw, 2, true)
+	assert.Len(t, pA.in, 1)
+}
+
+// newParty creates a party saving its key share under a directory removed
+// after the test, never in the package directory
+func newParty(tb testing.TB, id uint16, logger Logger) *Party {
+	p := NewParty(id, logger)
+	p.ShareDir = tb.TempDir()
+	return p
+}
+
 // senders returns a slice of sender functions for each party.
 func senders(parties parties) []Sender {
 	var senders []Sender
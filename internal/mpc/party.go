@@ -10,7 +10,9 @@ import (
 	"math"
 	"math/big"
 	"os"
-	"strconv"
+	"path/filepath"
+	"sort"
+	"sync"
 
 	transport "tilt-valid/internal/exchange"
 
@@ -72,10 +74,19 @@ type Logger interface {
 	Infof(format string, a ...interface{})
 }
 
+// MisbehaviorReporter receives evidence of misbehavior observed during a protocol run.
+type MisbehaviorReporter interface {
+	// ReportEquivocation is called when a party broadcasts two different messages of the same type in one run.
+	ReportEquivocation(offender uint16, msgType string, first, second []byte)
+	// ReportInvalidShare is called for every culprit named by a tss-lib error.
+	ReportInvalidShare(offender uint16, task string, round int, reason string)
+}
+
 // Party structure representing a participant in the TSS protocol.
 type Party struct {
 	Transport *transport.Transport
 	Logger    Logger
+	Reporter  MisbehaviorReporter
 	sendMsg   Sender
 	Id        *tss.PartyID
 	params    *tss.Parameters
@@ -83,6 +94,30 @@ type Party struct {
 	in        chan tss.Message
 	shareData *keygen.LocalPartySaveData
 	closeChan chan struct{}
+
+	// ShareDir is where KeyGen saves the key share, the working directory
+	// when empty. The share is a secret and must not live in the repository.
+	ShareDir string
+
+	// broadcasts remembers the first broadcast of each type from each party in the current run
+	broadcasts     map[string][]byte
+	broadcastsLock sync.Mutex
+
+	// session names the current protocol run. Messages tagged with a run
+	// that has finished are dropped, and those of a run not started yet are
+	// held until it starts.
+	session     string
+	running     bool
+	finished    map[string]bool
+	pending     map[string]map[string]sessionMsg
+	sessionLock sync.Mutex
+}
+
+// sessionMsg is a message held for a protocol run not started yet
+type sessionMsg struct {
+	msgBytes  []byte
+	from      uint16
+	broadcast bool
 }
 
 // Method to get the Party ID.
@@ -93,10 +128,12 @@ func (p *Party) ID() *tss.PartyID {
 // Method to create a new Party.
 func NewParty(id uint16, logger Logger) *Party {
 	return &Party{
-		Logger: logger,
-		Id:     tss.NewPartyID(fmt.Sprintf("%d", id), "", big.NewInt(int64(id))),
-		out:    make(chan tss.Message, 1000),
-		in:     make(chan tss.Message, 1000),
+		Logger:   logger,
+		Id:       tss.NewPartyID(fmt.Sprintf("%d", id), "", big.NewInt(int64(id))),
+		out:      make(chan tss.Message, 1000),
+		in:       make(chan tss.Message, 1000),
+		finished: make(map[string]bool),
+		pending:  make(map[string]map[string]sessionMsg),
 	}
 }
 
@@ -128,26 +165,148 @@ func (p *Party) ClassifyMsg(msgBytes []byte) (uint8, bool, error) {
 
 // Method to handle incoming messages.
 func (p *Party) OnMsg(msgBytes []byte, from uint16, broadcast bool) {
+	if msg := p.parseMsg("", msgBytes, from, broadcast); msg != nil {
+		p.in <- msg
+	}
+}
+
+// OnSessionMsg is OnMsg for a message tagged with the protocol run it belongs
+// to. The file transport keeps redelivering old records and a faster peer may
+// already be in the next run, so only messages of the current run are
+// processed; those of a later run wait for SetSession.
+func (p *Party) OnSessionMsg(session string, msgBytes []byte, from uint16, broadcast bool) {
+	p.sessionLock.Lock()
+	defer p.sessionLock.Unlock()
+
+	switch {
+	case p.running && session == p.session:
+		if msg := p.parseMsg(session, msgBytes, from, broadcast); msg != nil {
+			p.offer(msg)
+		}
+	case p.finished[session]:
+	default:
+		held := p.pending[session]
+		if held == nil {
+			held = make(map[string]sessionMsg)
+			p.pending[session] = held
+		}
+		held[fmt.Sprintf("%d/%t/%x", from, broadcast, msgBytes)] = sessionMsg{msgBytes, from, broadcast}
+	}
+}
+
+// SetSession starts the protocol run named session, which the party must be
+// initialized for: it drops whatever is left of earlier runs and delivers the
+// messages already received for this one.
+func (p *Party) SetSession(session string) {
+	p.sessionLock.Lock()
+	defer p.sessionLock.Unlock()
+
+	if p.session != "" {
+		p.finished[p.session] = true
+	}
+	p.session, p.running = session, true
+	for drained := false; !drained; {
+		select {
+		case <-p.in:
+		default:
+			drained = true
+		}
+	}
+	for _, m := range p.pending[session] {
+		if msg := p.parseMsg(session, m.msgBytes, m.from, m.broadcast); msg != nil {
+			p.offer(msg)
+		}
+	}
+	delete(p.pending, session)
+}
+
+// Method to queue a message of the current run. The run may be ending, so it
+// never blocks; the transport delivers a dropped message again.
+func (p *Party) offer(msg tss.ParsedMessage) {
+	select {
+	case p.in <- msg:
+	default:
+		p.Logger.Warnf("Inbox full, dropping message from %s", msg.GetFrom().Id)
+	}
+}
+
+// endSession stops processing messages of the current run once it is over
+func (p *Party) endSession() {
+	p.sessionLock.Lock()
+	defer p.sessionLock.Unlock()
+
+	if p.session != "" {
+		p.finished[p.session] = true
+	}
+	p.running = false
+}
+
+// Method to parse and check an incoming message of session, nil when it is
+// dropped.
+func (p *Party) parseMsg(session string, msgBytes []byte, from uint16, broadcast bool) tss.ParsedMessage {
 	id := tss.NewPartyID(fmt.Sprintf("%d", from), "", big.NewInt(int64(from)))
 	id.Index = p.locatePartyIndex(id)
 	msg, err := tss.ParseWireMessage(msgBytes, id, broadcast)
 	if err != nil {
 		p.Logger.Warnf("Received invalid message (%s) of %d bytes from %d: %v", base64.StdEncoding.EncodeToString(msgBytes), len(msgBytes), from, err)
-		return
+		return nil
 	}
 
 	key := msg.GetFrom().KeyInt()
 	if key == nil || key.Cmp(big.NewInt(int64(math.MaxUint16))) >= 0 {
 		p.Logger.Warnf("Message received from invalid key: %v", key)
-		return
+		return nil
 	}
 
 	claimedFrom := uint16(key.Uint64())
 	if claimedFrom != from {
 		p.Logger.Warnf("Message claimed to be from %d but was received from %d", claimedFrom, from)
+		return nil
+	}
+	if broadcast && p.checkEquivocation(session, from, msg.Type(), msgBytes) {
+		return nil
+	}
+	return msg
+}
+
+// Method to detect a party broadcasting conflicting messages. The transport
+// redelivers old messages and every signing run reuses the same message
+// types, so only differing content within one session counts as
+// equivocation.
+func (p *Party) checkEquivocation(session string, from uint16, msgType string, msgBytes []byte) bool {
+	p.broadcastsLock.Lock()
+	key := fmt.Sprintf("%s/%d/%s", session, from, msgType)
+	first, seen := p.broadcasts[key]
+	if !seen {
+		p.broadcasts[key] = append([]byte(nil), msgBytes...)
+	}
+	p.broadcastsLock.Unlock()
+
+	if !seen || bytes.Equal(first, msgBytes) {
+		return false
+	}
+	p.Logger.Warnf("Party %d equivocated on %s", from, msgType)
+	if p.Reporter != nil {
+		p.Reporter.ReportEquivocation(from, msgType, first, msgBytes)
+	}
+	return true
+}
+
+// Method to report the culprits named by a tss-lib error.
+func (p *Party) reportCulprits(tssErr *tss.Error) {
+	if p.Reporter == nil || tssErr == nil {
 		return
 	}
-	p.in <- msg
+	reason := tssErr.Error()
+	if tssErr.Cause() != nil {
+		reason = tssErr.Cause().Error()
+	}
+	for _, culprit := range tssErr.Culprits() {
+		if culprit == nil || culprit.KeyInt() == nil {
+			continue
+		}
+		p.Reporter.ReportInvalidShare(uint16(culprit.KeyInt().Uint64()), tssErr.Task(), tssErr.Round(), reason)
+	}
 }
 
 // Method to get the threshold public key.
@@ -195,9 +354,43 @@ func (p *Party) Init(parties []uint16, threshold int, sendMsg func(msg []byte, i
 	p.Id.Index = p.locatePartyIndex(p.Id)
 	p.sendMsg = sendMsg
 	p.closeChan = make(chan struct{})
+	p.broadcastsLock.Lock()
+	p.broadcasts = make(map[string][]byte)
+	p.broadcastsLock.Unlock()
 	go p.sendMessages()
 }
 
+// SignerSet picks the parties signing a message: the threshold+1 lowest IDs
+// among those available, whatever the order in which they answered. Signing
+// hangs unless every signer runs with the same set, and validators may see
+// different parties available, so one proposes the set for all to follow.
+func SignerSet(available []uint16, threshold int) ([]uint16, error) {
+	if len(available) < threshold+1 {
+		return nil, fmt.Errorf("only %d parties available, %d needed to sign", len(available), threshold+1)
+	}
+	signers := append([]uint16(nil), available...)
+	sort.Slice(signers, func(i, j int) bool { return signers[i] < signers[j] })
+	return signers[:threshold+1], nil
+}
+
+// Method to re-index the key share for the parties the party was initialized
+// with. DKG indexes the share by every party; signing with fewer of them
+// needs the share restricted to the signers, and tss-lib panics on a signer
+// the share does not know.
+func (p *Party) signerShareData() (keygen.LocalPartySaveData, error) {
+	known := make(map[string]bool, len(p.shareData.Ks))
+	for _, k := range p.shareData.Ks {
+		known[k.String()] = true
+	}
+	signers := p.params.Parties().IDs()
+	for _, id := range signers {
+		if !known[id.KeyInt().String()] {
+			return keygen.LocalPartySaveData{}, fmt.Errorf("party %s took no part in DKG", id.Id)
+		}
+	}
+	return keygen.BuildLocalSaveDataSubset(*p.shareData, signers), nil
+}
+
 // Helper function to create party IDs from numbers.
 func partyIDsFromNumbers(parties []uint16) []*tss.PartyID {
 	var partyIDs []*tss.PartyID
@@ -231,20 +424,34 @@ func (p *Party) sendMessages() {
 	}
 }
 
+// SharePath returns the file holding the party's key share. It is named by
+// the party's ID rather than its position among the parties, which changes
+// with the registry, so that validators sharing ShareDir keep apart.
+func (p *Party) SharePath() string {
+	return filepath.Join(p.ShareDir, "localsavedata_eddsa"+p.ID().Id)
+}
+
 // Method to save local party save data to a file.
 func (p *Party) SaveLocalPartySaveData(shareData []byte) {
-	WriteToFile("localsavedata_eddsa"+strconv.Itoa(p.ID().Index), shareData)
+	if p.ShareDir != "" {
+		if err := os.MkdirAll(p.ShareDir, 0o700); err != nil {
+			p.Logger.Errorf("Failed to create key share directory: %v", err)
+			return
+		}
+	}
+	if err := WriteToFile(p.SharePath(), shareData); err != nil {
+		p.Logger.Errorf("Failed to save key share: %v", err)
+	}
 }
 
-// Method to load local party save data from a file.
-func (p *Party) LoadLocalPartySaveData() {
-	shareData, err := ReadFromFile("localsavedata_eddsa" + strconv.Itoa(p.ID().Index))
+// Method to load local party save data from a file. The party need not be
+// initialized.
+func (p *Party) LoadLocalPartySaveData() error {
+	shareData, err := ReadFromFile(p.SharePath())
 	if err != nil {
-		p.Logger.Debugf("Failed to load data", err)
-		return
-	} else {
-		p.SetShareData(shareData)
+		return fmt.Errorf("failed to load key share: %w", err)
 	}
+	return p.SetShareData(shareData)
 }
 
 // Function to compute the SHA-256 digest of input data.
@@ -278,7 +485,7 @@ func copyBytes(aB []byte) *[32]byte {
 
 // Function to write data to a file.
 func WriteToFile(filename string, data []byte) error {
-	err := os.WriteFile(filename, data, 0644)
+	err := os.WriteFile(filename, data, 0600)
 	if err != nil {
 		return err
 	}
@@ -296,8 +503,7 @@ func ReadFromFile(filename string) ([]byte, error) {
 
 // Method to get share data from a file.
 func (p *Party) GetShareData() (*keygen.LocalPartySaveData, error) {
-	fileName := fmt.Sprintf("localsavedata_eddsa%d", p.ID().Index)
-	file, err := os.Open(fileName)
+	file, err := os.Open(p.SharePath())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open key share file: %w", err)
 	}
@@ -72,7 +72,7 @@ func (audit *SecurityAuditSuite) testThresholdSecurity(t *testing.T) {
 
 	// Test 1: Insufficient parties cannot complete DKG
 	t.Run("Insufficient_Parties_DKG", func(t *testing.T) {
-		singleParty := NewParty(1, audit.suite.createLogger("insufficient_test"))
+		singleParty := newParty(audit.t, 1, audit.suite.createLogger("insufficient_test"))
 		singleParty.Init([]uint16{}, testThreshold, func([]byte, bool, uint16) {})
 
 		_, err := singleParty.KeyGen(ctx)
@@ -85,7 +85,7 @@ func (audit *SecurityAuditSuite) testThresholdSecurity(t *testing.T) {
 		// Setup minimal parties (below threshold)
 		belowThresholdParties := make([]*Party, testThreshold-1)
 		for i := 0; i < testThreshold-1; i++ {
-			belowThresholdParties[i] = NewParty(uint16(i+1), audit.suite.createLogger(fmt.Sprintf("below_thresh_%d", i+1)))
+			belowThresholdParties[i] = newParty(audit.t, uint16(i+1), audit.suite.createLogger(fmt.Sprintf("below_thresh_%d", i+1)))
 		}
 
 		// Try to perform operations with insufficient parties
@@ -102,7 +102,7 @@ func (audit *SecurityAuditSuite) testThresholdSecurity(t *testing.T) {
 	t.Run("Exact_Threshold_Success", func(t *testing.T) {
 		thresholdParties := make([]*Party, testThreshold)
 		for i := 0; i < testThreshold; i++ {
-			thresholdParties[i] = NewParty(uint16(i+1), audit.suite.createLogger(fmt.Sprintf("exact_thresh_%d", i+1)))
+			thresholdParties[i] = newParty(audit.t, uint16(i+1), audit.suite.createLogger(fmt.Sprintf("exact_thresh_%d", i+1)))
 		}
 
 		// Setup communication
@@ -237,7 +237,7 @@ func (audit *SecurityAuditSuite) testKeyLeakagePrevention(t *testing.T) {
 		require.NoError(t, err)
 
 		// Try to sign with single share
-		singleParty := NewParty(1, audit.suite.createLogger("single_share_test"))
+		singleParty := newParty(audit.t, 1, audit.suite.createLogger("single_share_test"))
 		singleParty.Init([]uint16{}, testThreshold, func([]byte, bool, uint16) {})
 		singleParty.SetShareData(shares[0])
 
@@ -377,7 +377,7 @@ func (audit *SecurityAuditSuite) testReplayAttackPrevention(t *testing.T) {
 		// Now replay captured messages in new DKG session
 		replayParties := make([]*Party, testValidators)
 		for j := 0; j < testValidators; j++ {
-			replayParties[j] = NewParty(uint16(j+1), audit.suite.createLogger(fmt.Sprintf("replay_%d", j+1)))
+			replayParties[j] = newParty(audit.t, uint16(j+1), audit.suite.createLogger(fmt.Sprintf("replay_%d", j+1)))
 		}
 
 		// Replay all captured messages
@@ -3,6 +3,7 @@ package ecdsa
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/base64"
 	"fmt"
 	"log"
@@ -14,21 +15,30 @@ import (
 	"github.com/decred/dcrd/dcrec/edwards/v2"
 )
 
-// Sign generates a signature for the given message hash using threshold ECDSA.
-func (p *Party) Sign(ctx context.Context, msgHash []byte) ([]byte, error) {
+// Sign generates a threshold EdDSA signature over msg, which may be any length
+// and is signed as is: the signature verifies with ed25519.Verify(pk, msg, sig).
+func (p *Party) Sign(ctx context.Context, msg []byte) ([]byte, error) {
 	if p.shareData == nil {
 		return nil, fmt.Errorf("must call SetShareData() before attempting to sign")
 	}
+	shareData, err := p.signerShareData()
+	if err != nil {
+		close(p.closeChan)
+		p.endSession()
+		return nil, err
+	}
 
 	log.Println("[INFO] Starting signing process")
 	defer log.Println("[INFO] Signing process completed")
 	defer close(p.closeChan)
+	defer p.endSession()
 
 	end := make(chan *common.SignatureData, 1)
-	msgToSign := big.NewInt(0).SetBytes(msgHash)
+	msgToSign := big.NewInt(0).SetBytes(msg)
 
-	// Initialize local signing party
-	party := signing.NewLocalParty(msgToSign, p.params, *p.shareData, p.out, end)
+	// Initialize local signing party. tss-lib carries the message as a big.Int,
+	// which drops leading zero bytes; the full length restores them
+	party := signing.NewLocalParty(msgToSign, p.params, shareData, p.out, end, len(msg))
 
 	var endWG sync.WaitGroup
 	endWG.Add(1)
@@ -37,6 +47,7 @@ func (p *Party) Sign(ctx context.Context, msgHash []byte) ([]byte, error) {
 		defer endWG.Done()
 		if err := party.Start(); err != nil {
 			log.Printf("[ERROR] Failed signing: %v\n", err)
+			p.reportCulprits(err)
 		}
 	}()
 
@@ -49,9 +60,9 @@ func (p *Party) Sign(ctx context.Context, msgHash []byte) ([]byte, error) {
 
 		case sigOut := <-end:
 			// Validate the signed message
-			if !bytes.Equal(sigOut.M, msgToSign.Bytes()) {
+			if !bytes.Equal(sigOut.M, msg) {
 				return nil, fmt.Errorf("message mismatch: expected %s, got %s",
-					base64.StdEncoding.EncodeToString(msgHash),
+					base64.StdEncoding.EncodeToString(msg),
 					base64.StdEncoding.EncodeToString(sigOut.M))
 			}
 
@@ -77,9 +88,29 @@ func (p *Party) Sign(ctx context.Context, msgHash []byte) ([]byte, error) {
 			log.Printf("[INFO] Received message from %s\n", routing.From.Id)
 			if ok, err := party.UpdateFromBytes(raw, routing.From, routing.IsBroadcast); !ok {
 				log.Printf("[WARNING] Error updating party state: %v\n", err)
+				p.reportCulprits(err)
 				continue
 			}
 		}
 	}
 
 }
+
+// SignSolanaMessage signs a serialized Solana transaction message. Solana
+// verifies Ed25519 over the raw message bytes, so the message must not be
+// hashed first; the signature is checked against the threshold key before it
+// is returned.
+func (p *Party) SignSolanaMessage(ctx context.Context, msg []byte) ([]byte, error) {
+	sig, err := p.Sign(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := p.ThresholdPK()
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(pk, msg, sig) {
+		return nil, fmt.Errorf("threshold signature does not verify over the message")
+	}
+	return sig, nil
+}
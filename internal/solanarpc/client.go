@@ -0,0 +1,205 @@
+// Package solanarpc talks to a Solana cluster through SolanaClient, backed by
+// an RPC node or, offline, by an in-memory Fake
+package solanarpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+var (
+	// ErrAccountNotFound is returned by GetAccount for accounts that do not exist
+	ErrAccountNotFound = errors.New("account not found")
+	// ErrTransactionFailed wraps the error of a transaction that failed on-chain
+	ErrTransactionFailed = errors.New("transaction failed")
+	// ErrBlockhashNotFound is returned for unknown or expired blockhashes
+	ErrBlockhashNotFound = errors.New("blockhash not found")
+	// ErrAlreadyProcessed is returned when a transaction is sent twice
+	ErrAlreadyProcessed = errors.New("transaction already processed")
+)
+
+// SolanaClient is the part of the cluster API that submission needs
+type SolanaClient interface {
+	// LatestBlockhash returns a recent blockhash to build transactions with
+	LatestBlockhash(ctx context.Context, commitment rpc.CommitmentType) (Blockhash, error)
+	// Slot returns the current slot, which lookup tables are created at
+	Slot(ctx context.Context, commitment rpc.CommitmentType) (uint64, error)
+	// BlockHeight returns the current block height, which blockhash expiry is measured in
+	BlockHeight(ctx context.Context, commitment rpc.CommitmentType) (uint64, error)
+	// SendTransaction submits a signed transaction after a preflight
+	// simulation. Transactions the cluster rejects give an error wrapping
+	// ErrTransactionFailed, ErrBlockhashNotFound or ErrAlreadyProcessed; other
+	// errors leave open whether the transaction was delivered.
+	SendTransaction(ctx context.Context, tx *solana.Transaction) (solana.Signature, error)
+	// SimulateTransaction runs tx, verifying its signatures, without committing it
+	SimulateTransaction(ctx context.Context, tx *solana.Transaction) (*Simulation, error)
+	// Confirm reports whether the transaction reached commitment. It returns
+	// false for transactions the cluster has not seen yet and an error
+	// wrapping ErrTransactionFailed for transactions that failed.
+	Confirm(ctx context.Context, signature solana.Signature, commitment rpc.CommitmentType) (bool, error)
+	// GetAccount returns an account, or ErrAccountNotFound
+	GetAccount(ctx context.Context, account solana.PublicKey) (*Account, error)
+	// MinimumBalanceForRentExemption returns the lamports an account of size
+	// bytes needs to be exempt from rent
+	MinimumBalanceForRentExemption(ctx context.Context, size uint64) (uint64, error)
+	// RecentPrioritizationFees returns, for each recent slot, the lowest
+	// compute unit price paid by the transactions writing any of accounts,
+	// or by any transaction when no accounts are given
+	RecentPrioritizationFees(ctx context.Context, accounts []solana.PublicKey) ([]PrioritizationFee, error)
+}
+
+// Blockhash is a recent blockhash and the last block height it is valid at
+type Blockhash struct {
+	Hash                 solana.Hash
+	LastValidBlockHeight uint64
+}
+
+// Simulation is the outcome of a simulated transaction; Err is nil on success
+type Simulation struct {
+	Err           error
+	Logs          []string
+	UnitsConsumed uint64
+}
+
+// PrioritizationFee is the compute unit price, in micro-lamports, that
+// transactions paid to land in a slot
+type PrioritizationFee struct {
+	Slot      uint64
+	UnitPrice uint64
+}
+
+// Account is the state of an account
+type Account struct {
+	Lamports   uint64
+	Owner      solana.PublicKey
+	Data       []byte
+	Executable bool
+}
+
+// commitments orders the commitment levels, processed being the weakest
+var commitments = map[rpc.CommitmentType]int{
+	rpc.CommitmentProcessed: 0,
+	rpc.CommitmentConfirmed: 1,
+	rpc.CommitmentFinalized: 2,
+}
+
+// reached reports whether status satisfies commitment
+func reached(status rpc.ConfirmationStatusType, commitment rpc.CommitmentType) bool {
+	have, ok := commitments[rpc.CommitmentType(status)]
+	return ok && have >= commitments[commitment]
+}
+
+// RPC is a SolanaClient backed by a JSON-RPC node
+type RPC struct {
+	client *rpc.Client
+}
+
+var _ SolanaClient = (*RPC)(nil)
+
+// New connects to the RPC node at endpoint
+func New(endpoint string) *RPC {
+	return &RPC{client: rpc.New(endpoint)}
+}
+
+func (c *RPC) LatestBlockhash(ctx context.Context, commitment rpc.CommitmentType) (Blockhash, error) {
+	out, err := c.client.GetLatestBlockhash(ctx, commitment)
+	if err != nil {
+		return Blockhash{}, err
+	}
+	return Blockhash{Hash: out.Value.Blockhash, LastValidBlockHeight: out.Value.LastValidBlockHeight}, nil
+}
+
+func (c *RPC) Slot(ctx context.Context, commitment rpc.CommitmentType) (uint64, error) {
+	return c.client.GetSlot(ctx, commitment)
+}
+
+func (c *RPC) BlockHeight(ctx context.Context, commitment rpc.CommitmentType) (uint64, error) {
+	return c.client.GetBlockHeight(ctx, commitment)
+}
+
+func (c *RPC) SendTransaction(ctx context.Context, tx *solana.Transaction) (solana.Signature, error) {
+	signature, err := c.client.SendTransactionWithOpts(ctx, tx, rpc.TransactionOpts{
+		PreflightCommitment: rpc.CommitmentFinalized,
+	})
+	// Errors returned by the node itself mean the transaction was rejected
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		switch {
+		case strings.Contains(rpcErr.Message, "Blockhash not found"):
+			return signature, fmt.Errorf("%w: %v", ErrBlockhashNotFound, err)
+		case strings.Contains(rpcErr.Message, "already been processed"):
+			return signature, fmt.Errorf("%w: %v", ErrAlreadyProcessed, err)
+		default:
+			return signature, fmt.Errorf("%w: %v", ErrTransactionFailed, err)
+		}
+	}
+	return signature, err
+}
+
+func (c *RPC) SimulateTransaction(ctx context.Context, tx *solana.Transaction) (*Simulation, error) {
+	out, err := c.client.SimulateTransactionWithOpts(ctx, tx, &rpc.SimulateTransactionOpts{SigVerify: true})
+	if err != nil {
+		return nil, err
+	}
+	simulation := &Simulation{Logs: out.Value.Logs}
+	if out.Value.Err != nil {
+		simulation.Err = fmt.Errorf("%w: %v", ErrTransactionFailed, out.Value.Err)
+	}
+	if out.Value.UnitsConsumed != nil {
+		simulation.UnitsConsumed = *out.Value.UnitsConsumed
+	}
+	return simulation, nil
+}
+
+func (c *RPC) Confirm(ctx context.Context, signature solana.Signature, commitment rpc.CommitmentType) (bool, error) {
+	out, err := c.client.GetSignatureStatuses(ctx, true, signature)
+	if err != nil {
+		return false, err
+	}
+	if len(out.Value) == 0 || out.Value[0] == nil {
+		return false, nil
+	}
+	status := out.Value[0]
+	if status.Err != nil {
+		return false, fmt.Errorf("%w: %v", ErrTransactionFailed, status.Err)
+	}
+	return reached(status.ConfirmationStatus, commitment), nil
+}
+
+func (c *RPC) GetAccount(ctx context.Context, account solana.PublicKey) (*Account, error) {
+	out, err := c.client.GetAccountInfo(ctx, account)
+	if errors.Is(err, rpc.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, account)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		Lamports:   out.Value.Lamports,
+		Owner:      out.Value.Owner,
+		Data:       out.Value.Data.GetBinary(),
+		Executable: out.Value.Executable,
+	}, nil
+}
+
+func (c *RPC) MinimumBalanceForRentExemption(ctx context.Context, size uint64) (uint64, error) {
+	return c.client.GetMinimumBalanceForRentExemption(ctx, size, rpc.CommitmentFinalized)
+}
+
+func (c *RPC) RecentPrioritizationFees(ctx context.Context, accounts []solana.PublicKey) ([]PrioritizationFee, error) {
+	out, err := c.client.GetRecentPrioritizationFees(ctx, accounts)
+	if err != nil {
+		return nil, err
+	}
+	fees := make([]PrioritizationFee, 0, len(out))
+	for _, fee := range out {
+		fees = append(fees, PrioritizationFee{Slot: fee.Slot, UnitPrice: fee.PrioritizationFee})
+	}
+	return fees, nil
+}
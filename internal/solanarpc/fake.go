@@ -0,0 +1,589 @@
+package solanarpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	// LamportsPerSignature is the fee Fake charges the fee payer per signature
+	LamportsPerSignature = 5000
+	// BlockhashValidity is how many blocks a blockhash stays valid for
+	BlockhashValidity = 150
+	// confirmedDepth and finalizedDepth are the blocks a transaction needs on
+	// top of it to be confirmed and finalized
+	confirmedDepth = 1
+	finalizedDepth = 32
+	// recentSlots is how many slots back a lookup table can be created at
+	recentSlots = 512
+)
+
+// Fake is an in-memory SolanaClient. It checks transactions the way a cluster
+// would: Ed25519 signatures, blockhash expiry, duplicates and fee payer
+// balances, priority fees included. It runs system transfers, durable nonces,
+// compute budgets and address lookup tables, v0 transactions using them, and
+// the validate_payment_distribution checks of the payment_validator program,
+// and rejects other programs.
+// Blocks are produced only by Advance, so tests decide when time passes, and
+// every block is a slot.
+type Fake struct {
+	mu          sync.Mutex
+	programID   solana.PublicKey
+	blockHeight uint64
+	latest      solana.Hash
+	blockhashes map[solana.Hash]uint64 // last valid block height
+	accounts    map[solana.PublicKey]Account
+	landed      map[solana.Signature]uint64 // block height a transaction landed at
+	sent        []*solana.Transaction
+	drop        int
+	fees        []paidFee
+	congestion  paidFee
+}
+
+// paidFee is the compute unit price a transaction landing at height paid
+// for writing accounts
+type paidFee struct {
+	height   uint64
+	price    uint64
+	writable []solana.PublicKey
+}
+
+var _ SolanaClient = (*Fake)(nil)
+
+// NewFake returns a cluster at block height 1 running the payment_validator
+// program at programID
+func NewFake(programID solana.PublicKey) *Fake {
+	f := &Fake{
+		programID:   programID,
+		blockhashes: make(map[solana.Hash]uint64),
+		accounts:    make(map[solana.PublicKey]Account),
+		landed:      make(map[solana.Signature]uint64),
+	}
+	f.advance(1)
+	return f
+}
+
+// Advance produces blocks, each with a new blockhash
+func (f *Fake) Advance(blocks uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advance(blocks)
+}
+
+func (f *Fake) advance(blocks uint64) {
+	for i := uint64(0); i < blocks; i++ {
+		f.blockHeight++
+		f.latest = sha256.Sum256(binary.LittleEndian.AppendUint64([]byte("fake blockhash"), f.blockHeight))
+		f.blockhashes[f.latest] = f.blockHeight + BlockhashValidity
+		if f.congestion.price > 0 {
+			traffic := f.congestion
+			traffic.height = f.blockHeight
+			f.fees = append(f.fees, traffic)
+		}
+	}
+}
+
+func (f *Fake) Slot(_ context.Context, _ rpc.CommitmentType) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.blockHeight, nil
+}
+
+func (f *Fake) BlockHeight(_ context.Context, _ rpc.CommitmentType) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.blockHeight, nil
+}
+
+// Fund credits lamports to account, creating it if needed
+func (f *Fake) Fund(account solana.PublicKey, lamports uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a := f.accounts[account]
+	a.Lamports += lamports
+	f.accounts[account] = a
+}
+
+// DropNext makes the next n accepted transactions vanish without landing, as
+// when a leader drops them during congestion
+func (f *Fake) DropNext(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.drop = n
+}
+
+// Congest fills every new block with traffic paying price micro-lamports per
+// compute unit to write accounts, or any account when none are given. Leaders
+// then drop transactions writing those accounts for less, the way they do
+// during congestion. A zero price ends the congestion.
+func (f *Fake) Congest(price uint64, accounts ...solana.PublicKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.congestion = paidFee{price: price, writable: accounts}
+}
+
+// Sent returns the transactions the cluster accepted, in order
+func (f *Fake) Sent() []*solana.Transaction {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*solana.Transaction(nil), f.sent...)
+}
+
+func (f *Fake) LatestBlockhash(_ context.Context, _ rpc.CommitmentType) (Blockhash, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return Blockhash{Hash: f.latest, LastValidBlockHeight: f.blockhashes[f.latest]}, nil
+}
+
+func (f *Fake) SendTransaction(_ context.Context, tx *solana.Transaction) (solana.Signature, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(tx.Signatures) == 0 {
+		return solana.Signature{}, fmt.Errorf("%w: transaction is not signed", ErrTransactionFailed)
+	}
+	signature := tx.Signatures[0]
+	if _, ok := f.landed[signature]; ok {
+		return solana.Signature{}, fmt.Errorf("%w: %s", ErrAlreadyProcessed, signature)
+	}
+	received, err := f.receive(tx)
+	if err != nil {
+		return solana.Signature{}, err
+	}
+	accounts, _, err := f.execute(received)
+	if err != nil {
+		return solana.Signature{}, err
+	}
+	budget, _, err := solanatx.ParseComputeBudget(received.Message)
+	if err != nil {
+		return solana.Signature{}, err
+	}
+	writable, err := received.Message.Writable()
+	if err != nil {
+		return solana.Signature{}, err
+	}
+	if f.drop > 0 {
+		f.drop--
+		return signature, nil
+	}
+	if budget.UnitPrice < f.congestion.price && f.congestion.writes(writable) {
+		return signature, nil
+	}
+	f.accounts = accounts
+	f.landed[signature] = f.blockHeight
+	f.sent = append(f.sent, tx)
+	f.fees = append(f.fees, paidFee{height: f.blockHeight, price: budget.UnitPrice, writable: writable})
+	return signature, nil
+}
+
+func (f *Fake) SimulateTransaction(_ context.Context, tx *solana.Transaction) (*Simulation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	received, err := f.receive(tx)
+	if err != nil {
+		return &Simulation{Err: err}, nil
+	}
+	_, logs, err := f.execute(received)
+	return &Simulation{Err: err, Logs: logs}, nil
+}
+
+func (f *Fake) Confirm(_ context.Context, signature solana.Signature, commitment rpc.CommitmentType) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	height, ok := f.landed[signature]
+	if !ok {
+		return false, nil
+	}
+	status := rpc.ConfirmationStatusProcessed
+	switch depth := f.blockHeight - height; {
+	case depth >= finalizedDepth:
+		status = rpc.ConfirmationStatusFinalized
+	case depth >= confirmedDepth:
+		status = rpc.ConfirmationStatusConfirmed
+	}
+	return reached(status, commitment), nil
+}
+
+func (f *Fake) MinimumBalanceForRentExemption(_ context.Context, size uint64) (uint64, error) {
+	return rentExemption(size), nil
+}
+
+// RecentPrioritizationFees reports the blocks that are still valid to
+// reference, by height, zero for those without matching transactions
+func (f *Fake) RecentPrioritizationFees(_ context.Context, accounts []solana.PublicKey) ([]PrioritizationFee, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	first := uint64(1)
+	if f.blockHeight > BlockhashValidity {
+		first = f.blockHeight - BlockhashValidity + 1
+	}
+	lowest := make(map[uint64]uint64)
+	for _, fee := range f.fees {
+		if fee.height < first || !fee.writes(accounts) {
+			continue
+		}
+		if price, ok := lowest[fee.height]; !ok || fee.price < price {
+			lowest[fee.height] = fee.price
+		}
+	}
+	var fees []PrioritizationFee
+	for height := first; height <= f.blockHeight; height++ {
+		fees = append(fees, PrioritizationFee{Slot: height, UnitPrice: lowest[height]})
+	}
+	return fees, nil
+}
+
+// writes reports whether the fee was paid for writing any of accounts; no
+// accounts on either side match everything
+func (p paidFee) writes(accounts []solana.PublicKey) bool {
+	if len(p.writable) == 0 || len(accounts) == 0 {
+		return true
+	}
+	for _, account := range accounts {
+		if solana.PublicKeySlice(p.writable).Has(account) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fake) GetAccount(_ context.Context, account solana.PublicKey) (*Account, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.accounts[account]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, account)
+	}
+	a.Data = append([]byte(nil), a.Data...)
+	return &a, nil
+}
+
+// receive decodes tx as the cluster receives it, over the wire, and loads
+// the addresses its lookup tables held before the current block
+func (f *Fake) receive(tx *solana.Transaction) (*solana.Transaction, error) {
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTransactionFailed, err)
+	}
+	received, err := solana.TransactionFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid transaction: %v", ErrTransactionFailed, err)
+	}
+	if len(received.Message.AddressTableLookups) == 0 {
+		return received, nil
+	}
+
+	tables := make(map[solana.PublicKey]solana.PublicKeySlice)
+	for _, lookup := range received.Message.AddressTableLookups {
+		key := lookup.AccountKey
+		account := f.accounts[key]
+		if !account.Owner.Equals(solanatx.LookupTableProgramID) {
+			return nil, fmt.Errorf("%w: lookup table %s not found", ErrTransactionFailed, key)
+		}
+		table, err := solanatx.ParseLookupTable(key, account.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrTransactionFailed, err)
+		}
+		// Addresses added in the current block are not usable until the next
+		if binary.LittleEndian.Uint64(account.Data[12:]) == f.blockHeight {
+			table.Addresses = table.Addresses[:account.Data[20]]
+		}
+		tables[key] = table.Addresses
+	}
+	if err := received.Message.SetAddressTables(tables); err != nil {
+		return nil, err
+	}
+	if err := received.Message.ResolveLookups(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTransactionFailed, err)
+	}
+	return received, nil
+}
+
+// execute runs a received transaction against a copy of the accounts and
+// returns the copy with the transaction applied
+func (f *Fake) execute(tx *solana.Transaction) (map[solana.PublicKey]Account, []string, error) {
+	message := tx.Message
+	if int(message.Header.NumRequiredSignatures) != len(tx.Signatures) || len(tx.Signatures) == 0 {
+		return nil, nil, fmt.Errorf("%w: %d signatures for %d signers", ErrTransactionFailed, len(tx.Signatures), message.Header.NumRequiredSignatures)
+	}
+	if err := tx.VerifySignatures(); err != nil {
+		return nil, nil, fmt.Errorf("%w: signature verification failed: %v", ErrTransactionFailed, err)
+	}
+	if last, ok := f.blockhashes[message.RecentBlockhash]; (!ok || f.blockHeight > last) && !durableNonce(f.accounts, message) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrBlockhashNotFound, message.RecentBlockhash)
+	}
+
+	accounts := make(map[solana.PublicKey]Account, len(f.accounts))
+	for key, a := range f.accounts {
+		accounts[key] = a
+	}
+	budget, n, err := solanatx.ParseComputeBudget(message)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrTransactionFailed, err)
+	}
+	feePayer := message.AccountKeys[0]
+	fee := uint64(LamportsPerSignature*len(tx.Signatures)) + budget.PriorityFee(n)
+	payer := accounts[feePayer]
+	if payer.Lamports < fee {
+		return nil, nil, fmt.Errorf("%w: fee payer %s cannot pay the %d lamport fee", ErrTransactionFailed, feePayer, fee)
+	}
+	payer.Lamports -= fee
+	accounts[feePayer] = payer
+
+	var logs []string
+	for i, ix := range message.Instructions {
+		program, err := message.Program(ix.ProgramIDIndex)
+		if err != nil {
+			return nil, logs, err
+		}
+		keys, err := ix.ResolveInstructionAccounts(&message)
+		if err != nil {
+			return nil, logs, err
+		}
+		logs = append(logs, fmt.Sprintf("Program %s invoke [1]", program))
+		switch {
+		case program.Equals(solana.SystemProgramID):
+			err = f.systemInstruction(accounts, keys, ix.Data)
+		case program.Equals(solanatx.LookupTableProgramID):
+			err = f.lookupTableInstruction(accounts, keys, ix.Data)
+		case program.Equals(solana.ComputeBudget):
+			// Read by ParseComputeBudget before the fee was charged
+		case program.Equals(f.programID):
+			err = validatePayment(keys, ix.Data)
+		default:
+			err = fmt.Errorf("program %s is not supported by the fake", program)
+		}
+		if err != nil {
+			logs = append(logs, fmt.Sprintf("Program %s failed: %v", program, err))
+			return nil, logs, fmt.Errorf("%w: instruction %d: %v", ErrTransactionFailed, i, err)
+		}
+		logs = append(logs, fmt.Sprintf("Program %s success", program))
+	}
+	return accounts, logs, nil
+}
+
+// systemInstruction runs the system program's transfers and the creation,
+// initialization and advancing of nonce accounts
+func (f *Fake) systemInstruction(accounts map[solana.PublicKey]Account, keys []*solana.AccountMeta, data []byte) error {
+	instruction, err := system.DecodeInstruction(keys, data)
+	if err != nil {
+		return err
+	}
+	switch ix := instruction.Impl.(type) {
+	case *system.Transfer:
+		from, to := ix.GetFundingAccount(), ix.GetRecipientAccount()
+		if !from.IsSigner || !from.IsWritable || !to.IsWritable {
+			return errors.New("transfer accounts must be writable and the source must sign")
+		}
+		return move(accounts, from.PublicKey, to.PublicKey, *ix.Lamports)
+
+	case *system.CreateAccount:
+		from, created := ix.GetFundingAccount(), ix.GetNewAccount()
+		if !from.IsSigner || !created.IsSigner {
+			return errors.New("the funding and the new account must sign")
+		}
+		if existing, ok := accounts[created.PublicKey]; ok && (existing.Lamports > 0 || len(existing.Data) > 0) {
+			return fmt.Errorf("account %s already in use", created.PublicKey)
+		}
+		if *ix.Lamports < rentExemption(*ix.Space) {
+			return fmt.Errorf("%d lamports do not make %d bytes rent exempt", *ix.Lamports, *ix.Space)
+		}
+		if err := move(accounts, from.PublicKey, created.PublicKey, *ix.Lamports); err != nil {
+			return err
+		}
+		account := accounts[created.PublicKey]
+		account.Owner, account.Data = *ix.Owner, make([]byte, *ix.Space)
+		accounts[created.PublicKey] = account
+		return nil
+
+	case *system.InitializeNonceAccount:
+		key := ix.GetNonceAccount().PublicKey
+		account := accounts[key]
+		if !account.Owner.Equals(solana.SystemProgramID) || len(account.Data) != solanatx.NonceAccountSize {
+			return fmt.Errorf("%s is not a nonce account", key)
+		}
+		if binary.LittleEndian.Uint32(account.Data[4:]) != 0 {
+			return fmt.Errorf("nonce account %s is already initialized", key)
+		}
+		account.Data = f.nonceData(*ix.Authorized)
+		accounts[key] = account
+		return nil
+
+	case *system.AdvanceNonceAccount:
+		key := ix.GetNonceAccount().PublicKey
+		nonce, err := solanatx.ParseNonceAccount(key, accounts[key].Data)
+		if err != nil {
+			return err
+		}
+		authority := ix.GetNonceAuthorityAccount()
+		if !authority.IsSigner || !authority.PublicKey.Equals(nonce.Authority) {
+			return fmt.Errorf("nonce account %s must be advanced by its authority %s", key, nonce.Authority)
+		}
+		data := f.nonceData(nonce.Authority)
+		if nonce.Value == solana.HashFromBytes(data[40:72]) {
+			return fmt.Errorf("nonce account %s was already advanced in this block", key)
+		}
+		account := accounts[key]
+		account.Data = data
+		accounts[key] = account
+		return nil
+
+	default:
+		return fmt.Errorf("system instruction %d is not supported by the fake", instruction.TypeID.Uint32())
+	}
+}
+
+// nonceData is an initialized nonce account, whose value is derived from the
+// latest blockhash as the cluster does
+func (f *Fake) nonceData(authority solana.PublicKey) []byte {
+	value := sha256.Sum256(append([]byte("DURABLE_NONCE"), f.latest[:]...))
+	data := make([]byte, 0, solanatx.NonceAccountSize)
+	data = binary.LittleEndian.AppendUint32(data, 1) // version
+	data = binary.LittleEndian.AppendUint32(data, 1) // initialized
+	data = append(data, authority[:]...)
+	data = append(data, value[:]...)
+	return binary.LittleEndian.AppendUint64(data, LamportsPerSignature)
+}
+
+// durableNonce reports whether tx is valid over a durable nonce: its first
+// instruction advances a nonce account currently holding its blockhash
+func durableNonce(accounts map[solana.PublicKey]Account, message solana.Message) bool {
+	key, ok := solanatx.DurableNonceAccount(message)
+	if !ok {
+		return false
+	}
+	nonce, err := solanatx.ParseNonceAccount(key, accounts[key].Data)
+	return err == nil && nonce.Value == message.RecentBlockhash
+}
+
+// lookupTableInstruction creates and extends address lookup tables
+func (f *Fake) lookupTableInstruction(accounts map[solana.PublicKey]Account, keys []*solana.AccountMeta, data []byte) error {
+	if len(data) < 4 || len(keys) < 3 {
+		return errors.New("invalid lookup table instruction")
+	}
+	table, authority, payer := keys[0], keys[1], keys[2]
+	if !table.IsWritable || !payer.IsSigner || !payer.IsWritable {
+		return errors.New("the table must be writable and the payer a writable signer")
+	}
+	switch binary.LittleEndian.Uint32(data) {
+	case 0: // CreateLookupTable
+		if len(data) != 13 {
+			return errors.New("invalid lookup table creation")
+		}
+		slot, bump := binary.LittleEndian.Uint64(data[4:]), data[12]
+		if slot > f.blockHeight || f.blockHeight-slot >= recentSlots {
+			return fmt.Errorf("%d is not a recent slot", slot)
+		}
+		address, want, err := solanatx.LookupTableAddress(authority.PublicKey, slot)
+		if err != nil || !address.Equals(table.PublicKey) || bump != want {
+			return fmt.Errorf("lookup table %s is not derived from authority %s and slot %d", table.PublicKey, authority.PublicKey, slot)
+		}
+		if existing, ok := accounts[table.PublicKey]; ok && (existing.Lamports > 0 || len(existing.Data) > 0) {
+			return fmt.Errorf("account %s already in use", table.PublicKey)
+		}
+		tableData := lookupTableData(authority.PublicKey, 0, 0, nil)
+		if err := move(accounts, payer.PublicKey, table.PublicKey, rentExemption(uint64(len(tableData)))); err != nil {
+			return err
+		}
+		account := accounts[table.PublicKey]
+		account.Owner, account.Data = solanatx.LookupTableProgramID, tableData
+		accounts[table.PublicKey] = account
+		return nil
+
+	case 2: // ExtendLookupTable
+		if len(data) < 12 {
+			return errors.New("invalid lookup table extension")
+		}
+		n := binary.LittleEndian.Uint64(data[4:])
+		if n == 0 || uint64(len(data)) != 12+32*n {
+			return fmt.Errorf("lookup table extension of %d addresses has %d bytes", n, len(data))
+		}
+		account := accounts[table.PublicKey]
+		if !account.Owner.Equals(solanatx.LookupTableProgramID) {
+			return fmt.Errorf("%s is not a lookup table", table.PublicKey)
+		}
+		current, err := solanatx.ParseLookupTable(table.PublicKey, account.Data)
+		if err != nil {
+			return err
+		}
+		if !authority.IsSigner || !authority.PublicKey.Equals(current.Authority) {
+			return fmt.Errorf("lookup table %s must be extended by its authority %s", table.PublicKey, current.Authority)
+		}
+		if uint64(len(current.Addresses))+n > solanatx.MaxLookupTableAddresses {
+			return fmt.Errorf("lookup table %s cannot hold %d more addresses", table.PublicKey, n)
+		}
+		lastSlot, start := binary.LittleEndian.Uint64(account.Data[12:]), account.Data[20]
+		if lastSlot != f.blockHeight {
+			lastSlot, start = f.blockHeight, uint8(len(current.Addresses))
+		}
+		addresses := current.Addresses
+		for i := uint64(0); i < n; i++ {
+			addresses = append(addresses, solana.PublicKeyFromBytes(data[12+32*i:12+32*(i+1)]))
+		}
+		account.Data = lookupTableData(current.Authority, lastSlot, start, addresses)
+		accounts[table.PublicKey] = account
+		if rent := rentExemption(uint64(len(account.Data))); account.Lamports < rent {
+			return move(accounts, payer.PublicKey, table.PublicKey, rent-account.Lamports)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("lookup table instruction %d is not supported by the fake", binary.LittleEndian.Uint32(data))
+	}
+}
+
+// lookupTableData lays out an active lookup table account
+func lookupTableData(authority solana.PublicKey, lastExtendedSlot uint64, startIndex uint8, addresses []solana.PublicKey) []byte {
+	data := make([]byte, 0, solanatx.LookupTableMetaSize+32*len(addresses))
+	data = binary.LittleEndian.AppendUint32(data, 1) // lookup table
+	data = binary.LittleEndian.AppendUint64(data, math.MaxUint64)
+	data = binary.LittleEndian.AppendUint64(data, lastExtendedSlot)
+	data = append(data, startIndex, 1) // authority is set
+	data = append(data, authority[:]...)
+	data = append(data, 0, 0) // padding
+	for _, address := range addresses {
+		data = append(data, address[:]...)
+	}
+	return data
+}
+
+// move transfers lamports between accounts
+func move(accounts map[solana.PublicKey]Account, from, to solana.PublicKey, lamports uint64) error {
+	source := accounts[from]
+	if source.Lamports < lamports {
+		return fmt.Errorf("%s has %d lamports, transfer needs %d", from, source.Lamports, lamports)
+	}
+	source.Lamports -= lamports
+	accounts[from] = source
+	destination := accounts[to]
+	destination.Lamports += lamports
+	accounts[to] = destination
+	return nil
+}
+
+// rentExemption is the cluster's minimum balance for size bytes of data
+func rentExemption(size uint64) uint64 {
+	return (128 + size) * 6960
+}
+
+// validatePayment makes the checks of validate_payment_distribution in lib.rs
+func validatePayment(keys []*solana.AccountMeta, data []byte) error {
+	if len(keys) < 1 || !keys[0].IsSigner || !keys[0].IsWritable {
+		return errors.New("the sender must be a writable signer")
+	}
+	payment, err := solanatx.ParsePayment(data)
+	if err != nil {
+		return err
+	}
+	return payment.Validate()
+}
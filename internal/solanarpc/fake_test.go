@@ -0,0 +1,163 @@
+package solanarpc
+
+import (
+	"context"
+	"testing"
+
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signed builds and signs a transaction paid for by payer
+func signed(t *testing.T, payer solana.PrivateKey, blockhash solana.Hash, instructions ...solana.Instruction) *solana.Transaction {
+	t.Helper()
+	tx, err := solana.NewTransaction(instructions, blockhash, solana.TransactionPayer(payer.PublicKey()))
+	require.NoError(t, err)
+	require.NoError(t, solanatx.Sign(context.Background(), tx, payer.PublicKey(), solanatx.KeySigner(payer)))
+	return tx
+}
+
+func TestFakeRunsPaymentTransfers(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	authority := solana.NewWallet().PrivateKey
+	fake.Fund(authority.PublicKey(), 1_000_000)
+
+	alice, bob := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	payment := solanatx.Payment{TotalAmount: 300, Receivers: []solana.PublicKey{alice, bob}, Amounts: []uint64{100, 200}}
+	recent, err := fake.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	height, err := fake.BlockHeight(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	assert.Equal(t, height+BlockhashValidity, recent.LastValidBlockHeight)
+
+	txs, err := solanatx.BuildTransferTransactions(solanatx.ProgramID, authority.PublicKey(), recent.Hash, payment, nil, solanatx.ComputeBudget{})
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	tx := txs[0]
+	require.NoError(t, solanatx.Sign(ctx, tx, authority.PublicKey(), solanatx.KeySigner(authority)))
+
+	// Simulation changes nothing
+	simulation, err := fake.SimulateTransaction(ctx, tx)
+	require.NoError(t, err)
+	require.NoError(t, simulation.Err)
+	assert.Contains(t, simulation.Logs, "Program "+solanatx.ProgramID.String()+" success")
+	_, err = fake.GetAccount(ctx, alice)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+
+	signature, err := fake.SendTransaction(ctx, tx)
+	require.NoError(t, err)
+	assert.Equal(t, tx.Signatures[0], signature)
+	_, err = fake.SendTransaction(ctx, tx)
+	assert.ErrorIs(t, err, ErrAlreadyProcessed)
+
+	payer, err := fake.GetAccount(ctx, authority.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1_000_000-300-LamportsPerSignature), payer.Lamports)
+	account, err := fake.GetAccount(ctx, bob)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(200), account.Lamports)
+
+	// Commitment deepens as blocks are produced
+	for _, step := range []struct {
+		blocks                          uint64
+		processed, confirmed, finalized bool
+	}{
+		{0, true, false, false},
+		{1, true, true, false},
+		{31, true, true, true},
+	} {
+		fake.Advance(step.blocks)
+		for commitment, want := range map[rpc.CommitmentType]bool{
+			rpc.CommitmentProcessed: step.processed,
+			rpc.CommitmentConfirmed: step.confirmed,
+			rpc.CommitmentFinalized: step.finalized,
+		} {
+			ok, err := fake.Confirm(ctx, signature, commitment)
+			require.NoError(t, err)
+			assert.Equal(t, want, ok, "%s after %d blocks", commitment, step.blocks)
+		}
+	}
+	ok, err := fake.Confirm(ctx, solana.Signature{1}, rpc.CommitmentProcessed)
+	require.NoError(t, err)
+	assert.False(t, ok, "unknown transactions are not confirmed")
+	assert.Equal(t, []*solana.Transaction{tx}, fake.Sent())
+}
+
+func TestFakeRejects(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	payer := solana.NewWallet().PrivateKey
+	fake.Fund(payer.PublicKey(), 10*LamportsPerSignature)
+	recent, err := fake.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+
+	receiver := solana.NewWallet().PublicKey()
+	validate := func(p solanatx.Payment) solana.Instruction {
+		return solana.NewInstruction(solanatx.ProgramID, []*solana.AccountMeta{
+			{PublicKey: payer.PublicKey(), IsSigner: true, IsWritable: true},
+		}, p.Data())
+	}
+	transfer := func(lamports uint64) solana.Instruction {
+		tx, err := solanatx.TransferInstructions(payer.PublicKey(), nil,
+			solanatx.Payment{TotalAmount: lamports, Receivers: []solana.PublicKey{receiver}, Amounts: []uint64{lamports}})
+		require.NoError(t, err)
+		return tx[0]
+	}
+
+	// The program's checks
+	tx := signed(t, payer, recent.Hash, validate(solanatx.Payment{TotalAmount: 5, Receivers: []solana.PublicKey{receiver}, Amounts: []uint64{4}}))
+	_, err = fake.SendTransaction(ctx, tx)
+	assert.ErrorIs(t, err, ErrTransactionFailed)
+	assert.ErrorContains(t, err, "total amount does not match")
+	tx = signed(t, payer, recent.Hash, validate(solanatx.Payment{TotalAmount: 5, Receivers: []solana.PublicKey{receiver}}))
+	_, err = fake.SendTransaction(ctx, tx)
+	assert.ErrorContains(t, err, "number of receivers does not match")
+
+	// Failed transactions are not applied, and simulation reports why
+	tx = signed(t, payer, recent.Hash, transfer(1), transfer(1_000_000))
+	simulation, err := fake.SimulateTransaction(ctx, tx)
+	require.NoError(t, err)
+	assert.ErrorIs(t, simulation.Err, ErrTransactionFailed)
+	assert.ErrorContains(t, simulation.Err, "instruction 1")
+	_, err = fake.SendTransaction(ctx, tx)
+	assert.ErrorIs(t, err, ErrTransactionFailed)
+	_, err = fake.GetAccount(ctx, receiver)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+
+	// Tampered signatures
+	tx = signed(t, payer, recent.Hash, transfer(1))
+	tx.Signatures[0][0] ^= 1
+	_, err = fake.SendTransaction(ctx, tx)
+	assert.ErrorContains(t, err, "signature verification failed")
+
+	// Unknown programs
+	tx = signed(t, payer, recent.Hash, solana.NewInstruction(solana.TokenProgramID, nil, []byte{1}))
+	_, err = fake.SendTransaction(ctx, tx)
+	assert.ErrorContains(t, err, "not supported by the fake")
+
+	// Expired and unknown blockhashes
+	tx = signed(t, payer, recent.Hash, transfer(1))
+	fake.Advance(BlockhashValidity + 1)
+	_, err = fake.SendTransaction(ctx, tx)
+	assert.ErrorIs(t, err, ErrBlockhashNotFound)
+	tx = signed(t, payer, solana.Hash{1}, transfer(1))
+	_, err = fake.SendTransaction(ctx, tx)
+	assert.ErrorIs(t, err, ErrBlockhashNotFound)
+
+	// Fee payers must afford the fee
+	broke := solana.NewWallet().PrivateKey
+	recent, err = fake.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	_, err = fake.SendTransaction(ctx, signed(t, broke, recent.Hash, solana.NewInstruction(solana.SystemProgramID, nil, nil)))
+	assert.ErrorContains(t, err, "cannot pay")
+
+	account, err := fake.GetAccount(ctx, payer.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10*LamportsPerSignature), account.Lamports, "only accepted transactions are charged")
+	assert.Empty(t, fake.Sent())
+}
@@ -0,0 +1,64 @@
+package solanarpc
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// FeeEstimator prices compute units from what transactions writing the same
+// accounts recently paid to land
+type FeeEstimator struct {
+	// Percentile of the recent per-slot prices to pay, 0 to 100
+	Percentile int
+	// Min and Max bound the estimate in micro-lamports; a zero Max leaves
+	// it unbounded
+	Min uint64
+	Max uint64
+
+	client SolanaClient
+}
+
+// NewFeeEstimator returns an estimator paying the 75th percentile of recent
+// prices, unbounded
+func NewFeeEstimator(client SolanaClient) *FeeEstimator {
+	return &FeeEstimator{Percentile: 75, client: client}
+}
+
+// UnitPrice estimates the micro-lamports per compute unit a transaction
+// writing accounts should pay. The estimate is rounded up to a power of two,
+// so validators estimating moments apart almost always agree on it and build
+// the same message to sign.
+func (e *FeeEstimator) UnitPrice(ctx context.Context, accounts []solana.PublicKey) (uint64, error) {
+	if e.Percentile < 0 || e.Percentile > 100 {
+		return 0, fmt.Errorf("fee percentile %d is not between 0 and 100", e.Percentile)
+	}
+	fees, err := e.client.RecentPrioritizationFees(ctx, accounts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get recent prioritization fees: %w", err)
+	}
+
+	price := uint64(0)
+	if len(fees) > 0 {
+		prices := make([]uint64, len(fees))
+		for i, fee := range fees {
+			prices[i] = fee.UnitPrice
+		}
+		sort.Slice(prices, func(i, j int) bool { return prices[i] < prices[j] })
+		// Nearest rank: the smallest price at least Percentile% of slots paid
+		rank := (e.Percentile*len(prices) + 99) / 100
+		price = prices[max(rank, 1)-1]
+	}
+	if price > 1 && price <= 1<<63 {
+		price = 1 << bits.Len64(price-1)
+	}
+
+	price = max(price, e.Min)
+	if e.Max > 0 {
+		price = min(price, e.Max)
+	}
+	return price, nil
+}
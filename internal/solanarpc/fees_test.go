@@ -0,0 +1,85 @@
+package solanarpc
+
+import (
+	"context"
+	"testing"
+
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeEstimator(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	busy, quiet := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	e := NewFeeEstimator(fake)
+
+	price, err := e.UnitPrice(ctx, []solana.PublicKey{busy})
+	require.NoError(t, err)
+	assert.Zero(t, price, "nobody pays for an idle cluster")
+
+	// A quarter of the recent blocks are congested
+	fake.Advance(3 * BlockhashValidity / 4)
+	fake.Congest(3_000, busy)
+	fake.Advance(BlockhashValidity / 4)
+	fees, err := fake.RecentPrioritizationFees(ctx, []solana.PublicKey{busy})
+	require.NoError(t, err)
+	require.Len(t, fees, BlockhashValidity)
+	assert.Equal(t, uint64(3_000), fees[len(fees)-1].UnitPrice)
+
+	price, err = e.UnitPrice(ctx, []solana.PublicKey{busy})
+	require.NoError(t, err)
+	assert.Zero(t, price, "the 75th percentile block is still idle")
+	e.Percentile = 90
+	price, err = e.UnitPrice(ctx, []solana.PublicKey{busy})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4_096), price, "rounded up to a power of two")
+	price, err = e.UnitPrice(ctx, []solana.PublicKey{quiet})
+	require.NoError(t, err)
+	assert.Zero(t, price, "congestion elsewhere does not raise the price")
+
+	e.Min, e.Max = 100, 2_000
+	price, err = e.UnitPrice(ctx, []solana.PublicKey{busy})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2_000), price)
+	price, err = e.UnitPrice(ctx, []solana.PublicKey{quiet})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), price)
+
+	e.Percentile = 101
+	_, err = e.UnitPrice(ctx, nil)
+	assert.ErrorContains(t, err, "not between 0 and 100")
+}
+
+func TestPriorityFeeLandsDuringCongestion(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	s, _ := newSubmitter(t, fake, BlockhashValidity)
+	p := newPayout(fake, 400)
+	authority := p.authority.PublicKey()
+	fake.Congest(10_000, authority)
+	fake.Advance(BlockhashValidity)
+
+	// Leaders skip the payout until it pays what everyone else does
+	_, err := s.Submit(ctx, "ballot-1", p.build)
+	assert.ErrorIs(t, err, ErrExpired)
+	assert.Len(t, p.builds, s.MaxAttempts)
+
+	price, err := NewFeeEstimator(fake).UnitPrice(ctx, []solana.PublicKey{authority})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(16_384), price)
+	p.budget = solanatx.ComputeBudget{UnitLimit: 20_000, UnitPrice: price}
+	_, err = s.Submit(ctx, "ballot-2", p.build)
+	require.NoError(t, err)
+	received, err := fake.GetAccount(ctx, p.receiver)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(400), received.Lamports)
+
+	// The fee payer pays the signature fee and the whole limit at the price
+	payer, err := fake.GetAccount(ctx, authority)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1_000_000-400-LamportsPerSignature-328), payer.Lamports)
+}
@@ -0,0 +1,112 @@
+package solanarpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Submission states recorded in the journal
+const (
+	StatusSent      = "sent"      // submitted, waiting for confirmation
+	StatusConfirmed = "confirmed" // reached the submitter's commitment
+	StatusExpired   = "expired"   // blockhash expired before it landed
+	StatusFailed    = "failed"    // rejected or failed on-chain; not retried
+)
+
+// Entry records one step of a submission
+type Entry struct {
+	ID                   string    `json:"id"`
+	Attempt              int       `json:"attempt"`
+	Status               string    `json:"status"`
+	Signature            string    `json:"signature,omitempty"`
+	Blockhash            string    `json:"blockhash,omitempty"`
+	LastValidBlockHeight uint64    `json:"last_valid_block_height,omitempty"`
+	NonceAccount         string    `json:"nonce_account,omitempty"`
+	Error                string    `json:"error,omitempty"`
+	Time                 time.Time `json:"time"`
+}
+
+// Journal is an append-only log of submissions, one JSON entry per line, so
+// a restarted validator knows what it already sent and never pays twice
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	entries []Entry
+}
+
+// OpenJournal reads the journal at path, creating it if needed
+func OpenJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open submission journal: %w", err)
+	}
+	defer file.Close()
+
+	j := &Journal{path: path}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("submission journal line %d: %v", line, err)
+		}
+		j.entries = append(j.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read submission journal: %w", err)
+	}
+	return j, nil
+}
+
+// Append writes e and syncs it to disk before returning
+func (j *Journal) Append(e Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open submission journal: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write submission journal: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync submission journal: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	j.entries = append(j.entries, e)
+	return nil
+}
+
+// Entries returns the entries of submission id, oldest first
+func (j *Journal) Entries(id string) []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var entries []Entry
+	for _, e := range j.entries {
+		if e.ID == id {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,96 @@
+package solanarpc
+
+import (
+	"context"
+	"fmt"
+
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// SignTransaction adds the signatures a transaction needs, such as the
+// threshold key's through an MPC round, over a blockhash of its choosing: MPC
+// signers must first agree on one. It returns that blockhash.
+type SignTransaction func(ctx context.Context, tx *solana.Transaction) (Blockhash, error)
+
+// LoadLookupTable reads an address lookup table
+func LoadLookupTable(ctx context.Context, client SolanaClient, address solana.PublicKey) (solanatx.LookupTable, error) {
+	a, err := client.GetAccount(ctx, address)
+	if err != nil {
+		return solanatx.LookupTable{}, err
+	}
+	if !a.Owner.Equals(solanatx.LookupTableProgramID) {
+		return solanatx.LookupTable{}, fmt.Errorf("%s is not a lookup table: owned by %s", address, a.Owner)
+	}
+	return solanatx.ParseLookupTable(address, a.Data)
+}
+
+// CreateLookupTable creates an empty lookup table extended only by
+// authority, paid for by payer, and returns its address
+func (s *Submitter) CreateLookupTable(ctx context.Context, payer solana.PrivateKey, authority solana.PublicKey) (solana.PublicKey, error) {
+	slot, err := s.client.Slot(ctx, rpc.CommitmentFinalized)
+	if err != nil {
+		return solana.PublicKey{}, fmt.Errorf("failed to get slot: %w", err)
+	}
+	create, table, err := solanatx.CreateLookupTableInstruction(authority, payer.PublicKey(), slot)
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+
+	build := func(ctx context.Context, blockhash solana.Hash) (*solana.Transaction, error) {
+		tx, err := solana.NewTransaction([]solana.Instruction{create}, blockhash, solana.TransactionPayer(payer.PublicKey()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create transaction: %w", err)
+		}
+		if err := solanatx.Sign(ctx, tx, payer.PublicKey(), solanatx.KeySigner(payer)); err != nil {
+			return nil, err
+		}
+		return tx, nil
+	}
+	if _, err := s.Submit(ctx, "lookup:"+table.String(), build); err != nil {
+		return solana.PublicKey{}, err
+	}
+	return table, nil
+}
+
+// ExtendLookupTable adds the addresses table is missing, MaxExtendAddresses
+// per transaction, each paid by payer and signed once by sign, which must sign
+// as the table's authority. Validators extending the same table with the same
+// addresses build the same transactions under the same submission ids, so
+// each extension lands once. It returns the table as extended; once the
+// extensions reach the submitter's commitment the new addresses are usable.
+func (s *Submitter) ExtendLookupTable(ctx context.Context, table solanatx.LookupTable, payer solana.PublicKey, addresses []solana.PublicKey, sign SignTransaction) (solanatx.LookupTable, error) {
+	missing := table.Missing(addresses)
+	for len(missing) > 0 {
+		chunk := missing[:min(len(missing), solanatx.MaxExtendAddresses)]
+		extend, err := solanatx.ExtendLookupTableInstruction(table, payer, chunk)
+		if err != nil {
+			return table, err
+		}
+		tx, err := solana.NewTransaction([]solana.Instruction{extend}, solana.Hash{}, solana.TransactionPayer(payer))
+		if err != nil {
+			return table, fmt.Errorf("failed to create transaction: %w", err)
+		}
+		recent, err := sign(ctx, tx)
+		if err != nil {
+			return table, err
+		}
+		id := fmt.Sprintf("lookup:%s:%d", table.Address, len(table.Addresses))
+		if _, err := s.SubmitSigned(ctx, id, tx, recent, nil); err != nil {
+			return table, err
+		}
+
+		table, err = LoadLookupTable(ctx, s.client, table.Address)
+		if err != nil {
+			return table, err
+		}
+		remaining := table.Missing(missing)
+		if len(remaining) >= len(missing) {
+			return table, fmt.Errorf("lookup table %s was not extended", table.Address)
+		}
+		missing = remaining
+	}
+	return table, nil
+}
@@ -0,0 +1,139 @@
+package solanarpc
+
+import (
+	"context"
+	"testing"
+
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupTableCarriesLargePayout(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	fake.Advance(10)
+	s, _ := newSubmitter(t, fake, 1)
+
+	// An operator key creates the table; only the threshold key extends it
+	payer := solana.NewWallet().PrivateKey
+	fake.Fund(payer.PublicKey(), 10_000_000)
+	threshold := solana.NewWallet().PrivateKey
+	authority := threshold.PublicKey()
+	fake.Fund(authority, 100_000_000)
+	address, err := s.CreateLookupTable(ctx, payer, authority)
+	require.NoError(t, err)
+	table, err := LoadLookupTable(ctx, fake, address)
+	require.NoError(t, err)
+	assert.Equal(t, authority, table.Authority)
+	assert.Empty(t, table.Addresses)
+
+	payment := solanatx.Payment{}
+	for i := 0; i < 50; i++ {
+		payment.Receivers = append(payment.Receivers, solana.NewWallet().PublicKey())
+		payment.Amounts = append(payment.Amounts, uint64(1_000+i))
+		payment.TotalAmount += uint64(1_000 + i)
+	}
+	addresses, err := solanatx.PaymentLookupAddresses(authority, payment, nil)
+	require.NoError(t, err)
+	signs := 0
+	sign := func(ctx context.Context, tx *solana.Transaction) (Blockhash, error) {
+		signs++
+		recent, err := fake.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+		if err != nil {
+			return Blockhash{}, err
+		}
+		tx.Message.RecentBlockhash = recent.Hash
+		return recent, solanatx.Sign(ctx, tx, authority, solanatx.KeySigner(threshold))
+	}
+	table, err = s.ExtendLookupTable(ctx, table, authority, addresses, sign)
+	require.NoError(t, err)
+	assert.Equal(t, solana.PublicKeySlice(payment.Receivers), table.Addresses)
+	assert.Equal(t, 3, signs, "%d addresses per extension", solanatx.MaxExtendAddresses)
+	account, err := fake.GetAccount(ctx, address)
+	require.NoError(t, err)
+	assert.Equal(t, rentExemption(uint64(len(account.Data))), account.Lamports)
+
+	// Extending again adds nothing
+	table, err = s.ExtendLookupTable(ctx, table, authority, addresses, sign)
+	require.NoError(t, err)
+	assert.Equal(t, 3, signs)
+
+	recent, err := fake.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	txs, err := solanatx.BuildVersionedTransferTransactions(solanatx.ProgramID, authority, recent.Hash, []solanatx.LookupTable{table}, payment, nil, solanatx.ComputeBudget{})
+	require.NoError(t, err)
+	legacy, err := solanatx.BuildTransferTransactions(solanatx.ProgramID, authority, recent.Hash, payment, nil, solanatx.ComputeBudget{})
+	require.NoError(t, err)
+	assert.Less(t, len(txs), len(legacy))
+	for _, tx := range txs {
+		require.NoError(t, solanatx.Sign(ctx, tx, authority, solanatx.KeySigner(threshold)))
+		_, err := fake.SendTransaction(ctx, tx)
+		require.NoError(t, err)
+	}
+	for i, receiver := range payment.Receivers {
+		account, err := fake.GetAccount(ctx, receiver)
+		require.NoError(t, err)
+		assert.Equal(t, payment.Amounts[i], account.Lamports)
+	}
+}
+
+func TestLookupTableRejects(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	s, _ := newSubmitter(t, fake, 1)
+	threshold := solana.NewWallet().PrivateKey
+	authority := threshold.PublicKey()
+	fake.Fund(authority, 10_000_000)
+	address, err := s.CreateLookupTable(ctx, threshold, authority)
+	require.NoError(t, err)
+	table, err := LoadLookupTable(ctx, fake, address)
+	require.NoError(t, err)
+	receiver := solana.NewWallet().PublicKey()
+
+	send := func(signer solana.PrivateKey, ix solana.Instruction) error {
+		recent, err := fake.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+		require.NoError(t, err)
+		tx, err := solana.NewTransaction([]solana.Instruction{ix}, recent.Hash, solana.TransactionPayer(signer.PublicKey()))
+		require.NoError(t, err)
+		require.NoError(t, solanatx.Sign(ctx, tx, signer.PublicKey(), solanatx.KeySigner(signer)))
+		_, err = fake.SendTransaction(ctx, tx)
+		return err
+	}
+
+	// Only the authority extends the table
+	other := solana.NewWallet().PrivateKey
+	fake.Fund(other.PublicKey(), 10_000_000)
+	forged, err := solanatx.ExtendLookupTableInstruction(solanatx.LookupTable{Address: address, Authority: other.PublicKey()}, other.PublicKey(), []solana.PublicKey{receiver})
+	require.NoError(t, err)
+	assert.ErrorContains(t, send(other, forged), "must be extended by its authority")
+
+	// Tables are created at recent slots only
+	fake.Advance(600)
+	stale, _, err := solanatx.CreateLookupTableInstruction(authority, authority, 1)
+	require.NoError(t, err)
+	assert.ErrorContains(t, send(threshold, stale), "not a recent slot")
+
+	// Addresses are usable from the block after they were added
+	extend, err := solanatx.ExtendLookupTableInstruction(table, authority, []solana.PublicKey{receiver})
+	require.NoError(t, err)
+	require.NoError(t, send(threshold, extend))
+	table.Addresses = append(table.Addresses, receiver)
+	recent, err := fake.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	txs, err := solanatx.BuildVersionedTransferTransactions(solanatx.ProgramID, authority, recent.Hash, []solanatx.LookupTable{table},
+		solanatx.Payment{TotalAmount: 10, Receivers: []solana.PublicKey{receiver}, Amounts: []uint64{10}}, nil, solanatx.ComputeBudget{})
+	require.NoError(t, err)
+	require.NoError(t, solanatx.Sign(ctx, txs[0], authority, solanatx.KeySigner(threshold)))
+	_, err = fake.SendTransaction(ctx, txs[0])
+	assert.ErrorIs(t, err, ErrTransactionFailed)
+	fake.Advance(1)
+	_, err = fake.SendTransaction(ctx, txs[0])
+	assert.NoError(t, err)
+
+	_, err = LoadLookupTable(ctx, fake, receiver)
+	assert.ErrorContains(t, err, "not a lookup table")
+}
@@ -0,0 +1,61 @@
+package solanarpc
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// LoadNonce reads the current value of a nonce account
+func LoadNonce(ctx context.Context, client SolanaClient, account solana.PublicKey) (solanatx.DurableNonce, error) {
+	a, err := client.GetAccount(ctx, account)
+	if err != nil {
+		return solanatx.DurableNonce{}, err
+	}
+	if !a.Owner.Equals(solana.SystemProgramID) {
+		return solanatx.DurableNonce{}, fmt.Errorf("%s is not a nonce account: owned by %s", account, a.Owner)
+	}
+	return solanatx.ParseNonceAccount(account, a.Data)
+}
+
+// DurableBlockhash is the blockhash of a transaction built over n, which
+// does not expire until the nonce is advanced
+func DurableBlockhash(n solanatx.DurableNonce) Blockhash {
+	return Blockhash{Hash: n.Value, LastValidBlockHeight: math.MaxUint64}
+}
+
+// CreateNonceAccount creates a rent exempt nonce account advanced only by
+// authority, paid for by payer. The account's own key signs its creation and
+// is discarded.
+func (s *Submitter) CreateNonceAccount(ctx context.Context, payer solana.PrivateKey, authority solana.PublicKey) (solana.PublicKey, error) {
+	lamports, err := s.client.MinimumBalanceForRentExemption(ctx, solanatx.NonceAccountSize)
+	if err != nil {
+		return solana.PublicKey{}, fmt.Errorf("failed to get rent exemption: %w", err)
+	}
+	account := solana.NewWallet().PrivateKey
+	instructions, err := solanatx.CreateNonceAccountInstructions(payer.PublicKey(), account.PublicKey(), authority, lamports)
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+
+	build := func(ctx context.Context, blockhash solana.Hash) (*solana.Transaction, error) {
+		tx, err := solana.NewTransaction(instructions, blockhash, solana.TransactionPayer(payer.PublicKey()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create transaction: %w", err)
+		}
+		for _, key := range []solana.PrivateKey{payer, account} {
+			if err := solanatx.Sign(ctx, tx, key.PublicKey(), solanatx.KeySigner(key)); err != nil {
+				return nil, err
+			}
+		}
+		return tx, nil
+	}
+	if _, err := s.Submit(ctx, "nonce:"+account.PublicKey().String(), build); err != nil {
+		return solana.PublicKey{}, err
+	}
+	return account.PublicKey(), nil
+}
@@ -0,0 +1,117 @@
+package solanarpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurableNonceOutlivesBlockhashes(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	s, _ := newSubmitter(t, fake, 1)
+
+	// An operator key creates the nonce account; the threshold key advances it
+	payer := solana.NewWallet().PrivateKey
+	fake.Fund(payer.PublicKey(), 10_000_000)
+	p := newPayout(fake, 300)
+	threshold := p.authority.PublicKey()
+	account, err := s.CreateNonceAccount(ctx, payer, threshold)
+	require.NoError(t, err)
+
+	created, err := fake.GetAccount(ctx, account)
+	require.NoError(t, err)
+	assert.Equal(t, rentExemption(solanatx.NonceAccountSize), created.Lamports)
+	nonce, err := LoadNonce(ctx, fake, account)
+	require.NoError(t, err)
+	assert.Equal(t, threshold, nonce.Authority)
+
+	// Signing takes far longer than a blockhash lives
+	txs, err := solanatx.BuildDurableTransferTransactions(solanatx.ProgramID, threshold, []solanatx.DurableNonce{nonce},
+		solanatx.Payment{TotalAmount: 300, Receivers: []solana.PublicKey{p.receiver}, Amounts: []uint64{300}}, nil, solanatx.ComputeBudget{})
+	require.NoError(t, err)
+	tx := txs[0]
+	require.NoError(t, solanatx.Sign(ctx, tx, threshold, solanatx.KeySigner(p.authority)))
+	fake.Advance(10 * BlockhashValidity)
+
+	signature, err := s.SubmitSigned(ctx, "ballot-9", tx, DurableBlockhash(nonce), nil)
+	require.NoError(t, err)
+	assert.Equal(t, tx.Signatures[0], signature)
+	received, err := fake.GetAccount(ctx, p.receiver)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(300), received.Lamports)
+
+	// The nonce moved on, so the transaction cannot be replayed
+	advanced, err := LoadNonce(ctx, fake, account)
+	require.NoError(t, err)
+	assert.NotEqual(t, nonce.Value, advanced.Value)
+	fake.Advance(1)
+	simulation, err := fake.SimulateTransaction(ctx, tx)
+	require.NoError(t, err)
+	assert.ErrorIs(t, simulation.Err, ErrBlockhashNotFound)
+
+	// Only the authority advances the nonce
+	other := solana.NewWallet().PrivateKey
+	fake.Fund(other.PublicKey(), 1_000_000)
+	advance, err := solanatx.AdvanceNonceInstruction(solanatx.DurableNonce{Account: account, Authority: other.PublicKey(), Value: advanced.Value})
+	require.NoError(t, err)
+	forged, err := solana.NewTransaction([]solana.Instruction{advance}, advanced.Value, solana.TransactionPayer(other.PublicKey()))
+	require.NoError(t, err)
+	require.NoError(t, solanatx.Sign(ctx, forged, other.PublicKey(), solanatx.KeySigner(other)))
+	_, err = fake.SendTransaction(ctx, forged)
+	assert.ErrorContains(t, err, "must be advanced by its authority")
+
+	_, err = LoadNonce(ctx, fake, p.receiver)
+	assert.ErrorContains(t, err, "has 0 bytes")
+	ok, err := fake.Confirm(ctx, signature, rpc.CommitmentProcessed)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestDurableSubmissionExpiresWithItsNonce(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	s, journal := newSubmitter(t, fake, 1)
+
+	payer := solana.NewWallet().PrivateKey
+	fake.Fund(payer.PublicKey(), 10_000_000)
+	p := newPayout(fake, 300)
+	threshold := p.authority.PublicKey()
+	account, err := s.CreateNonceAccount(ctx, payer, threshold)
+	require.NoError(t, err)
+	nonce, err := LoadNonce(ctx, fake, account)
+	require.NoError(t, err)
+
+	// Two transactions over the same nonce: whichever lands first uses it up
+	build := func(receiver solana.PublicKey) *solana.Transaction {
+		txs, err := solanatx.BuildDurableTransferTransactions(solanatx.ProgramID, threshold, []solanatx.DurableNonce{nonce},
+			solanatx.Payment{TotalAmount: 300, Receivers: []solana.PublicKey{receiver}, Amounts: []uint64{300}}, nil, solanatx.ComputeBudget{})
+		require.NoError(t, err)
+		require.NoError(t, solanatx.Sign(ctx, txs[0], threshold, solanatx.KeySigner(p.authority)))
+		return txs[0]
+	}
+	tx, other := build(p.receiver), build(solana.NewWallet().PublicKey())
+
+	// The first send is dropped, and the other transaction lands meanwhile
+	fake.DropNext(1)
+	s.wait = func(context.Context, time.Duration) error {
+		if _, err := fake.SendTransaction(ctx, other); err != nil && !errors.Is(err, ErrAlreadyProcessed) {
+			return err
+		}
+		fake.Advance(1)
+		return nil
+	}
+	_, err = s.SubmitSigned(ctx, "ballot-10", tx, DurableBlockhash(nonce), nil)
+	assert.ErrorIs(t, err, ErrExpired)
+	entries := journal.Entries("ballot-10")
+	assert.Equal(t, []string{StatusSent, StatusExpired}, statuses(entries))
+	assert.Equal(t, account.String(), entries[0].NonceAccount)
+}
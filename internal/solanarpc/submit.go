@@ -0,0 +1,235 @@
+package solanarpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// ErrExpired is returned when no attempt landed before its blockhash expired
+var ErrExpired = errors.New("transaction expired")
+
+// BuildFunc builds and signs the transaction to submit with blockhash. It is
+// called again for every attempt, so a transaction the caller can still sign
+// is rebuilt over a fresh blockhash when the previous one expired. The
+// signers of a finished MPC round cannot sign again.
+type BuildFunc func(ctx context.Context, blockhash solana.Hash) (*solana.Transaction, error)
+
+// Submitter sends transactions and tracks them to Commitment. An attempt
+// whose blockhash expires, or whose durable nonce is advanced, before it lands
+// is rebuilt with a fresh blockhash, up to MaxAttempts times. Every step is journaled before it is taken.
+type Submitter struct {
+	Commitment   rpc.CommitmentType
+	MaxAttempts  int
+	PollInterval time.Duration
+
+	client  SolanaClient
+	journal *Journal
+	wait    func(ctx context.Context, d time.Duration) error
+}
+
+// NewSubmitter returns a submitter waiting for confirmed commitment, with
+// three attempts
+func NewSubmitter(client SolanaClient, journal *Journal) *Submitter {
+	return &Submitter{
+		Commitment:   rpc.CommitmentConfirmed,
+		MaxAttempts:  3,
+		PollInterval: 2 * time.Second,
+		client:       client,
+		journal:      journal,
+		wait:         sleep,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Submit lands the transaction of submission id and returns its signature.
+// It resumes from the journal: a confirmed submission is not sent again, a
+// failed one is not retried, and one left waiting by a previous run is
+// tracked before anything new is signed.
+func (s *Submitter) Submit(ctx context.Context, id string, build BuildFunc) (solana.Signature, error) {
+	return s.submit(ctx, id, nil, Blockhash{}, build)
+}
+
+// SubmitSigned is Submit for a transaction already signed over recent, such
+// as one signed in an MPC round that has ended. tx is sent first; resign is
+// only called if its blockhash expires, and may be nil when the transaction
+// cannot be signed again.
+func (s *Submitter) SubmitSigned(ctx context.Context, id string, tx *solana.Transaction, recent Blockhash, resign BuildFunc) (solana.Signature, error) {
+	return s.submit(ctx, id, tx, recent, resign)
+}
+
+func (s *Submitter) submit(ctx context.Context, id string, signed *solana.Transaction, signedOver Blockhash, build BuildFunc) (solana.Signature, error) {
+	attempt := 0
+	if entries := s.journal.Entries(id); len(entries) > 0 {
+		last := entries[len(entries)-1]
+		attempt = last.Attempt
+		switch last.Status {
+		case StatusConfirmed:
+			return solana.SignatureFromBase58(last.Signature)
+		case StatusFailed:
+			return solana.Signature{}, fmt.Errorf("%w: submission %s failed in attempt %d: %s", ErrTransactionFailed, id, last.Attempt, last.Error)
+		case StatusSent:
+			if signature, done, err := s.track(ctx, last); done {
+				return signature, err
+			}
+		}
+	}
+
+	for attempt < s.MaxAttempts {
+		attempt++
+		tx, recent := signed, signedOver
+		if tx == nil || attempt > 1 {
+			if build == nil {
+				break
+			}
+			var err error
+			recent, err = s.client.LatestBlockhash(ctx, s.Commitment)
+			if err != nil {
+				return solana.Signature{}, fmt.Errorf("failed to get blockhash: %w", err)
+			}
+			tx, err = build(ctx, recent.Hash)
+			if err != nil {
+				return solana.Signature{}, err
+			}
+		}
+		if len(tx.Signatures) == 0 {
+			return solana.Signature{}, errors.New("built transaction is not signed")
+		}
+
+		// Journal the signature before sending, so a crash while sending
+		// still leaves something to track
+		entry := Entry{
+			ID:                   id,
+			Attempt:              attempt,
+			Status:               StatusSent,
+			Signature:            tx.Signatures[0].String(),
+			Blockhash:            recent.Hash.String(),
+			LastValidBlockHeight: recent.LastValidBlockHeight,
+		}
+		if account, ok := solanatx.DurableNonceAccount(tx.Message); ok {
+			entry.NonceAccount = account.String()
+		}
+		if err := s.journal.Append(entry); err != nil {
+			return solana.Signature{}, err
+		}
+
+		_, err := s.client.SendTransaction(ctx, tx)
+		switch {
+		case errors.Is(err, ErrBlockhashNotFound):
+			if err := s.record(entry, StatusExpired, err); err != nil {
+				return solana.Signature{}, err
+			}
+			continue
+		case errors.Is(err, ErrTransactionFailed):
+			if recordErr := s.record(entry, StatusFailed, err); recordErr != nil {
+				return solana.Signature{}, recordErr
+			}
+			return solana.Signature{}, err
+		}
+		// Any other error leaves open whether the transaction was delivered,
+		// so it is tracked like a sent one
+
+		if signature, done, err := s.track(ctx, entry); done {
+			return signature, err
+		}
+	}
+	return solana.Signature{}, fmt.Errorf("%w: submission %s not confirmed after %d attempts", ErrExpired, id, attempt)
+}
+
+// track polls the transaction of entry until it reaches the commitment,
+// fails, or expires. done is false only when it expired without landing.
+func (s *Submitter) track(ctx context.Context, entry Entry) (signature solana.Signature, done bool, err error) {
+	signature, err = solana.SignatureFromBase58(entry.Signature)
+	if err != nil {
+		return signature, true, fmt.Errorf("invalid signature in journal: %w", err)
+	}
+
+	landed := false
+	for {
+		confirmed, err := s.client.Confirm(ctx, signature, s.Commitment)
+		if errors.Is(err, ErrTransactionFailed) {
+			if recordErr := s.record(entry, StatusFailed, err); recordErr != nil {
+				return signature, true, recordErr
+			}
+			return signature, true, err
+		}
+		if err != nil {
+			return signature, true, err
+		}
+		if confirmed {
+			return signature, true, s.record(entry, StatusConfirmed, nil)
+		}
+
+		// Once the blockhash has expired the transaction can no longer land,
+		// so unless it already has, it must be signed again
+		if !landed {
+			expired, err := s.expired(ctx, entry)
+			if err != nil {
+				return signature, true, err
+			}
+			if expired {
+				landed, err = s.client.Confirm(ctx, signature, rpc.CommitmentProcessed)
+				if err != nil {
+					return signature, true, err
+				}
+				if !landed {
+					if err := s.record(entry, StatusExpired, nil); err != nil {
+						return signature, true, err
+					}
+					return signature, false, nil
+				}
+			}
+		}
+
+		if err := s.wait(ctx, s.PollInterval); err != nil {
+			return signature, true, err
+		}
+	}
+}
+
+// expired reports whether the blockhash of entry can no longer be used. A
+// durable nonce never reaches a block height; it is used up once the nonce
+// account holds another value, by this transaction or any other.
+func (s *Submitter) expired(ctx context.Context, entry Entry) (bool, error) {
+	if entry.NonceAccount == "" {
+		height, err := s.client.BlockHeight(ctx, s.Commitment)
+		if err != nil {
+			return false, err
+		}
+		return height > entry.LastValidBlockHeight, nil
+	}
+	account, err := solana.PublicKeyFromBase58(entry.NonceAccount)
+	if err != nil {
+		return false, fmt.Errorf("invalid nonce account in journal: %w", err)
+	}
+	nonce, err := LoadNonce(ctx, s.client, account)
+	if err != nil {
+		return false, err
+	}
+	return nonce.Value.String() != entry.Blockhash, nil
+}
+
+// record journals a new status for the attempt of entry
+func (s *Submitter) record(entry Entry, status string, cause error) error {
+	entry.Status, entry.Error, entry.Time = status, "", time.Time{}
+	if cause != nil {
+		entry.Error = cause.Error()
+	}
+	return s.journal.Append(entry)
+}
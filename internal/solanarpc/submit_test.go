@@ -0,0 +1,215 @@
+package solanarpc
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// payout is a funded authority paying lamports to receiver through the
+// payment_validator program under budget, counting how often it signs
+type payout struct {
+	authority solana.PrivateKey
+	receiver  solana.PublicKey
+	lamports  uint64
+	budget    solanatx.ComputeBudget
+	builds    []solana.Hash
+}
+
+func newPayout(fake *Fake, lamports uint64) *payout {
+	p := &payout{authority: solana.NewWallet().PrivateKey, receiver: solana.NewWallet().PublicKey(), lamports: lamports}
+	fake.Fund(p.authority.PublicKey(), 1_000_000)
+	return p
+}
+
+func (p *payout) build(ctx context.Context, blockhash solana.Hash) (*solana.Transaction, error) {
+	p.builds = append(p.builds, blockhash)
+	authority := p.authority.PublicKey()
+	payment := solanatx.Payment{TotalAmount: p.lamports, Receivers: []solana.PublicKey{p.receiver}, Amounts: []uint64{p.lamports}}
+	validate, err := solanatx.NewPaymentInstruction(solanatx.ProgramID, authority, payment)
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := solanatx.TransferInstructions(authority, nil, payment)
+	if err != nil {
+		return nil, err
+	}
+	instructions, err := p.budget.Apply(append([]solana.Instruction{validate}, transfers...))
+	if err != nil {
+		return nil, err
+	}
+	tx, err := solana.NewTransaction(instructions, blockhash, solana.TransactionPayer(authority))
+	if err != nil {
+		return nil, err
+	}
+	if err := solanatx.Sign(ctx, tx, authority, solanatx.KeySigner(p.authority)); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// newSubmitter returns a submitter whose polls produce blocks on fake
+// instead of sleeping
+func newSubmitter(t *testing.T, fake *Fake, blocksPerPoll uint64) (*Submitter, *Journal) {
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "submissions.jsonl"))
+	require.NoError(t, err)
+	s := NewSubmitter(fake, journal)
+	s.wait = func(context.Context, time.Duration) error {
+		fake.Advance(blocksPerPoll)
+		return nil
+	}
+	return s, journal
+}
+
+func statuses(entries []Entry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Status)
+	}
+	return out
+}
+
+func TestSubmitConfirms(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	s, journal := newSubmitter(t, fake, 1)
+	s.Commitment = rpc.CommitmentFinalized
+	p := newPayout(fake, 250)
+
+	signature, err := s.Submit(ctx, "ballot-1", p.build)
+	require.NoError(t, err)
+	ok, err := fake.Confirm(ctx, signature, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	account, err := fake.GetAccount(ctx, p.receiver)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(250), account.Lamports)
+
+	entries := journal.Entries("ballot-1")
+	assert.Equal(t, []string{StatusSent, StatusConfirmed}, statuses(entries))
+	assert.Equal(t, signature.String(), entries[1].Signature)
+
+	// Submitting again is a no-op, also after a restart
+	reopened, err := OpenJournal(journal.path)
+	require.NoError(t, err)
+	s.journal = reopened
+	again, err := s.Submit(ctx, "ballot-1", p.build)
+	require.NoError(t, err)
+	assert.Equal(t, signature, again)
+	assert.Len(t, p.builds, 1)
+	assert.Len(t, fake.Sent(), 1)
+}
+
+func TestSubmitResignsAfterExpiry(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	s, journal := newSubmitter(t, fake, 20)
+	p := newPayout(fake, 100)
+
+	// The first attempt is dropped and its blockhash expires
+	fake.DropNext(1)
+	signature, err := s.Submit(ctx, "ballot-2", p.build)
+	require.NoError(t, err)
+	require.Len(t, p.builds, 2)
+	assert.NotEqual(t, p.builds[0], p.builds[1], "the retry is signed over a fresh blockhash")
+	assert.Equal(t, []string{StatusSent, StatusExpired, StatusSent, StatusConfirmed}, statuses(journal.Entries("ballot-2")))
+	assert.Equal(t, []*solana.Transaction{fake.Sent()[0]}, fake.Sent())
+	assert.Equal(t, fake.Sent()[0].Signatures[0], signature)
+
+	// Blockhashes that expire while MPC signing runs are retried too
+	p = newPayout(fake, 100)
+	slow := func(ctx context.Context, blockhash solana.Hash) (*solana.Transaction, error) {
+		if len(p.builds) == 0 {
+			fake.Advance(BlockhashValidity + 1)
+		}
+		return p.build(ctx, blockhash)
+	}
+	_, err = s.Submit(ctx, "ballot-3", slow)
+	require.NoError(t, err)
+	assert.Len(t, p.builds, 2)
+	assert.Equal(t, []string{StatusSent, StatusExpired, StatusSent, StatusConfirmed}, statuses(journal.Entries("ballot-3")))
+
+	// Retries are bounded
+	p = newPayout(fake, 100)
+	s.MaxAttempts = 2
+	fake.DropNext(5)
+	_, err = s.Submit(ctx, "ballot-4", p.build)
+	assert.ErrorIs(t, err, ErrExpired)
+	assert.Len(t, p.builds, 2)
+}
+
+func TestSubmitDoesNotRetryFailures(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	s, journal := newSubmitter(t, fake, 1)
+
+	// The authority cannot cover the transfer
+	p := newPayout(fake, 5_000_000)
+	_, err := s.Submit(ctx, "ballot-5", p.build)
+	assert.ErrorIs(t, err, ErrTransactionFailed)
+	assert.Equal(t, []string{StatusSent, StatusFailed}, statuses(journal.Entries("ballot-5")))
+
+	_, err = s.Submit(ctx, "ballot-5", p.build)
+	assert.ErrorIs(t, err, ErrTransactionFailed)
+	assert.Len(t, p.builds, 1)
+}
+
+func TestSubmitResumesSentTransaction(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	s, journal := newSubmitter(t, fake, 1)
+	p := newPayout(fake, 100)
+
+	// A previous run sent the transaction and stopped before it confirmed
+	recent, err := fake.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	tx, err := p.build(ctx, recent.Hash)
+	require.NoError(t, err)
+	require.NoError(t, journal.Append(Entry{
+		ID: "ballot-6", Attempt: 1, Status: StatusSent, Signature: tx.Signatures[0].String(),
+		Blockhash: recent.Hash.String(), LastValidBlockHeight: recent.LastValidBlockHeight,
+	}))
+	_, err = fake.SendTransaction(ctx, tx)
+	require.NoError(t, err)
+
+	signature, err := s.Submit(ctx, "ballot-6", p.build)
+	require.NoError(t, err)
+	assert.Equal(t, tx.Signatures[0], signature)
+	assert.Len(t, p.builds, 1, "nothing is signed again")
+	assert.Equal(t, []string{StatusSent, StatusConfirmed}, statuses(journal.Entries("ballot-6")))
+}
+
+func TestSubmitSigned(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake(solanatx.ProgramID)
+	s, journal := newSubmitter(t, fake, 20)
+	p := newPayout(fake, 100)
+
+	// A transaction signed in a finished MPC round goes out as it is
+	recent, err := fake.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	tx, err := p.build(ctx, recent.Hash)
+	require.NoError(t, err)
+	signature, err := s.SubmitSigned(ctx, "ballot-7", tx, recent, p.build)
+	require.NoError(t, err)
+	assert.Equal(t, tx.Signatures[0], signature)
+	assert.Len(t, p.builds, 1)
+
+	// Without a way to sign again, an expired transaction is reported
+	recent, err = fake.LatestBlockhash(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	tx, err = p.build(ctx, recent.Hash)
+	require.NoError(t, err)
+	fake.DropNext(1)
+	_, err = s.SubmitSigned(ctx, "ballot-8", tx, recent, nil)
+	assert.ErrorIs(t, err, ErrExpired)
+	assert.Equal(t, []string{StatusSent, StatusExpired}, statuses(journal.Entries("ballot-8")))
+}
@@ -0,0 +1,31 @@
+package solanarpc
+
+import (
+	"context"
+	"fmt"
+
+	"tilt-valid/internal/distribution"
+	"tilt-valid/internal/solanatx"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// LoadToken reads the mint of the SPL token paid by asset, or returns nil for
+// native SOL
+func LoadToken(ctx context.Context, client SolanaClient, asset distribution.Asset) (*solanatx.Token, error) {
+	if asset.IsNative() {
+		return nil, nil
+	}
+	mint, err := asset.Mint()
+	if err != nil {
+		return nil, err
+	}
+	a, err := client.GetAccount(ctx, mint)
+	if err != nil {
+		return nil, err
+	}
+	if !a.Owner.Equals(solana.TokenProgramID) {
+		return nil, fmt.Errorf("%s is not an SPL token mint: owned by %s", mint, a.Owner)
+	}
+	return solanatx.ParseMint(mint, a.Data)
+}
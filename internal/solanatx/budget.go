@@ -0,0 +1,119 @@
+package solanatx
+
+import (
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	computebudget "github.com/gagliardetto/solana-go/programs/compute-budget"
+)
+
+const (
+	// DefaultUnitLimit is the compute units the cluster allows each
+	// instruction of a transaction that sets no limit
+	DefaultUnitLimit = 200_000
+	// MaxUnitLimit is the most compute units a transaction can request
+	MaxUnitLimit = computebudget.MAX_COMPUTE_UNIT_LIMIT
+	// microLamportsPerLamport converts compute unit prices to lamports
+	microLamportsPerLamport = 1_000_000
+)
+
+// ComputeBudget is a transaction's compute unit limit and its price in
+// micro-lamports per unit, the priority fee leaders order transactions by.
+// Zero fields keep the cluster defaults: DefaultUnitLimit per instruction and
+// no priority fee.
+type ComputeBudget struct {
+	UnitLimit uint32
+	UnitPrice uint64
+}
+
+// Instructions returns the ComputeBudget instructions setting b, none for
+// the zero budget
+func (b ComputeBudget) Instructions() ([]solana.Instruction, error) {
+	var instructions []solana.Instruction
+	if b.UnitLimit > 0 {
+		limit, err := computebudget.NewSetComputeUnitLimitInstruction(b.UnitLimit).ValidateAndBuild()
+		if err != nil {
+			return nil, fmt.Errorf("invalid compute unit limit: %w", err)
+		}
+		instructions = append(instructions, limit)
+	}
+	if b.UnitPrice > 0 {
+		price, err := computebudget.NewSetComputeUnitPriceInstruction(b.UnitPrice).ValidateAndBuild()
+		if err != nil {
+			return nil, fmt.Errorf("invalid compute unit price: %w", err)
+		}
+		instructions = append(instructions, price)
+	}
+	return instructions, nil
+}
+
+// Apply prepends b's instructions to instructions
+func (b ComputeBudget) Apply(instructions []solana.Instruction) ([]solana.Instruction, error) {
+	budget, err := b.Instructions()
+	if err != nil {
+		return nil, err
+	}
+	return append(budget, instructions...), nil
+}
+
+// PriorityFee returns the lamports b adds to the fee of a transaction with
+// n other instructions, charged for the whole limit whatever is consumed
+func (b ComputeBudget) PriorityFee(n int) uint64 {
+	limit := uint64(b.UnitLimit)
+	if limit == 0 {
+		limit = min(uint64(n)*DefaultUnitLimit, MaxUnitLimit)
+	}
+	return (limit*b.UnitPrice + microLamportsPerLamport - 1) / microLamportsPerLamport
+}
+
+// SetUnitPrice changes the price the SetComputeUnitPrice instruction of an
+// unsigned tx asks. The price is encoded in a fixed width, so a transaction
+// built with a placeholder price keeps its size.
+func SetUnitPrice(tx *solana.Transaction, price uint64) error {
+	for i, ix := range tx.Message.Instructions {
+		program, err := tx.Message.Program(ix.ProgramIDIndex)
+		if err != nil {
+			return err
+		}
+		if !program.Equals(solana.ComputeBudget) || len(ix.Data) == 0 || ix.Data[0] != computebudget.Instruction_SetComputeUnitPrice {
+			continue
+		}
+		data, err := computebudget.NewSetComputeUnitPriceInstruction(price).Build().Data()
+		if err != nil {
+			return err
+		}
+		tx.Message.Instructions[i].Data = data
+		return nil
+	}
+	return fmt.Errorf("transaction sets no compute unit price")
+}
+
+// ParseComputeBudget reads the budget a transaction's ComputeBudget
+// instructions set and counts its other instructions
+func ParseComputeBudget(message solana.Message) (ComputeBudget, int, error) {
+	var b ComputeBudget
+	n := 0
+	for _, ix := range message.Instructions {
+		program, err := message.Program(ix.ProgramIDIndex)
+		if err != nil {
+			return ComputeBudget{}, 0, err
+		}
+		if !program.Equals(solana.ComputeBudget) {
+			n++
+			continue
+		}
+		instruction, err := computebudget.DecodeInstruction(nil, ix.Data)
+		if err != nil {
+			return ComputeBudget{}, 0, fmt.Errorf("invalid compute budget instruction: %w", err)
+		}
+		switch set := instruction.Impl.(type) {
+		case *computebudget.SetComputeUnitLimit:
+			b.UnitLimit = set.Units
+		case *computebudget.SetComputeUnitPrice:
+			b.UnitPrice = set.MicroLamports
+		default:
+			return ComputeBudget{}, 0, fmt.Errorf("compute budget instruction %s is not supported", computebudget.InstructionIDToName(instruction.TypeID.Uint8()))
+		}
+	}
+	return b, n, nil
+}
@@ -0,0 +1,64 @@
+package solanatx
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeBudget(t *testing.T) {
+	none, err := ComputeBudget{}.Instructions()
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	payer := key(1)
+	instruction, err := NewPaymentInstruction(ProgramID, payer, Payment{TotalAmount: 5, Receivers: []solana.PublicKey{key(2)}, Amounts: []uint64{5}})
+	require.NoError(t, err)
+	budget := ComputeBudget{UnitLimit: 50_000, UnitPrice: 12_345}
+	instructions, err := budget.Apply([]solana.Instruction{instruction})
+	require.NoError(t, err)
+	require.Len(t, instructions, 3)
+	for _, ix := range instructions[:2] {
+		assert.Equal(t, solana.ComputeBudget, ix.ProgramID())
+		assert.Empty(t, ix.Accounts())
+	}
+	limitData, err := instructions[0].Data()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{2, 0x50, 0xc3, 0, 0}, limitData) // SetComputeUnitLimit 50_000
+	priceData, err := instructions[1].Data()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{3, 0x39, 0x30, 0, 0, 0, 0, 0, 0}, priceData) // SetComputeUnitPrice 12_345
+	assert.Equal(t, instruction, instructions[2])
+
+	tx, err := solana.NewTransaction(instructions, solana.Hash{1}, solana.TransactionPayer(payer))
+	require.NoError(t, err)
+	parsed, n, err := ParseComputeBudget(tx.Message)
+	require.NoError(t, err)
+	assert.Equal(t, budget, parsed)
+	assert.Equal(t, 1, n)
+
+	// The fee covers the whole limit, rounded up to a lamport
+	assert.Equal(t, uint64(618), budget.PriorityFee(n))
+	assert.Equal(t, uint64(4_000), ComputeBudget{UnitPrice: 10_000}.PriorityFee(2))
+	assert.Equal(t, uint64(14_000), ComputeBudget{UnitPrice: 10_000}.PriorityFee(10), "capped at MaxUnitLimit")
+	assert.Zero(t, ComputeBudget{UnitLimit: 1_000}.PriorityFee(1))
+
+	// The price can be set once the transaction is built
+	size, err := Size(tx)
+	require.NoError(t, err)
+	require.NoError(t, SetUnitPrice(tx, 99_000))
+	parsed, _, err = ParseComputeBudget(tx.Message)
+	require.NoError(t, err)
+	assert.Equal(t, ComputeBudget{UnitLimit: 50_000, UnitPrice: 99_000}, parsed)
+	resized, err := Size(tx)
+	require.NoError(t, err)
+	assert.Equal(t, size, resized)
+	unpriced, err := solana.NewTransaction([]solana.Instruction{instruction}, solana.Hash{1}, solana.TransactionPayer(payer))
+	require.NoError(t, err)
+	assert.ErrorContains(t, SetUnitPrice(unpriced, 1), "no compute unit price")
+
+	_, err = ComputeBudget{UnitLimit: MaxUnitLimit + 1}.Instructions()
+	assert.ErrorContains(t, err, "invalid compute unit limit")
+}
@@ -0,0 +1,159 @@
+package solanatx
+
+import (
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// MaxTransactionSize is the largest serialized transaction a cluster accepts
+const MaxTransactionSize = 1232
+
+// Size returns the serialized size of tx once every required signature is present
+func Size(tx *solana.Transaction) (int, error) {
+	message, err := tx.Message.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	signatures := int(tx.Message.Header.NumRequiredSignatures)
+	return compactLen(signatures) + 64*signatures + len(message), nil
+}
+
+// compactLen is the length of n in Solana's compact-u16 encoding
+func compactLen(n int) int {
+	size := 1
+	for n >= 0x80 {
+		n >>= 7
+		size++
+	}
+	return size
+}
+
+// BuildPaymentTransactions validates p and splits it into as few unsigned
+// transactions as fit MaxTransactionSize. Each transaction carries one
+// validate_payment_distribution instruction for a consecutive run of
+// receivers, with that run's sum as its total, so each passes the program's
+// checks on its own and together they pay exactly p.
+func BuildPaymentTransactions(programID, payer solana.PublicKey, blockhash solana.Hash, p Payment) ([]*solana.Transaction, error) {
+	return buildBatches(p, func(_ int, part Payment) (*solana.Transaction, error) {
+		instruction, err := NewPaymentInstruction(programID, payer, part)
+		if err != nil {
+			return nil, err
+		}
+		return newTransaction([]solana.Instruction{instruction}, blockhash, payer)
+	})
+}
+
+// BuildTransferTransactions is BuildPaymentTransactions moving the funds too:
+// each run's validate_payment_distribution instruction is followed by its
+// TransferInstructions, so a transaction pays out only if the program accepts
+// its amounts. authority holds the funds, pays the fees and is the only
+// signer, so the transactions are signed by the threshold key alone. Every
+// transaction sets budget, which counts towards its size.
+func BuildTransferTransactions(programID, authority solana.PublicKey, blockhash solana.Hash, p Payment, tok *Token, budget ComputeBudget) ([]*solana.Transaction, error) {
+	return buildBatches(p, func(_ int, part Payment) (*solana.Transaction, error) {
+		instructions, err := transferBatch(programID, authority, part, tok, budget)
+		if err != nil {
+			return nil, err
+		}
+		return newTransaction(instructions, blockhash, authority)
+	})
+}
+
+// BuildDurableTransferTransactions is BuildTransferTransactions over durable
+// nonces instead of a recent blockhash. A nonce is consumed by the first
+// transaction using it, so transaction i uses nonces[i] and there must be a
+// nonce for every transaction the payment needs.
+func BuildDurableTransferTransactions(programID, authority solana.PublicKey, nonces []DurableNonce, p Payment, tok *Token, budget ComputeBudget) ([]*solana.Transaction, error) {
+	if len(nonces) == 0 {
+		return nil, fmt.Errorf("no durable nonce given")
+	}
+	return buildBatches(p, func(i int, part Payment) (*solana.Transaction, error) {
+		if i >= len(nonces) {
+			return nil, fmt.Errorf("payment needs more than %d transactions, one per durable nonce", len(nonces))
+		}
+		instructions, err := transferBatch(programID, authority, part, tok, budget)
+		if err != nil {
+			return nil, err
+		}
+		return NewDurableTransaction(instructions, nonces[i], authority)
+	})
+}
+
+// transferBatch validates a run of receivers and pays it out under budget
+func transferBatch(programID, authority solana.PublicKey, part Payment, tok *Token, budget ComputeBudget) ([]solana.Instruction, error) {
+	validate, err := NewPaymentInstruction(programID, authority, part)
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := TransferInstructions(authority, tok, part)
+	if err != nil {
+		return nil, err
+	}
+	return budget.Apply(append([]solana.Instruction{validate}, transfers...))
+}
+
+// batchFunc builds the transaction for the i-th run of receivers
+type batchFunc func(i int, part Payment) (*solana.Transaction, error)
+
+// buildBatches validates p and splits it into consecutive runs of receivers,
+// each as long as fits in the one transaction build returns for it
+func buildBatches(p Payment, build batchFunc) ([]*solana.Transaction, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if len(p.Receivers) == 0 {
+		tx, _, err := batchTransaction(0, p, build)
+		if err != nil {
+			return nil, err
+		}
+		return []*solana.Transaction{tx}, nil
+	}
+
+	var txs []*solana.Transaction
+	for start := 0; start < len(p.Receivers); {
+		tx, size, err := batchTransaction(len(txs), p.slice(start, start+1), build)
+		if err != nil {
+			return nil, err
+		}
+		if size > MaxTransactionSize {
+			return nil, fmt.Errorf("a payment to one receiver needs %d bytes, more than the %d allowed", size, MaxTransactionSize)
+		}
+
+		// Grow the run while the transaction still fits
+		end := start + 1
+		for end < len(p.Receivers) {
+			next, size, err := batchTransaction(len(txs), p.slice(start, end+1), build)
+			if err != nil {
+				return nil, err
+			}
+			if size > MaxTransactionSize {
+				break
+			}
+			tx, end = next, end+1
+		}
+		txs = append(txs, tx)
+		start = end
+	}
+	return txs, nil
+}
+
+func batchTransaction(i int, p Payment, build batchFunc) (*solana.Transaction, int, error) {
+	tx, err := build(i, p)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := Size(tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return tx, size, nil
+}
+
+func newTransaction(instructions []solana.Instruction, blockhash solana.Hash, payer solana.PublicKey) (*solana.Transaction, error) {
+	tx, err := solana.NewTransaction(instructions, blockhash, solana.TransactionPayer(payer))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+	return tx, nil
+}
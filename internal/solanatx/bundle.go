@@ -0,0 +1,200 @@
+package solanatx
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// BundleVersion is the version of the bundle format written by WriteBundle
+const BundleVersion = 1
+
+var (
+	// ErrBundleVersion is returned for bundles of an unknown format version
+	ErrBundleVersion = errors.New("unsupported bundle version")
+	// ErrBundleChecksum is returned for bundles altered after they were written
+	ErrBundleChecksum = errors.New("bundle checksum mismatch")
+	// ErrBundleUnsigned is returned when a bundle still misses signatures
+	ErrBundleUnsigned = errors.New("bundle is not fully signed")
+)
+
+// Bundle carries a transaction message from the online machine that builds
+// and broadcasts it to validators that sign it without RPC access. It holds
+// the serialized message, legacy or v0, the required signers with the
+// signatures collected so far, and which signer the threshold key is.
+type Bundle struct {
+	Version     int                `json:"version"`
+	Message     []byte             `json:"message"`
+	Signers     []solana.PublicKey `json:"signers"`
+	Signatures  []solana.Signature `json:"signatures"`
+	SignerIndex int                `json:"signer_index"`
+	// LastValidBlockHeight is when the blockhash of the message expires,
+	// math.MaxUint64 for a durable nonce
+	LastValidBlockHeight uint64            `json:"last_valid_block_height"`
+	Metadata             map[string]string `json:"metadata,omitempty"`
+	// Checksum is the hex SHA-256 of the bundle's JSON with an empty checksum
+	Checksum string `json:"checksum"`
+}
+
+// NewBundle exports tx, keeping the signatures it already has, for signer
+// to sign offline
+func NewBundle(tx *solana.Transaction, signer solana.PublicKey, lastValidBlockHeight uint64, metadata map[string]string) (*Bundle, error) {
+	message, err := tx.Message.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal transaction message: %w", err)
+	}
+	signers := tx.Message.Signers()
+	b := &Bundle{
+		Version:              BundleVersion,
+		Message:              message,
+		Signers:              signers,
+		Signatures:           make([]solana.Signature, len(signers)),
+		SignerIndex:          -1,
+		LastValidBlockHeight: lastValidBlockHeight,
+		Metadata:             metadata,
+	}
+	for i, key := range signers {
+		if key.Equals(signer) {
+			b.SignerIndex = i
+		}
+	}
+	if b.SignerIndex < 0 {
+		return nil, fmt.Errorf("%s is not a required signer of the transaction", signer)
+	}
+	if len(tx.Signatures) > 0 {
+		if len(tx.Signatures) != len(signers) {
+			return nil, fmt.Errorf("transaction has %d signatures for %d signers", len(tx.Signatures), len(signers))
+		}
+		copy(b.Signatures, tx.Signatures)
+	}
+	return b, nil
+}
+
+// Signer returns the key the bundle waits on
+func (b *Bundle) Signer() solana.PublicKey {
+	return b.Signers[b.SignerIndex]
+}
+
+// Sign signs the message as the bundle's signer with sign, such as the MPC
+// party's SignSolanaMessage, and stores the signature after checking it
+func (b *Bundle) Sign(ctx context.Context, sign SignFunc) error {
+	signer := b.Signer()
+	signature, err := sign(ctx, b.Message)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(signer[:], b.Message, signature) {
+		return fmt.Errorf("signature does not verify against %s", signer)
+	}
+	b.Signatures[b.SignerIndex] = solana.SignatureFromBytes(signature)
+	return nil
+}
+
+// Transaction returns the signed transaction for broadcast. Every signature
+// must be present and valid.
+func (b *Bundle) Transaction() (*solana.Transaction, error) {
+	// A zero signature count in front of the message is a transaction
+	// without signatures
+	tx, err := solana.TransactionFromBytes(append([]byte{0}, b.Message...))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle message: %w", err)
+	}
+	for i, signature := range b.Signatures {
+		if signature.IsZero() {
+			return nil, fmt.Errorf("%w: no signature by %s", ErrBundleUnsigned, b.Signers[i])
+		}
+	}
+	tx.Signatures = append([]solana.Signature(nil), b.Signatures...)
+	if err := tx.VerifySignatures(); err != nil {
+		return nil, fmt.Errorf("invalid bundle signatures: %w", err)
+	}
+	return tx, nil
+}
+
+// checksum hashes the bundle with its checksum left out
+func (b Bundle) checksum() (string, error) {
+	b.Checksum = ""
+	data, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// validate checks that the bundle is well formed
+func (b *Bundle) validate() error {
+	if b.Version != BundleVersion {
+		return fmt.Errorf("%w: %d, want %d", ErrBundleVersion, b.Version, BundleVersion)
+	}
+	if len(b.Signers) == 0 || len(b.Signatures) != len(b.Signers) {
+		return fmt.Errorf("bundle has %d signatures for %d signers", len(b.Signatures), len(b.Signers))
+	}
+	if b.SignerIndex < 0 || b.SignerIndex >= len(b.Signers) {
+		return fmt.Errorf("bundle signer index %d out of range", b.SignerIndex)
+	}
+	return nil
+}
+
+// WriteBundle checksums b and writes it to path
+func WriteBundle(path string, b *Bundle) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	sum, err := b.checksum()
+	if err != nil {
+		return err
+	}
+	b.Checksum = sum
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle: %w", err)
+	}
+
+	// Validators signing a shared bundle each write it whole
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close bundle: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadBundle reads the bundle at path, checking its version and checksum
+func ReadBundle(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("invalid bundle %s: %w", path, err)
+	}
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	sum, err := b.checksum()
+	if err != nil {
+		return nil, err
+	}
+	if sum != b.Checksum {
+		return nil, fmt.Errorf("%w: %s", ErrBundleChecksum, path)
+	}
+	return &b, nil
+}
@@ -0,0 +1,123 @@
+package solanatx
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	threshold, feePayer := solana.NewWallet().PrivateKey, solana.NewWallet().PrivateKey
+	authority := threshold.PublicKey()
+	instruction, err := NewPaymentInstruction(ProgramID, authority, Payment{})
+	require.NoError(t, err)
+	tx, err := solana.NewTransaction([]solana.Instruction{instruction}, solana.Hash{1}, solana.TransactionPayer(feePayer.PublicKey()))
+	require.NoError(t, err)
+
+	// The online machine signs as fee payer before exporting
+	require.NoError(t, Sign(ctx, tx, feePayer.PublicKey(), KeySigner(feePayer)))
+	b, err := NewBundle(tx, authority, 150, map[string]string{"ballot": "demo"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, b.SignerIndex)
+	assert.Equal(t, authority, b.Signer())
+	_, err = b.Transaction()
+	assert.ErrorIs(t, err, ErrBundleUnsigned)
+
+	path := filepath.Join(t.TempDir(), "payout.bundle")
+	require.NoError(t, WriteBundle(path, b))
+	read, err := ReadBundle(path)
+	require.NoError(t, err)
+	assert.Equal(t, b, read)
+
+	// Offline validators sign the message and hand the bundle back
+	require.Error(t, read.Sign(ctx, KeySigner(feePayer)))
+	require.NoError(t, read.Sign(ctx, KeySigner(threshold)))
+	require.NoError(t, WriteBundle(path, read))
+	signed, err := ReadBundle(path)
+	require.NoError(t, err)
+	out, err := signed.Transaction()
+	require.NoError(t, err)
+	require.NoError(t, Sign(ctx, tx, authority, KeySigner(threshold)))
+	want, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	got, err := out.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	_, err = NewBundle(tx, solana.NewWallet().PublicKey(), 150, nil)
+	assert.ErrorContains(t, err, "is not a required signer")
+}
+
+func TestBundleVersioned(t *testing.T) {
+	ctx := context.Background()
+	threshold := solana.NewWallet().PrivateKey
+	authority := threshold.PublicKey()
+	payment := randomPayment(3)
+	addresses, err := PaymentLookupAddresses(authority, payment, nil)
+	require.NoError(t, err)
+	table := LookupTable{Address: key(1), Authority: authority, Addresses: addresses}
+	txs, err := BuildVersionedTransferTransactions(ProgramID, authority, solana.Hash{2}, []LookupTable{table}, payment, nil, ComputeBudget{})
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+
+	b, err := NewBundle(txs[0], authority, math.MaxUint64, nil)
+	require.NoError(t, err)
+	require.NoError(t, b.Sign(ctx, KeySigner(threshold)))
+	tx, err := b.Transaction()
+	require.NoError(t, err)
+	require.NoError(t, Sign(ctx, txs[0], authority, KeySigner(threshold)))
+	want, err := txs[0].MarshalBinary()
+	require.NoError(t, err)
+	got, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, want, got, "the lookups survive the bundle")
+}
+
+func TestReadBundleRejects(t *testing.T) {
+	threshold := solana.NewWallet().PrivateKey
+	instruction, err := NewPaymentInstruction(ProgramID, threshold.PublicKey(), Payment{})
+	require.NoError(t, err)
+	tx, err := solana.NewTransaction([]solana.Instruction{instruction}, solana.Hash{1}, solana.TransactionPayer(threshold.PublicKey()))
+	require.NoError(t, err)
+	b, err := NewBundle(tx, threshold.PublicKey(), 150, nil)
+	require.NoError(t, err)
+	dir := t.TempDir()
+
+	rewrite := func(name string, change func(raw map[string]any)) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, WriteBundle(path, b))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var raw map[string]any
+		require.NoError(t, json.Unmarshal(data, &raw))
+		change(raw)
+		data, err = json.Marshal(raw)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		return path
+	}
+
+	// A tampered message no longer matches the checksum
+	_, err = ReadBundle(rewrite("tampered", func(raw map[string]any) {
+		raw["last_valid_block_height"] = 1 << 40
+	}))
+	assert.ErrorIs(t, err, ErrBundleChecksum)
+	_, err = ReadBundle(rewrite("future", func(raw map[string]any) {
+		raw["version"] = BundleVersion + 1
+	}))
+	assert.ErrorIs(t, err, ErrBundleVersion)
+	_, err = ReadBundle(rewrite("index", func(raw map[string]any) {
+		raw["signer_index"] = 5
+	}))
+	assert.ErrorContains(t, err, "out of range")
+	_, err = ReadBundle(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
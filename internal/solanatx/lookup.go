@@ -0,0 +1,181 @@
+package solanatx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/gagliardetto/solana-go"
+	addresslookuptable "github.com/gagliardetto/solana-go/programs/address-lookup-table"
+)
+
+// LookupTableProgramID is the address lookup table program
+var LookupTableProgramID = solana.MustPublicKeyFromBase58("AddressLookupTab1e1111111111111111111111111")
+
+const (
+	// MaxLookupTableAddresses is how many addresses a lookup table holds
+	MaxLookupTableAddresses = addresslookuptable.LOOKUP_TABLE_MAX_ADDRESSES
+	// LookupTableMetaSize is the size of a lookup table account without addresses
+	LookupTableMetaSize = addresslookuptable.LOOKUP_TABLE_META_SIZE
+	// MaxExtendAddresses is how many addresses one extension adds while
+	// fitting a transaction with room for a compute budget
+	MaxExtendAddresses = 24
+)
+
+// LookupTable is an address lookup table. A v0 transaction referencing it
+// names each of its addresses with a one byte index instead of 32 bytes, so a
+// transaction fits about half as many more receivers again.
+type LookupTable struct {
+	Address   solana.PublicKey
+	Authority solana.PublicKey
+	Addresses solana.PublicKeySlice
+}
+
+// LookupTableAddress derives the table authority creates at recentSlot
+func LookupTableAddress(authority solana.PublicKey, recentSlot uint64) (solana.PublicKey, uint8, error) {
+	return solana.FindProgramAddress([][]byte{authority[:], binary.LittleEndian.AppendUint64(nil, recentSlot)}, LookupTableProgramID)
+}
+
+// CreateLookupTableInstruction creates an empty table that only authority,
+// normally the threshold key, can extend. payer funds it; the authority does
+// not sign, so a table for the threshold key needs no MPC round. recentSlot
+// must be a slot the cluster still remembers.
+func CreateLookupTableInstruction(authority, payer solana.PublicKey, recentSlot uint64) (solana.Instruction, solana.PublicKey, error) {
+	table, bump, err := LookupTableAddress(authority, recentSlot)
+	if err != nil {
+		return nil, solana.PublicKey{}, fmt.Errorf("failed to derive lookup table address: %w", err)
+	}
+	data := binary.LittleEndian.AppendUint32(nil, 0) // CreateLookupTable
+	data = binary.LittleEndian.AppendUint64(data, recentSlot)
+	data = append(data, bump)
+	accounts := []*solana.AccountMeta{
+		{PublicKey: table, IsWritable: true},
+		{PublicKey: authority},
+		{PublicKey: payer, IsSigner: true, IsWritable: true},
+		{PublicKey: solana.SystemProgramID},
+	}
+	return solana.NewInstruction(LookupTableProgramID, accounts, data), table, nil
+}
+
+// ExtendLookupTableInstruction appends addresses to table, signed by the
+// table's authority; payer tops up its rent
+func ExtendLookupTableInstruction(table LookupTable, payer solana.PublicKey, addresses []solana.PublicKey) (solana.Instruction, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no addresses to add to lookup table %s", table.Address)
+	}
+	if len(table.Addresses)+len(addresses) > MaxLookupTableAddresses {
+		return nil, fmt.Errorf("lookup table %s holds %d addresses, %d more exceed the %d allowed", table.Address, len(table.Addresses), len(addresses), MaxLookupTableAddresses)
+	}
+	data := binary.LittleEndian.AppendUint32(nil, 2) // ExtendLookupTable
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(addresses)))
+	for _, address := range addresses {
+		data = append(data, address[:]...)
+	}
+	accounts := []*solana.AccountMeta{
+		{PublicKey: table.Address, IsWritable: true},
+		{PublicKey: table.Authority, IsSigner: true},
+		{PublicKey: payer, IsSigner: true, IsWritable: true},
+		{PublicKey: solana.SystemProgramID},
+	}
+	return solana.NewInstruction(LookupTableProgramID, accounts, data), nil
+}
+
+// ParseLookupTable decodes the data of an active lookup table with an authority
+func ParseLookupTable(address solana.PublicKey, data []byte) (LookupTable, error) {
+	if len(data) < LookupTableMetaSize {
+		return LookupTable{}, fmt.Errorf("lookup table %s has %d bytes, want at least %d", address, len(data), LookupTableMetaSize)
+	}
+	state, err := addresslookuptable.DecodeAddressLookupTableState(data)
+	if err != nil {
+		return LookupTable{}, fmt.Errorf("invalid lookup table %s: %w", address, err)
+	}
+	if state.DeactivationSlot != math.MaxUint64 {
+		return LookupTable{}, fmt.Errorf("lookup table %s is deactivated", address)
+	}
+	if state.Authority == nil {
+		return LookupTable{}, fmt.Errorf("lookup table %s is frozen", address)
+	}
+	return LookupTable{Address: address, Authority: *state.Authority, Addresses: state.Addresses}, nil
+}
+
+// Missing returns the addresses not in t yet, in order and without duplicates
+func (t LookupTable) Missing(addresses []solana.PublicKey) []solana.PublicKey {
+	var missing solana.PublicKeySlice
+	for _, address := range addresses {
+		if !t.Addresses.Has(address) && !missing.Has(address) {
+			missing = append(missing, address)
+		}
+	}
+	return missing
+}
+
+// LookupAddresses returns the accounts of instructions that a lookup table
+// can stand in for: neither signers nor invoked programs. The order is stable
+// so every validator extends a table the same way.
+func LookupAddresses(instructions []solana.Instruction) []solana.PublicKey {
+	var programs, addresses solana.PublicKeySlice
+	for _, ix := range instructions {
+		programs = append(programs, ix.ProgramID())
+	}
+	for _, ix := range instructions {
+		for _, account := range ix.Accounts() {
+			if account.IsSigner || programs.Has(account.PublicKey) || addresses.Has(account.PublicKey) {
+				continue
+			}
+			addresses = append(addresses, account.PublicKey)
+		}
+	}
+	return addresses
+}
+
+// PaymentLookupAddresses returns the addresses the transfers of p look up
+func PaymentLookupAddresses(authority solana.PublicKey, p Payment, tok *Token) ([]solana.PublicKey, error) {
+	transfers, err := TransferInstructions(authority, tok, p)
+	if err != nil {
+		return nil, err
+	}
+	return LookupAddresses(transfers), nil
+}
+
+// BuildVersionedTransferTransactions is BuildTransferTransactions as v0
+// transactions, each looking up its accounts in the one of tables holding
+// the most of them; accounts in no table stay in the message. A transaction
+// uses a single table so that validators compile identical messages.
+func BuildVersionedTransferTransactions(programID, authority solana.PublicKey, blockhash solana.Hash, tables []LookupTable, p Payment, tok *Token, budget ComputeBudget) ([]*solana.Transaction, error) {
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no lookup table given")
+	}
+	return buildBatches(p, func(_ int, part Payment) (*solana.Transaction, error) {
+		instructions, err := transferBatch(programID, authority, part, tok, budget)
+		if err != nil {
+			return nil, err
+		}
+		return NewVersionedTransaction(instructions, blockhash, authority, bestTable(tables, LookupAddresses(instructions)))
+	})
+}
+
+// NewVersionedTransaction builds a v0 transaction looking up the accounts of
+// instructions in table
+func NewVersionedTransaction(instructions []solana.Instruction, blockhash solana.Hash, payer solana.PublicKey, table LookupTable) (*solana.Transaction, error) {
+	tx, err := solana.NewTransaction(instructions, blockhash,
+		solana.TransactionPayer(payer),
+		solana.TransactionAddressTables(map[solana.PublicKey]solana.PublicKeySlice{table.Address: table.Addresses}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+	// Without lookups the message would still be encoded as legacy
+	tx.Message.SetVersion(solana.MessageVersionV0)
+	return tx, nil
+}
+
+// bestTable returns the first of tables holding the most of addresses
+func bestTable(tables []LookupTable, addresses []solana.PublicKey) LookupTable {
+	best, most := tables[0], -1
+	for _, table := range tables {
+		if n := len(addresses) - len(table.Missing(addresses)); n > most {
+			best, most = table, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,119 @@
+package solanatx
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lookupTableData lays out an active lookup table
+func lookupTableData(authority solana.PublicKey, addresses ...solana.PublicKey) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, 1)
+	data = binary.LittleEndian.AppendUint64(data, math.MaxUint64)
+	data = binary.LittleEndian.AppendUint64(data, 7)
+	data = append(data, 0, 1)
+	data = append(data, authority[:]...)
+	data = append(data, 0, 0)
+	for _, address := range addresses {
+		data = append(data, address[:]...)
+	}
+	return data
+}
+
+func TestLookupTable(t *testing.T) {
+	authority, payer := key(1), key(2)
+	create, address, err := CreateLookupTableInstruction(authority, payer, 1234)
+	require.NoError(t, err)
+	derived, bump, err := LookupTableAddress(authority, 1234)
+	require.NoError(t, err)
+	assert.Equal(t, derived, address)
+	other, _, err := LookupTableAddress(authority, 1235)
+	require.NoError(t, err)
+	assert.NotEqual(t, address, other, "every slot gives a new table")
+
+	assert.Equal(t, LookupTableProgramID, create.ProgramID())
+	data, err := create.Data()
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{0, 0, 0, 0, 0xd2, 0x04, 0, 0, 0, 0, 0, 0}, bump), data) // CreateLookupTable at 1234
+	keys := create.Accounts()
+	assert.Equal(t, address, keys[0].PublicKey)
+	assert.False(t, keys[1].IsSigner, "the threshold key does not sign the creation")
+	assert.True(t, keys[2].IsSigner)
+
+	table := LookupTable{Address: address, Authority: authority, Addresses: solana.PublicKeySlice{key(3)}}
+	extend, err := ExtendLookupTableInstruction(table, payer, []solana.PublicKey{key(4), key(5)})
+	require.NoError(t, err)
+	data, err = extend.Data()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(data)) // ExtendLookupTable
+	assert.Equal(t, uint64(2), binary.LittleEndian.Uint64(data[4:]))
+	assert.Equal(t, append(key(4).Bytes(), key(5).Bytes()...), data[12:])
+	assert.True(t, extend.Accounts()[1].IsSigner, "the authority signs extensions")
+	_, err = ExtendLookupTableInstruction(table, payer, nil)
+	assert.Error(t, err)
+	_, err = ExtendLookupTableInstruction(table, payer, make([]solana.PublicKey, MaxLookupTableAddresses))
+	assert.ErrorContains(t, err, "exceed")
+
+	parsed, err := ParseLookupTable(address, lookupTableData(authority, key(3), key(4)))
+	require.NoError(t, err)
+	assert.Equal(t, LookupTable{Address: address, Authority: authority, Addresses: solana.PublicKeySlice{key(3), key(4)}}, parsed)
+	assert.Equal(t, []solana.PublicKey{key(5), key(6)}, parsed.Missing([]solana.PublicKey{key(4), key(5), key(3), key(6), key(5)}))
+	_, err = ParseLookupTable(address, make([]byte, 10))
+	assert.ErrorContains(t, err, "has 10 bytes")
+	deactivated := lookupTableData(authority)
+	deactivated[4] = 9
+	_, err = ParseLookupTable(address, deactivated)
+	assert.ErrorContains(t, err, "deactivated")
+}
+
+func TestBuildVersionedTransferTransactions(t *testing.T) {
+	authority := solana.NewWallet().PublicKey()
+	payment := randomPayment(60)
+	addresses, err := PaymentLookupAddresses(authority, payment, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []solana.PublicKey(payment.Receivers), addresses, "the system program and the authority are not looked up")
+
+	legacy, err := BuildTransferTransactions(ProgramID, authority, solana.Hash{}, payment, nil, ComputeBudget{})
+	require.NoError(t, err)
+	tables := []LookupTable{
+		{Address: key(1), Authority: authority, Addresses: solana.PublicKeySlice(payment.Receivers[:10])},
+		{Address: key(2), Authority: authority, Addresses: solana.PublicKeySlice(payment.Receivers)},
+	}
+	txs, err := BuildVersionedTransferTransactions(ProgramID, authority, solana.Hash{}, tables, payment, nil, ComputeBudget{})
+	require.NoError(t, err)
+	assert.Less(t, len(txs), len(legacy), "lookups fit more receivers per transaction")
+
+	var paid uint64
+	var receivers []solana.PublicKey
+	for _, tx := range txs {
+		size, err := Size(tx)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, size, MaxTransactionSize)
+		message, err := tx.Message.MarshalBinary()
+		require.NoError(t, err)
+		assert.Equal(t, byte(0x80), message[0], "v0 messages carry a version prefix")
+
+		// Every transaction uses the table holding all its receivers
+		require.Len(t, tx.Message.AddressTableLookups, 1)
+		assert.Equal(t, key(2), tx.Message.AddressTableLookups[0].AccountKey)
+		assert.Equal(t, []solana.PublicKey{authority, ProgramID, solana.SystemProgramID}, []solana.PublicKey(tx.Message.AccountKeys))
+		require.NoError(t, tx.Message.ResolveLookups())
+
+		program, _ := accounts(tx, tx.Message.Instructions[0])
+		require.Equal(t, ProgramID, program)
+		paid += decodePayment(t, tx.Message.Instructions[0].Data).TotalAmount
+		for _, ix := range tx.Message.Instructions[1:] {
+			_, keys := accounts(tx, ix)
+			receivers = append(receivers, keys[1])
+		}
+	}
+	assert.Equal(t, payment.TotalAmount, paid)
+	assert.Equal(t, []solana.PublicKey(payment.Receivers), receivers)
+
+	_, err = BuildVersionedTransferTransactions(ProgramID, authority, solana.Hash{}, nil, payment, nil, ComputeBudget{})
+	assert.Error(t, err)
+}
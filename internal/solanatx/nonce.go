@@ -0,0 +1,102 @@
+package solanatx
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+)
+
+// NonceAccountSize is the size of a system program nonce account
+const NonceAccountSize = 80
+
+// DurableNonce is a nonce account and its current value. Transactions built
+// with it use the value in place of a recent blockhash and stay valid until
+// the nonce is advanced, however long MPC signing takes.
+type DurableNonce struct {
+	Account   solana.PublicKey
+	Authority solana.PublicKey
+	Value     solana.Hash
+}
+
+// CreateNonceAccountInstructions creates nonceAccount funded with lamports by
+// payer and initializes it with authority, normally the threshold key, as the
+// only key that can advance it. The new account signs its creation once.
+func CreateNonceAccountInstructions(payer, nonceAccount, authority solana.PublicKey, lamports uint64) ([]solana.Instruction, error) {
+	create, err := system.NewCreateAccountInstruction(lamports, NonceAccountSize, solana.SystemProgramID, payer, nonceAccount).ValidateAndBuild()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build nonce account creation: %w", err)
+	}
+	initialize, err := system.NewInitializeNonceAccountInstruction(authority, nonceAccount, solana.SysVarRecentBlockHashesPubkey, solana.SysVarRentPubkey).ValidateAndBuild()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build nonce account initialization: %w", err)
+	}
+	return []solana.Instruction{create, initialize}, nil
+}
+
+// AdvanceNonceInstruction consumes the nonce; it must be a durable
+// transaction's first instruction
+func AdvanceNonceInstruction(n DurableNonce) (solana.Instruction, error) {
+	advance, err := system.NewAdvanceNonceAccountInstruction(n.Account, solana.SysVarRecentBlockHashesPubkey, n.Authority).ValidateAndBuild()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build nonce advance: %w", err)
+	}
+	return advance, nil
+}
+
+// DurableNonceAccount returns the nonce account a durable transaction
+// advances in its first instruction; ok is false for any other transaction
+func DurableNonceAccount(message solana.Message) (account solana.PublicKey, ok bool) {
+	if len(message.Instructions) == 0 {
+		return solana.PublicKey{}, false
+	}
+	first := message.Instructions[0]
+	program, err := message.Program(first.ProgramIDIndex)
+	if err != nil || !program.Equals(solana.SystemProgramID) {
+		return solana.PublicKey{}, false
+	}
+	keys, err := first.ResolveInstructionAccounts(&message)
+	if err != nil {
+		return solana.PublicKey{}, false
+	}
+	instruction, err := system.DecodeInstruction(keys, first.Data)
+	if err != nil {
+		return solana.PublicKey{}, false
+	}
+	advance, ok := instruction.Impl.(*system.AdvanceNonceAccount)
+	if !ok {
+		return solana.PublicKey{}, false
+	}
+	return advance.GetNonceAccount().PublicKey, true
+}
+
+// ParseNonceAccount decodes the data of an initialized nonce account
+func ParseNonceAccount(account solana.PublicKey, data []byte) (DurableNonce, error) {
+	if len(data) != NonceAccountSize {
+		return DurableNonce{}, fmt.Errorf("nonce account %s has %d bytes, want %d", account, len(data), NonceAccountSize)
+	}
+	// version u32, state u32, authority, nonce, lamports per signature u64
+	if state := binary.LittleEndian.Uint32(data[4:]); state != 1 {
+		return DurableNonce{}, fmt.Errorf("nonce account %s is not initialized", account)
+	}
+	return DurableNonce{
+		Account:   account,
+		Authority: solana.PublicKeyFromBytes(data[8:40]),
+		Value:     solana.HashFromBytes(data[40:72]),
+	}, nil
+}
+
+// NewDurableTransaction builds a transaction advancing n before instructions,
+// with n's value as its blockhash
+func NewDurableTransaction(instructions []solana.Instruction, n DurableNonce, payer solana.PublicKey) (*solana.Transaction, error) {
+	advance, err := AdvanceNonceInstruction(n)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := solana.NewTransaction(append([]solana.Instruction{advance}, instructions...), n.Value, solana.TransactionPayer(payer))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+	return tx, nil
+}
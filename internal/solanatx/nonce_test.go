@@ -0,0 +1,90 @@
+package solanatx
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nonceData lays out an initialized nonce account
+func nonceData(authority solana.PublicKey, value solana.Hash) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, 1)
+	data = binary.LittleEndian.AppendUint32(data, 1)
+	data = append(data, authority[:]...)
+	data = append(data, value[:]...)
+	return binary.LittleEndian.AppendUint64(data, 5000)
+}
+
+func TestNonceAccount(t *testing.T) {
+	payer, account, authority := key(1), key(2), key(3)
+	instructions, err := CreateNonceAccountInstructions(payer, account, authority, 1_447_680)
+	require.NoError(t, err)
+	require.Len(t, instructions, 2)
+
+	create, initialize := instructions[0], instructions[1]
+	assert.Equal(t, solana.SystemProgramID, create.ProgramID())
+	createData, err := create.Data()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(createData)) // CreateAccount
+	assert.Equal(t, uint64(1_447_680), binary.LittleEndian.Uint64(createData[4:]))
+	assert.Equal(t, uint64(NonceAccountSize), binary.LittleEndian.Uint64(createData[12:]))
+	assert.Equal(t, payer, create.Accounts()[0].PublicKey)
+	assert.True(t, create.Accounts()[1].IsSigner, "the new account signs its creation")
+
+	initData, err := initialize.Data()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(6), binary.LittleEndian.Uint32(initData)) // InitializeNonceAccount
+	assert.Equal(t, authority[:], initData[4:])
+
+	value := solana.Hash{9, 9, 9}
+	nonce, err := ParseNonceAccount(account, nonceData(authority, value))
+	require.NoError(t, err)
+	assert.Equal(t, DurableNonce{Account: account, Authority: authority, Value: value}, nonce)
+
+	_, err = ParseNonceAccount(account, make([]byte, NonceAccountSize))
+	assert.ErrorContains(t, err, "not initialized")
+	_, err = ParseNonceAccount(account, make([]byte, 10))
+	assert.ErrorContains(t, err, "has 10 bytes")
+}
+
+func TestBuildDurableTransferTransactions(t *testing.T) {
+	authority := solana.NewWallet().PublicKey()
+	nonces := []DurableNonce{
+		{Account: key(1), Authority: authority, Value: solana.Hash{1}},
+		{Account: key(2), Authority: authority, Value: solana.Hash{2}},
+		{Account: key(3), Authority: authority, Value: solana.Hash{3}},
+	}
+	payment := randomPayment(20)
+
+	txs, err := BuildDurableTransferTransactions(ProgramID, authority, nonces, payment, nil, ComputeBudget{})
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+
+	var paid uint64
+	for i, tx := range txs {
+		size, err := Size(tx)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, size, MaxTransactionSize)
+		assert.Equal(t, nonces[i].Value, tx.Message.RecentBlockhash)
+		assert.Equal(t, uint8(1), tx.Message.Header.NumRequiredSignatures, "the threshold key is the nonce authority too")
+
+		// The nonce is advanced first, by its authority
+		program, keys := accounts(tx, tx.Message.Instructions[0])
+		require.Equal(t, solana.SystemProgramID, program)
+		assert.Equal(t, uint32(4), binary.LittleEndian.Uint32(tx.Message.Instructions[0].Data)) // AdvanceNonceAccount
+		assert.Equal(t, []solana.PublicKey{nonces[i].Account, solana.SysVarRecentBlockHashesPubkey, authority}, keys)
+
+		program, _ = accounts(tx, tx.Message.Instructions[1])
+		require.Equal(t, ProgramID, program)
+		paid += decodePayment(t, tx.Message.Instructions[1].Data).TotalAmount
+	}
+	assert.Equal(t, payment.TotalAmount, paid)
+
+	_, err = BuildDurableTransferTransactions(ProgramID, authority, nonces[:1], payment, nil, ComputeBudget{})
+	assert.ErrorContains(t, err, "more than 1 transactions")
+	_, err = BuildDurableTransferTransactions(ProgramID, authority, nil, payment, nil, ComputeBudget{})
+	assert.Error(t, err)
+}
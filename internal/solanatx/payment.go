@@ -0,0 +1,153 @@
+// Package solanatx builds the Solana transactions that check distribution
+// results with the payment_validator program in lib.rs and pay them out
+package solanatx
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"tilt-valid/internal/anchor"
+	"tilt-valid/internal/distribution"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// ProgramID is the payment_validator program declared in lib.rs
+var ProgramID = solana.MustPublicKeyFromBase58("EM7AAngMgQPXizeuwAKaBvci79DhRxJMBYjRVoJWYEH3")
+
+// The checks made by validate_payment_distribution, as PaymentError in lib.rs
+var (
+	ErrMismatchedReceiversAndAmounts = errors.New("number of receivers does not match number of amounts")
+	ErrTotalAmountMismatch           = errors.New("total amount does not match sum of individual amounts")
+)
+
+// Discriminator returns the Anchor discriminator of a global instruction
+func Discriminator(instruction string) [8]byte {
+	return anchor.InstructionDiscriminator(instruction)
+}
+
+//go:embed idl/payment_validator.json
+var paymentValidatorIDL []byte
+
+// PaymentValidator is the IDL of the payment_validator program, from which
+// its instructions are encoded and decoded
+var PaymentValidator = mustParseIDL(paymentValidatorIDL)
+
+var validatePaymentDistribution = mustInstruction(PaymentValidator, "validate_payment_distribution")
+
+func mustParseIDL(data []byte) *anchor.IDL {
+	idl, err := anchor.ParseIDL(data)
+	if err != nil {
+		panic(err)
+	}
+	return idl
+}
+
+func mustInstruction(idl *anchor.IDL, name string) *anchor.Instruction {
+	ix, err := idl.Instruction(name)
+	if err != nil {
+		panic(err)
+	}
+	return ix
+}
+
+// Payment holds the arguments of validate_payment_distribution: Amounts[i]
+// goes to Receivers[i] and they must sum to TotalAmount
+type Payment struct {
+	TotalAmount uint64
+	Receivers   []solana.PublicKey
+	Amounts     []uint64
+}
+
+// FromDistribution converts a distribution payment, whose receivers are
+// base58 addresses
+func FromDistribution(p distribution.Payment) (Payment, error) {
+	payment := Payment{TotalAmount: p.Total, Amounts: p.Amounts}
+	for _, receiver := range p.Receivers {
+		key, err := solana.PublicKeyFromBase58(receiver)
+		if err != nil {
+			return Payment{}, fmt.Errorf("invalid receiver %q: %v", receiver, err)
+		}
+		payment.Receivers = append(payment.Receivers, key)
+	}
+	return payment, nil
+}
+
+// Validate makes the program's checks, so a payment that would be rejected
+// on-chain is never signed
+func (p Payment) Validate() error {
+	if len(p.Receivers) != len(p.Amounts) {
+		return fmt.Errorf("%w: %d receivers, %d amounts", ErrMismatchedReceiversAndAmounts, len(p.Receivers), len(p.Amounts))
+	}
+	var sum uint64
+	for _, amount := range p.Amounts {
+		var carry uint64
+		if sum, carry = bits.Add64(sum, amount, 0); carry != 0 {
+			return fmt.Errorf("%w: amounts overflow u64", ErrTotalAmountMismatch)
+		}
+	}
+	if sum != p.TotalAmount {
+		return fmt.Errorf("%w: amounts sum to %d, total is %d", ErrTotalAmountMismatch, sum, p.TotalAmount)
+	}
+	return nil
+}
+
+// Data encodes the instruction data from the IDL: the Anchor discriminator
+// followed by the Borsh encoding of total_amount: u64, receivers: Vec<Pubkey>
+// and amounts: Vec<u64>
+func (p Payment) Data() []byte {
+	data, err := PaymentValidator.Encode(validatePaymentDistribution, p.args())
+	if err != nil {
+		// The arguments have the types the embedded IDL declares
+		panic(err)
+	}
+	return data
+}
+
+// args returns the IDL arguments of validate_payment_distribution
+func (p Payment) args() map[string]any {
+	return map[string]any{"total_amount": p.TotalAmount, "receivers": p.Receivers, "amounts": p.Amounts}
+}
+
+// ParsePayment decodes instruction data written by Data, without validating
+// the payment itself
+func ParsePayment(data []byte) (Payment, error) {
+	if !bytes.HasPrefix(data, validatePaymentDistribution.Discriminator) {
+		return Payment{}, errors.New("not a validate_payment_distribution instruction")
+	}
+	_, args, err := PaymentValidator.Decode(data)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	// Decode returns the types the IDL declares
+	p := Payment{TotalAmount: args["total_amount"].(uint64)}
+	for _, receiver := range args["receivers"].([]any) {
+		p.Receivers = append(p.Receivers, receiver.(solana.PublicKey))
+	}
+	for _, amount := range args["amounts"].([]any) {
+		p.Amounts = append(p.Amounts, amount.(uint64))
+	}
+	return p, nil
+}
+
+// NewPaymentInstruction validates p and builds the instruction; sender is the
+// ValidatePayment signer
+func NewPaymentInstruction(programID, sender solana.PublicKey, p Payment) (solana.Instruction, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return PaymentValidator.NewInstruction(programID, validatePaymentDistribution, []solana.PublicKey{sender}, p.args())
+}
+
+// slice returns receivers i to j with their own total
+func (p Payment) slice(i, j int) Payment {
+	part := Payment{Receivers: p.Receivers[i:j], Amounts: p.Amounts[i:j]}
+	for _, amount := range part.Amounts {
+		part.TotalAmount += amount // bounded by the validated total
+	}
+	return part
+}
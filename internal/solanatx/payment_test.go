@@ -0,0 +1,143 @@
+package solanatx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"tilt-valid/internal/distribution"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func key(b byte) solana.PublicKey {
+	return solana.PublicKeyFromBytes(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestPaymentDataGolden(t *testing.T) {
+	payment := Payment{TotalAmount: 300, Receivers: []solana.PublicKey{key(1), key(2)}, Amounts: []uint64{100, 200}}
+
+	// validate_payment_distribution(total_amount: u64, receivers: Vec<Pubkey>, amounts: Vec<u64>)
+	golden := "43a04bcd33172680" + // sha256("global:validate_payment_distribution")[:8]
+		"2c01000000000000" + // total_amount = 300
+		"02000000" + strings.Repeat("01", 32) + strings.Repeat("02", 32) +
+		"02000000" + "6400000000000000" + "c800000000000000"
+	assert.Equal(t, golden, hex.EncodeToString(payment.Data()))
+
+	empty := Payment{}
+	assert.Equal(t, "43a04bcd33172680"+"0000000000000000"+"00000000"+"00000000", hex.EncodeToString(empty.Data()))
+
+	parsed, err := ParsePayment(payment.Data())
+	require.NoError(t, err)
+	assert.Equal(t, payment, parsed)
+	for _, n := range []int{0, 7, 20, len(payment.Data()) - 1} {
+		_, err = ParsePayment(payment.Data()[:n])
+		assert.Error(t, err, n)
+	}
+	_, err = ParsePayment(append(payment.Data(), 0))
+	assert.ErrorContains(t, err, "1 trailing bytes")
+}
+
+func TestPaymentValidatorIDL(t *testing.T) {
+	assert.Equal(t, ProgramID.String(), PaymentValidator.Address)
+	assert.Equal(t, Discriminator("validate_payment_distribution"), [8]byte(validatePaymentDistribution.Discriminator))
+
+	// The IDL errors are PaymentError in lib.rs, numbered from Anchor's 6000
+	require.Len(t, PaymentValidator.Errors, 2)
+	assert.Equal(t, uint32(6000), PaymentValidator.Errors[0].Code)
+	assert.True(t, strings.EqualFold(PaymentValidator.Errors[0].Msg, ErrMismatchedReceiversAndAmounts.Error()))
+	assert.True(t, strings.EqualFold(PaymentValidator.Errors[1].Msg, ErrTotalAmountMismatch.Error()))
+
+	payment := Payment{TotalAmount: 3, Receivers: []solana.PublicKey{key(1), key(2)}, Amounts: []uint64{1, 2}}
+	ix, args, err := PaymentValidator.Decode(payment.Data())
+	require.NoError(t, err)
+	assert.Equal(t, "validate_payment_distribution(total_amount: 3, receivers: ["+key(1).String()+" "+key(2).String()+"], amounts: [1 2])", ix.Format(args))
+}
+
+func TestPaymentValidate(t *testing.T) {
+	assert.NoError(t, Payment{}.Validate())
+
+	err := Payment{TotalAmount: 1, Receivers: []solana.PublicKey{key(1)}}.Validate()
+	assert.ErrorIs(t, err, ErrMismatchedReceiversAndAmounts)
+
+	err = Payment{TotalAmount: 1, Receivers: []solana.PublicKey{key(1)}, Amounts: []uint64{2}}.Validate()
+	assert.ErrorIs(t, err, ErrTotalAmountMismatch)
+
+	err = Payment{Receivers: []solana.PublicKey{key(1), key(2)}, Amounts: []uint64{1 << 63, 1 << 63}}.Validate()
+	assert.ErrorIs(t, err, ErrTotalAmountMismatch)
+
+	_, err = NewPaymentInstruction(ProgramID, key(9), Payment{TotalAmount: 5})
+	assert.ErrorIs(t, err, ErrTotalAmountMismatch)
+}
+
+func TestFromDistribution(t *testing.T) {
+	payment, err := FromDistribution(distribution.Payment{
+		Asset:     distribution.NativeSOL,
+		Total:     7,
+		Receivers: []string{key(1).String(), key(2).String()},
+		Amounts:   []uint64{3, 4},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Payment{TotalAmount: 7, Receivers: []solana.PublicKey{key(1), key(2)}, Amounts: []uint64{3, 4}}, payment)
+
+	_, err = FromDistribution(distribution.Payment{Receivers: []string{"alice"}, Amounts: []uint64{1}})
+	assert.ErrorContains(t, err, `invalid receiver "alice"`)
+}
+
+// decodePayment reads back the instruction data written by Payment.Data
+func decodePayment(t *testing.T, data []byte) Payment {
+	p, err := ParsePayment(data)
+	require.NoError(t, err)
+	return p
+}
+
+func TestBuildPaymentTransactionsSplits(t *testing.T) {
+	payer := key(0xfe)
+	var blockhash solana.Hash
+	payment := Payment{}
+	for i := 0; i < 100; i++ {
+		payment.Receivers = append(payment.Receivers, key(byte(i)))
+		payment.Amounts = append(payment.Amounts, uint64(i*1000+1))
+		payment.TotalAmount += uint64(i*1000 + 1)
+	}
+
+	txs, err := BuildPaymentTransactions(ProgramID, payer, blockhash, payment)
+	require.NoError(t, err)
+	// 195 bytes of overhead and 40 per receiver: 25 receivers per transaction
+	require.Len(t, txs, 4)
+
+	var rebuilt Payment
+	for _, tx := range txs {
+		size, err := Size(tx)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, size, MaxTransactionSize)
+		assert.Equal(t, payer, tx.Message.AccountKeys[0])
+
+		require.Len(t, tx.Message.Instructions, 1)
+		part := decodePayment(t, tx.Message.Instructions[0].Data)
+		require.NoError(t, part.Validate())
+		rebuilt.TotalAmount += part.TotalAmount
+		rebuilt.Receivers = append(rebuilt.Receivers, part.Receivers...)
+		rebuilt.Amounts = append(rebuilt.Amounts, part.Amounts...)
+	}
+	assert.Equal(t, payment, rebuilt)
+
+	// The size is what the signed transaction serializes to
+	txs[0].Signatures = make([]solana.Signature, 1)
+	signed, err := txs[0].MarshalBinary()
+	require.NoError(t, err)
+	size, err := Size(txs[0])
+	require.NoError(t, err)
+	assert.Equal(t, len(signed), size)
+	assert.Equal(t, 195+40*25, size)
+
+	txs, err = BuildPaymentTransactions(ProgramID, payer, blockhash, Payment{})
+	require.NoError(t, err)
+	assert.Len(t, txs, 1)
+
+	_, err = BuildPaymentTransactions(ProgramID, payer, blockhash, Payment{TotalAmount: 1})
+	assert.ErrorIs(t, err, ErrTotalAmountMismatch)
+}
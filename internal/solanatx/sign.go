@@ -0,0 +1,72 @@
+package solanatx
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// ThresholdAccount returns the Solana account of the MPC threshold public key
+// returned by Party.ThresholdPK
+func ThresholdAccount(thresholdPK []byte) (solana.PublicKey, error) {
+	if len(thresholdPK) != ed25519.PublicKeySize {
+		return solana.PublicKey{}, fmt.Errorf("threshold public key has %d bytes, want %d", len(thresholdPK), ed25519.PublicKeySize)
+	}
+	return solana.PublicKeyFromBytes(thresholdPK), nil
+}
+
+// AddSignature stores signer's signature at signer's index among the
+// transaction's required signers, leaving the other signatures in place
+func AddSignature(tx *solana.Transaction, signer solana.PublicKey, signature []byte) error {
+	if len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("signature has %d bytes, want %d", len(signature), ed25519.SignatureSize)
+	}
+	signers := tx.Message.Signers()
+	index := -1
+	for i, key := range signers {
+		if key.Equals(signer) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%s is not a required signer of the transaction", signer)
+	}
+
+	if len(tx.Signatures) == 0 {
+		tx.Signatures = make([]solana.Signature, len(signers))
+	} else if len(tx.Signatures) != len(signers) {
+		return fmt.Errorf("transaction has %d signatures for %d signers", len(tx.Signatures), len(signers))
+	}
+	tx.Signatures[index] = solana.SignatureFromBytes(signature)
+	return nil
+}
+
+// SignFunc signs a serialized transaction message, like the MPC party's Sign
+type SignFunc func(ctx context.Context, message []byte) ([]byte, error)
+
+// Sign signs tx's message as signer with sign, checks the signature and adds
+// it at signer's index
+func Sign(ctx context.Context, tx *solana.Transaction, signer solana.PublicKey, sign SignFunc) error {
+	message, err := tx.Message.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to marshal transaction message: %w", err)
+	}
+	signature, err := sign(ctx, message)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(signer[:], message, signature) {
+		return fmt.Errorf("signature does not verify against %s", signer)
+	}
+	return AddSignature(tx, signer, signature)
+}
+
+// KeySigner signs with a local key, such as a fee payer loaded by the keypair package
+func KeySigner(key solana.PrivateKey) SignFunc {
+	return func(_ context.Context, message []byte) ([]byte, error) {
+		return ed25519.Sign(ed25519.PrivateKey(key), message), nil
+	}
+}
@@ -0,0 +1,45 @@
+package solanatx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignPlacesSignatureAtSignerIndex(t *testing.T) {
+	threshold, cosigner := solana.NewWallet().PrivateKey, solana.NewWallet().PrivateKey
+	thresholdKey, err := ThresholdAccount(threshold.PublicKey().Bytes())
+	require.NoError(t, err)
+
+	// The co-signer pays the fees, so the threshold key signs second
+	instruction, err := NewPaymentInstruction(ProgramID, thresholdKey, Payment{})
+	require.NoError(t, err)
+	tx, err := solana.NewTransaction([]solana.Instruction{instruction}, solana.Hash{1}, solana.TransactionPayer(cosigner.PublicKey()))
+	require.NoError(t, err)
+	require.Equal(t, []solana.PublicKey{cosigner.PublicKey(), thresholdKey}, []solana.PublicKey(tx.Message.Signers()))
+
+	ctx := context.Background()
+	require.NoError(t, Sign(ctx, tx, thresholdKey, KeySigner(threshold)))
+	assert.Len(t, tx.Signatures, 2)
+	assert.True(t, tx.Signatures[0].IsZero())
+	assert.Error(t, tx.VerifySignatures(), "the co-signer has not signed yet")
+
+	require.NoError(t, Sign(ctx, tx, cosigner.PublicKey(), KeySigner(cosigner)))
+	assert.NoError(t, tx.VerifySignatures())
+
+	// Signatures that would be rejected on-chain are never added
+	err = Sign(ctx, tx, thresholdKey, KeySigner(cosigner))
+	assert.ErrorContains(t, err, "does not verify")
+	err = Sign(ctx, tx, solana.NewWallet().PublicKey(), KeySigner(cosigner))
+	assert.ErrorContains(t, err, "does not verify")
+	other := solana.NewWallet().PrivateKey
+	err = Sign(ctx, tx, other.PublicKey(), KeySigner(other))
+	assert.ErrorContains(t, err, "is not a required signer")
+	assert.NoError(t, tx.VerifySignatures())
+
+	_, err = ThresholdAccount(make([]byte, 33))
+	assert.Error(t, err)
+}
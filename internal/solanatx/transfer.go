@@ -0,0 +1,115 @@
+package solanatx
+
+import (
+	"fmt"
+
+	"tilt-valid/internal/distribution"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/programs/token"
+)
+
+// Token is an SPL token; TransferChecked fails unless Decimals match the mint
+type Token struct {
+	Mint     solana.PublicKey
+	Decimals uint8
+}
+
+// NewToken returns the token paid by asset, or nil for native SOL. decimals
+// must be read from the mint account.
+func NewToken(asset distribution.Asset, decimals uint8) (*Token, error) {
+	if asset.IsNative() {
+		return nil, nil
+	}
+	mint, err := asset.Mint()
+	if err != nil {
+		return nil, err
+	}
+	return &Token{Mint: mint, Decimals: decimals}, nil
+}
+
+// MintSize is the size of an SPL token mint account
+const MintSize = 82
+
+// ParseMint decodes the token of an initialized SPL token mint account
+func ParseMint(mint solana.PublicKey, data []byte) (*Token, error) {
+	if len(data) != MintSize {
+		return nil, fmt.Errorf("mint %s has %d bytes, want %d", mint, len(data), MintSize)
+	}
+	// mint authority option, supply u64, decimals u8, initialized bool,
+	// freeze authority option
+	if data[45] != 1 {
+		return nil, fmt.Errorf("mint %s is not initialized", mint)
+	}
+	return &Token{Mint: mint, Decimals: data[44]}, nil
+}
+
+// createIdempotent is the CreateIdempotent instruction of the associated token
+// account program, which succeeds when the account already exists
+const createIdempotent = 1
+
+// CreateAssociatedTokenAccount returns an instruction creating wallet's
+// associated token account for mint, paid by payer, unless it already exists,
+// along with the account's address
+func CreateAssociatedTokenAccount(payer, wallet, mint solana.PublicKey) (solana.Instruction, solana.PublicKey, error) {
+	account, _, err := solana.FindAssociatedTokenAddress(wallet, mint)
+	if err != nil {
+		return nil, solana.PublicKey{}, fmt.Errorf("failed to derive token account of %s: %w", wallet, err)
+	}
+	accounts := []*solana.AccountMeta{
+		{PublicKey: payer, IsSigner: true, IsWritable: true},
+		{PublicKey: account, IsWritable: true},
+		{PublicKey: wallet},
+		{PublicKey: mint},
+		{PublicKey: solana.SystemProgramID},
+		{PublicKey: solana.TokenProgramID},
+	}
+	return solana.NewInstruction(solana.SPLAssociatedTokenAccountProgramID, accounts, []byte{createIdempotent}), account, nil
+}
+
+// TransferInstructions pays every receiver of p from authority, skipping zero
+// amounts. With a nil token each payout is a System Program transfer of
+// lamports. Otherwise it is a TransferChecked from authority's associated
+// token account to the receiver's, preceded by the idempotent creation of the
+// receiver's account, whose rent authority pays.
+func TransferInstructions(authority solana.PublicKey, tok *Token, p Payment) ([]solana.Instruction, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	var source solana.PublicKey
+	if tok != nil {
+		var err error
+		if source, _, err = solana.FindAssociatedTokenAddress(authority, tok.Mint); err != nil {
+			return nil, fmt.Errorf("failed to derive token account of %s: %w", authority, err)
+		}
+	}
+
+	var instructions []solana.Instruction
+	for i, receiver := range p.Receivers {
+		amount := p.Amounts[i]
+		if amount == 0 {
+			continue
+		}
+		if tok == nil {
+			transfer, err := system.NewTransferInstruction(amount, authority, receiver).ValidateAndBuild()
+			if err != nil {
+				return nil, fmt.Errorf("transfer to %s: %w", receiver, err)
+			}
+			instructions = append(instructions, transfer)
+			continue
+		}
+
+		create, destination, err := CreateAssociatedTokenAccount(authority, receiver, tok.Mint)
+		if err != nil {
+			return nil, err
+		}
+		transfer, err := token.NewTransferCheckedInstruction(amount, tok.Decimals, source, tok.Mint, destination, authority, nil).ValidateAndBuild()
+		if err != nil {
+			return nil, fmt.Errorf("transfer to %s: %w", receiver, err)
+		}
+		instructions = append(instructions, create, transfer)
+	}
+	return instructions, nil
+}
@@ -0,0 +1,147 @@
+package solanatx
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"tilt-valid/internal/distribution"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomPayment(n int) Payment {
+	var p Payment
+	for i := 0; i < n; i++ {
+		p.Receivers = append(p.Receivers, solana.NewWallet().PublicKey())
+		p.Amounts = append(p.Amounts, uint64(1_000_000+i))
+		p.TotalAmount += uint64(1_000_000 + i)
+	}
+	return p
+}
+
+// accounts resolves the accounts of a compiled instruction
+func accounts(tx *solana.Transaction, ix solana.CompiledInstruction) (solana.PublicKey, []solana.PublicKey) {
+	var keys []solana.PublicKey
+	for _, i := range ix.Accounts {
+		keys = append(keys, tx.Message.AccountKeys[i])
+	}
+	return tx.Message.AccountKeys[ix.ProgramIDIndex], keys
+}
+
+func TestBuildTransferTransactionsSOL(t *testing.T) {
+	authority := solana.NewWallet().PublicKey()
+	payment := randomPayment(60)
+	payment.Amounts[7], payment.TotalAmount = 0, payment.TotalAmount-payment.Amounts[7]
+
+	txs, err := BuildTransferTransactions(ProgramID, authority, solana.Hash{}, payment, nil, ComputeBudget{})
+	require.NoError(t, err)
+	require.Greater(t, len(txs), 1)
+
+	var paid uint64
+	var receivers []solana.PublicKey
+	for _, tx := range txs {
+		size, err := Size(tx)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, size, MaxTransactionSize)
+		// The threshold key is the fee payer and the only signer
+		assert.Equal(t, uint8(1), tx.Message.Header.NumRequiredSignatures)
+		assert.Equal(t, authority, tx.Message.AccountKeys[0])
+
+		program, _ := accounts(tx, tx.Message.Instructions[0])
+		require.Equal(t, ProgramID, program)
+		part := decodePayment(t, tx.Message.Instructions[0].Data)
+
+		var transferred uint64
+		for _, ix := range tx.Message.Instructions[1:] {
+			program, keys := accounts(tx, ix)
+			require.Equal(t, solana.SystemProgramID, program)
+			require.Equal(t, uint32(2), binary.LittleEndian.Uint32(ix.Data)) // Transfer
+			assert.Equal(t, authority, keys[0])
+			receivers = append(receivers, keys[1])
+			transferred += binary.LittleEndian.Uint64(ix.Data[4:])
+		}
+		// Every transaction moves exactly what it asks the program to validate
+		assert.Equal(t, part.TotalAmount, transferred)
+		paid += transferred
+	}
+	assert.Equal(t, payment.TotalAmount, paid)
+	expected := append(append([]solana.PublicKey(nil), payment.Receivers[:7]...), payment.Receivers[8:]...)
+	assert.Equal(t, expected, receivers, "zero amounts are not transferred")
+
+	// A compute budget takes room, so more transactions may be needed
+	budget := ComputeBudget{UnitLimit: 300_000, UnitPrice: 5_000}
+	budgeted, err := BuildTransferTransactions(ProgramID, authority, solana.Hash{}, payment, nil, budget)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, len(budgeted), len(txs))
+	for _, tx := range budgeted {
+		size, err := Size(tx)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, size, MaxTransactionSize)
+		parsed, _, err := ParseComputeBudget(tx.Message)
+		require.NoError(t, err)
+		assert.Equal(t, budget, parsed)
+	}
+}
+
+func TestBuildTransferTransactionsSPL(t *testing.T) {
+	const usdc = "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v"
+	tok, err := NewToken(usdc, 6)
+	require.NoError(t, err)
+	authority := solana.NewWallet().PublicKey()
+	source, _, err := solana.FindAssociatedTokenAddress(authority, tok.Mint)
+	require.NoError(t, err)
+
+	payment := randomPayment(20)
+	txs, err := BuildTransferTransactions(ProgramID, authority, solana.Hash{}, payment, tok, ComputeBudget{})
+	require.NoError(t, err)
+
+	i := 0
+	for _, tx := range txs {
+		size, err := Size(tx)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, size, MaxTransactionSize)
+		assert.Equal(t, uint8(1), tx.Message.Header.NumRequiredSignatures)
+
+		rest := tx.Message.Instructions[1:]
+		require.Equal(t, 0, len(rest)%2)
+		for ; len(rest) > 0; rest = rest[2:] {
+			receiver, amount := payment.Receivers[i], payment.Amounts[i]
+			destination, _, err := solana.FindAssociatedTokenAddress(receiver, tok.Mint)
+			require.NoError(t, err)
+
+			// The receiver's token account is created if missing, at the authority's expense
+			program, keys := accounts(tx, rest[0])
+			require.Equal(t, solana.SPLAssociatedTokenAccountProgramID, program)
+			assert.Equal(t, []byte{1}, []byte(rest[0].Data))
+			assert.Equal(t, []solana.PublicKey{authority, destination, receiver, tok.Mint, solana.SystemProgramID, solana.TokenProgramID}, keys)
+
+			program, keys = accounts(tx, rest[1])
+			require.Equal(t, solana.TokenProgramID, program)
+			assert.Equal(t, []solana.PublicKey{source, tok.Mint, destination, authority}, keys)
+			assert.Equal(t, byte(12), rest[1].Data[0]) // TransferChecked
+			assert.Equal(t, amount, binary.LittleEndian.Uint64(rest[1].Data[1:]))
+			assert.Equal(t, byte(6), rest[1].Data[9])
+			i++
+		}
+	}
+	assert.Equal(t, len(payment.Receivers), i)
+
+	mint := make([]byte, MintSize)
+	mint[44], mint[45] = 6, 1
+	parsed, err := ParseMint(tok.Mint, mint)
+	require.NoError(t, err)
+	assert.Equal(t, tok, parsed)
+	mint[45] = 0
+	_, err = ParseMint(tok.Mint, mint)
+	assert.ErrorContains(t, err, "not initialized")
+	_, err = ParseMint(tok.Mint, mint[:80])
+	assert.ErrorContains(t, err, "has 80 bytes")
+
+	native, err := NewToken(distribution.NativeSOL, 9)
+	require.NoError(t, err)
+	assert.Nil(t, native)
+	_, err = TransferInstructions(authority, nil, Payment{TotalAmount: 1})
+	assert.ErrorIs(t, err, ErrTotalAmountMismatch)
+}
@@ -0,0 +1,396 @@
+package validators
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FormatVersion is the current on-disk registry format
+const FormatVersion = 1
+
+var (
+	// ErrVersionConflict is returned when a record changed since it was read
+	ErrVersionConflict = errors.New("validator registry version conflict")
+	// ErrNotFound is returned when no validator has the requested ID
+	ErrNotFound = errors.New("validator not found")
+)
+
+// Validator is a member of the validator set
+type Validator struct {
+	ID               int     `json:"id"`
+	Name             string  `json:"name"`
+	Stake            float64 `json:"stake"`
+	Active           bool    `json:"active"`
+	IdentityPubKey   string  `json:"identity_pubkey"` // hex encoded ed25519 key
+	TransportAddress string  `json:"transport_address"`
+	JoinedEpoch      uint64  `json:"joined_epoch"`
+	// Version is bumped on every write and must be presented to modify the record
+	Version uint64 `json:"version"`
+}
+
+// document is the registry file layout
+type document struct {
+	Format     int         `json:"format"`
+	Version    uint64      `json:"version"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Validators []Validator `json:"validators"`
+}
+
+// Registry stores the validator set in a JSON file shared between validator
+// processes. Writers lock a lock file and every record carries a version
+// number, so concurrent updates fail instead of overwriting each other.
+type Registry struct {
+	path        string
+	mutex       sync.Mutex
+	LockTimeout time.Duration
+
+	// Transport addresses are looked up for every message, so they are
+	// cached until a write replaces the registry file
+	cacheMutex sync.Mutex
+	cachedFile os.FileInfo
+	cachedAt   uint64 // registry version of addresses
+	addresses  map[uint16]string
+}
+
+// Open opens an existing registry file
+func Open(path string) (*Registry, error) {
+	r := &Registry{path: path, LockTimeout: 5 * time.Second}
+	if _, err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// OpenOrMigrate opens the registry at path, creating it from the legacy
+// validators.csv at csvPath if it does not exist yet.
+func OpenOrMigrate(path, csvPath, transportPrefix string) (*Registry, error) {
+	if _, err := os.Stat(path); err == nil {
+		return Open(path)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to stat registry: %w", err)
+	}
+	return MigrateCSV(csvPath, path, transportPrefix)
+}
+
+// MigrateCSV converts the legacy "ID,Name,stake,active,VRFHash" file into a
+// registry. The header row is skipped, trailing columns (such as the old VRF
+// hash) are ignored and each transport address defaults to transportPrefix+ID+".csv".
+func MigrateCSV(csvPath, path, transportPrefix string) (*Registry, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open legacy validators file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy validators file: %w", err)
+	}
+
+	doc := &document{Format: FormatVersion}
+	for line, record := range records {
+		id, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil {
+			if line == 0 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: invalid validator ID %q", line+1, record[0])
+		}
+		if len(record) < 4 {
+			return nil, fmt.Errorf("line %d: expected at least 4 columns, got %d", line+1, len(record))
+		}
+		stake, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid stake %q", line+1, record[2])
+		}
+		active, err := strconv.ParseBool(strings.TrimSpace(record[3]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid active flag %q", line+1, record[3])
+		}
+		doc.Validators = append(doc.Validators, Validator{
+			ID:               id,
+			Name:             strings.TrimSpace(record[1]),
+			Stake:            stake,
+			Active:           active,
+			TransportAddress: transportPrefix + strconv.Itoa(id) + ".csv",
+			Version:          1,
+		})
+	}
+
+	r := &Registry{path: path, LockTimeout: 5 * time.Second}
+	err = r.withLock(func() error {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("registry %s already exists", path)
+		}
+		return r.store(doc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Version returns the registry-wide version, bumped on every write
+func (r *Registry) Version() (uint64, error) {
+	doc, err := r.load()
+	if err != nil {
+		return 0, err
+	}
+	return doc.Version, nil
+}
+
+// List returns all validators ordered by ID
+func (r *Registry) List() ([]Validator, error) {
+	doc, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	return doc.Validators, nil
+}
+
+// Active returns the active validators ordered by ID
+func (r *Registry) Active() ([]Validator, error) {
+	all, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	var active []Validator
+	for _, v := range all {
+		if v.Active {
+			active = append(active, v)
+		}
+	}
+	return active, nil
+}
+
+// Get returns the validator with the given ID
+func (r *Registry) Get(id int) (Validator, error) {
+	all, err := r.List()
+	if err != nil {
+		return Validator{}, err
+	}
+	for _, v := range all {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+	return Validator{}, fmt.Errorf("%w: %d", ErrNotFound, id)
+}
+
+// PartyIDs returns the MPC party IDs of the active validators
+func (r *Registry) PartyIDs() ([]uint16, error) {
+	active, err := r.Active()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint16, 0, len(active))
+	for _, v := range active {
+		ids = append(ids, uint16(v.ID))
+	}
+	return ids, nil
+}
+
+// TransportAddress returns where messages for a party are delivered
+func (r *Registry) TransportAddress(id uint16) (string, error) {
+	addresses, err := r.transportAddresses()
+	if err != nil {
+		return "", err
+	}
+	address, ok := addresses[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	if address == "" {
+		return "", fmt.Errorf("validator %d has no transport address", id)
+	}
+	return address, nil
+}
+
+// transportAddresses returns the transport address of every validator. Every
+// write replaces the registry file, so it is only read again once the file
+// changed, and the addresses only rebuilt once its version did.
+func (r *Registry) transportAddresses() (map[uint16]string, error) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read validator registry: %w", err)
+	}
+	if r.addresses != nil && os.SameFile(info, r.cachedFile) && info.ModTime().Equal(r.cachedFile.ModTime()) {
+		return r.addresses, nil
+	}
+	doc, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	if r.addresses == nil || doc.Version != r.cachedAt {
+		addresses := make(map[uint16]string, len(doc.Validators))
+		for _, v := range doc.Validators {
+			addresses[uint16(v.ID)] = v.TransportAddress
+		}
+		r.addresses, r.cachedAt = addresses, doc.Version
+	}
+	r.cachedFile = info
+	return r.addresses, nil
+}
+
+// Put inserts or replaces a validator. expectedVersion must equal the stored
+// record's version (0 for a new validator); on success the stored record
+// carries expectedVersion+1.
+func (r *Registry) Put(v Validator, expectedVersion uint64) (Validator, error) {
+	var stored Validator
+	err := r.withLock(func() error {
+		doc, err := r.load()
+		if err != nil {
+			return err
+		}
+
+		idx := -1
+		for i := range doc.Validators {
+			if doc.Validators[i].ID == v.ID {
+				idx = i
+				break
+			}
+		}
+
+		current := uint64(0)
+		if idx >= 0 {
+			current = doc.Validators[idx].Version
+		}
+		if current != expectedVersion {
+			return fmt.Errorf("%w: validator %d is at version %d, expected %d", ErrVersionConflict, v.ID, current, expectedVersion)
+		}
+
+		v.Version = expectedVersion + 1
+		if idx >= 0 {
+			doc.Validators[idx] = v
+		} else {
+			doc.Validators = append(doc.Validators, v)
+		}
+		stored = v
+		return r.store(doc)
+	})
+	return stored, err
+}
+
+// Update applies fn to the current record and writes it back, retrying when
+// another writer got there first
+func (r *Registry) Update(id int, fn func(v *Validator) error) (Validator, error) {
+	for attempt := 0; ; attempt++ {
+		v, err := r.Get(id)
+		if err != nil {
+			return Validator{}, err
+		}
+		expected := v.Version
+		if err := fn(&v); err != nil {
+			return Validator{}, err
+		}
+		v.ID = id
+
+		stored, err := r.Put(v, expected)
+		if errors.Is(err, ErrVersionConflict) && attempt < 10 {
+			continue
+		}
+		return stored, err
+	}
+}
+
+// load reads the registry file; it is re-read on every query because other
+// validator processes may have written it
+func (r *Registry) load() (*document, error) {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read validator registry: %w", err)
+	}
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse validator registry: %w", err)
+	}
+	if doc.Format != FormatVersion {
+		return nil, fmt.Errorf("unsupported validator registry format %d (want %d)", doc.Format, FormatVersion)
+	}
+	sort.Slice(doc.Validators, func(i, j int) bool {
+		return doc.Validators[i].ID < doc.Validators[j].ID
+	})
+	return &doc, nil
+}
+
+// store writes the document atomically; callers must hold the lock
+func (r *Registry) store(doc *document) error {
+	doc.Format = FormatVersion
+	doc.Version++
+	doc.UpdatedAt = time.Now().UTC()
+	sort.Slice(doc.Validators, func(i, j int) bool {
+		return doc.Validators[i].ID < doc.Validators[j].ID
+	})
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode validator registry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write validator registry: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync validator registry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close validator registry: %w", err)
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// withLock serialises writers across goroutines and processes with an
+// exclusive flock on a lock file. The kernel drops the lock when its holder
+// exits, so a crashed writer never leaves a stale one behind.
+func (r *Registry) withLock(fn func() error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	lockPath := r.path + ".lock"
+	lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open registry lock: %w", err)
+	}
+	defer lock.Close()
+
+	deadline := time.Now().Add(r.LockTimeout)
+	for {
+		err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			return fmt.Errorf("failed to take registry lock: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for registry lock %s", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	return fn()
+}
@@ -0,0 +1,175 @@
+package validators
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const legacyCSV = `ID,Name,stake,active,VRFHash
+1,bcvs,100.5,true,4348892825909454535294033486391582513107753017116686651896300906611018646635
+2,bbdj,50.2,true
+3,sujskd,20.0,false,1,extra
+`
+
+func newTestRegistry(t *testing.T) *Registry {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "validators.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte(legacyCSV), 0644))
+
+	registry, err := OpenOrMigrate(filepath.Join(dir, "validators.json"), csvPath, "/tmp/Transport")
+	require.NoError(t, err)
+	return registry
+}
+
+func TestMigrateCSV(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	all, err := registry.List()
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, Validator{
+		ID:               1,
+		Name:             "bcvs",
+		Stake:            100.5,
+		Active:           true,
+		TransportAddress: "/tmp/Transport1.csv",
+		Version:          1,
+	}, all[0])
+
+	active, err := registry.Active()
+	require.NoError(t, err)
+	assert.Len(t, active, 2)
+
+	parties, err := registry.PartyIDs()
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2}, parties)
+
+	address, err := registry.TransportAddress(2)
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/Transport2.csv", address)
+
+	_, err = registry.Get(9)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestOpenOrMigrateKeepsExistingRegistry(t *testing.T) {
+	registry := newTestRegistry(t)
+	_, err := registry.Update(1, func(v *Validator) error {
+		v.Name = "renamed"
+		return nil
+	})
+	require.NoError(t, err)
+
+	reopened, err := OpenOrMigrate(registry.path, "does-not-matter.csv", "")
+	require.NoError(t, err)
+	v, err := reopened.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", v.Name)
+}
+
+func TestPutVersionConflict(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	v, err := registry.Get(2)
+	require.NoError(t, err)
+
+	v.Stake = 75
+	stored, err := registry.Put(v, v.Version)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), stored.Version)
+
+	// A writer still holding the old version must be rejected
+	v.Stake = 10
+	_, err = registry.Put(v, 1)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	current, err := registry.Get(2)
+	require.NoError(t, err)
+	assert.Equal(t, 75.0, current.Stake)
+
+	// New validators are inserted with expected version 0
+	_, err = registry.Put(Validator{ID: 4, Name: "new", Active: true, JoinedEpoch: 7}, 0)
+	require.NoError(t, err)
+	_, err = registry.Put(Validator{ID: 4, Name: "dup"}, 0)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	registry := newTestRegistry(t)
+	// A second handle on the same file behaves like another validator process
+	other, err := Open(registry.path)
+	require.NoError(t, err)
+
+	const writes = 20
+	var wg sync.WaitGroup
+	for _, r := range []*Registry{registry, other} {
+		wg.Add(1)
+		go func(r *Registry) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				_, err := r.Update(1, func(v *Validator) error {
+					v.Stake++
+					return nil
+				})
+				assert.NoError(t, err)
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	v, err := registry.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, 100.5+2*writes, v.Stake)
+	assert.Equal(t, uint64(1+2*writes), v.Version)
+}
+
+func TestLockFile(t *testing.T) {
+	registry := newTestRegistry(t)
+	registry.LockTimeout = 100 * time.Millisecond
+	lockPath := registry.path + ".lock"
+
+	// A lock file left by a crashed writer holds no lock
+	require.NoError(t, os.WriteFile(lockPath, []byte("1\n"), 0644))
+	_, err := registry.Update(1, func(v *Validator) error { return nil })
+	require.NoError(t, err)
+
+	// A writer holding the lock keeps others out until it lets go
+	held, err := os.OpenFile(lockPath, os.O_RDWR, 0644)
+	require.NoError(t, err)
+	defer held.Close()
+	require.NoError(t, syscall.Flock(int(held.Fd()), syscall.LOCK_EX))
+	_, err = registry.Update(1, func(v *Validator) error { return nil })
+	assert.ErrorContains(t, err, "timed out waiting for registry lock")
+	require.NoError(t, syscall.Flock(int(held.Fd()), syscall.LOCK_UN))
+	_, err = registry.Update(1, func(v *Validator) error { return nil })
+	assert.NoError(t, err)
+}
+
+func TestTransportAddressFollowsUpdates(t *testing.T) {
+	registry := newTestRegistry(t)
+	other, err := Open(registry.path)
+	require.NoError(t, err)
+
+	address, err := registry.TransportAddress(2)
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/Transport2.csv", address)
+
+	_, err = other.Update(2, func(v *Validator) error {
+		v.TransportAddress = "/srv/transport/2.csv"
+		return nil
+	})
+	require.NoError(t, err)
+	address, err = registry.TransportAddress(2)
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/transport/2.csv", address, "another process changed the address")
+
+	_, err = registry.TransportAddress(9)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,285 @@
+package chainlink
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BeaconBoard is where validators publish their commitments and reveals for a round
+type BeaconBoard interface {
+	PublishCommit(round string, validator int, commitment []byte) error
+	PublishReveal(round string, validator int, secret []byte) error
+	Commits(round string) (map[int][]byte, error)
+	Reveals(round string) (map[int][]byte, error)
+}
+
+// BeaconShare is one validator's contribution to a beacon round
+type BeaconShare struct {
+	Validator  int    `json:"validator"`
+	Commitment []byte `json:"commitment"`
+	Secret     []byte `json:"secret"`
+}
+
+// Beacon is a commit-reveal randomness beacon run by the validator set.
+// Every validator that completes a round obtains the same output.
+type Beacon struct {
+	id           int
+	validators   []int
+	board        BeaconBoard
+	PollInterval time.Duration
+}
+
+// NewBeacon creates the beacon participant id among validators
+func NewBeacon(id int, validators []int, board BeaconBoard) *Beacon {
+	sorted := append([]int(nil), validators...)
+	sort.Ints(sorted)
+	return &Beacon{
+		id:           id,
+		validators:   sorted,
+		board:        board,
+		PollInterval: 50 * time.Millisecond,
+	}
+}
+
+// BeaconRound derives the board round identifier from a seed
+func BeaconRound(seed []byte) string {
+	sum := sha256.Sum256(seed)
+	return hex.EncodeToString(sum[:16])
+}
+
+// Request commits to a fresh secret, waits for every validator's commitment,
+// reveals, and combines all reveals into the round output.
+func (b *Beacon) Request(ctx context.Context, seed []byte) (Output, Proof, error) {
+	round := BeaconRound(seed)
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate beacon secret: %v", err)
+	}
+	if err := b.board.PublishCommit(round, b.id, beaconCommitment(seed, b.id, secret)); err != nil {
+		return nil, nil, fmt.Errorf("failed to publish commitment: %v", err)
+	}
+
+	commits, err := b.waitForAll(ctx, round, "commitments", b.board.Commits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only reveal once every commitment is fixed, so no one can adapt theirs
+	if err := b.board.PublishReveal(round, b.id, secret); err != nil {
+		return nil, nil, fmt.Errorf("failed to publish reveal: %v", err)
+	}
+
+	reveals, err := b.waitForAll(ctx, round, "reveals", b.board.Reveals)
+	if err != nil {
+		if ctx.Err() == nil {
+			return nil, nil, err
+		}
+		missed := &MissedRevealError{Round: round, Commitments: make(map[int][]byte), err: err}
+		for _, v := range b.validators {
+			if _, ok := reveals[v]; !ok {
+				missed.Commitments[v] = commits[v]
+			}
+		}
+		return nil, nil, missed
+	}
+
+	shares := make([]BeaconShare, 0, len(b.validators))
+	for _, v := range b.validators {
+		shares = append(shares, BeaconShare{Validator: v, Commitment: commits[v], Secret: reveals[v]})
+	}
+	if err := checkShares(seed, shares); err != nil {
+		return nil, nil, err
+	}
+
+	proof, err := json.Marshal(shares)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode beacon proof: %v", err)
+	}
+	return combineShares(seed, shares), proof, nil
+}
+
+// Verify checks that the proof opens every validator's commitment and yields output
+func (b *Beacon) Verify(seed []byte, output Output, proof Proof) error {
+	var shares []BeaconShare
+	if err := json.Unmarshal(proof, &shares); err != nil {
+		return fmt.Errorf("%w: malformed beacon proof: %v", ErrInvalidProof, err)
+	}
+	if len(shares) != len(b.validators) {
+		return fmt.Errorf("%w: expected %d shares, got %d", ErrInvalidProof, len(b.validators), len(shares))
+	}
+	for i, share := range shares {
+		if share.Validator != b.validators[i] {
+			return fmt.Errorf("%w: unexpected share from validator %d", ErrInvalidProof, share.Validator)
+		}
+	}
+	if err := checkShares(seed, shares); err != nil {
+		return err
+	}
+	if !bytes.Equal(combineShares(seed, shares), output) {
+		return fmt.Errorf("%w: output does not match reveals", ErrInvalidProof)
+	}
+	return nil
+}
+
+// MissedRevealError is returned when every validator committed to a round but
+// some never revealed, which is evidence against them
+type MissedRevealError struct {
+	Round string
+	// Commitments holds the unopened commitment of each validator that did not reveal
+	Commitments map[int][]byte
+	err         error
+}
+
+func (e *MissedRevealError) Error() string { return e.err.Error() }
+
+func (e *MissedRevealError) Unwrap() error { return e.err }
+
+// waitForAll polls the board until every validator has an entry or ctx is done,
+// in which case the entries seen so far are returned with the error
+func (b *Beacon) waitForAll(ctx context.Context, round, what string, fetch func(string) (map[int][]byte, error)) (map[int][]byte, error) {
+	for {
+		entries, err := fetch(round)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", what, err)
+		}
+
+		var missing []int
+		for _, v := range b.validators {
+			if _, ok := entries[v]; !ok {
+				missing = append(missing, v)
+			}
+		}
+		if len(missing) == 0 {
+			return entries, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return entries, fmt.Errorf("beacon round %s: missing %s from validators %v: %w", round, what, missing, ctx.Err())
+		case <-time.After(b.PollInterval):
+		}
+	}
+}
+
+func checkShares(seed []byte, shares []BeaconShare) error {
+	for _, share := range shares {
+		if !bytes.Equal(beaconCommitment(seed, share.Validator, share.Secret), share.Commitment) {
+			return fmt.Errorf("%w: reveal of validator %d does not match its commitment", ErrInvalidProof, share.Validator)
+		}
+	}
+	return nil
+}
+
+func beaconCommitment(seed []byte, validator int, secret []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("beacon-commit"))
+	h.Write(seed)
+	binary.Write(h, binary.BigEndian, uint32(validator))
+	h.Write(secret)
+	return h.Sum(nil)
+}
+
+// combineShares hashes the seed and all secrets in validator order
+func combineShares(seed []byte, shares []BeaconShare) Output {
+	h := sha512.New()
+	h.Write(seed)
+	for _, share := range shares {
+		binary.Write(h, binary.BigEndian, uint32(share.Validator))
+		h.Write(share.Secret)
+	}
+	return h.Sum(nil)
+}
+
+// FileBoard is a BeaconBoard backed by a shared directory. Each validator only
+// ever writes its own files, so no cross-process locking is needed.
+type FileBoard struct {
+	dir string
+}
+
+// NewFileBoard creates a board rooted at dir
+func NewFileBoard(dir string) (*FileBoard, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create beacon directory: %v", err)
+	}
+	return &FileBoard{dir: dir}, nil
+}
+
+// PublishCommit stores the validator's commitment for round
+func (f *FileBoard) PublishCommit(round string, validator int, commitment []byte) error {
+	return f.write(round, validator, "commit", commitment)
+}
+
+// PublishReveal stores the validator's secret for round
+func (f *FileBoard) PublishReveal(round string, validator int, secret []byte) error {
+	return f.write(round, validator, "reveal", secret)
+}
+
+// Commits returns all commitments published for round
+func (f *FileBoard) Commits(round string) (map[int][]byte, error) {
+	return f.read(round, "commit")
+}
+
+// Reveals returns all secrets published for round
+func (f *FileBoard) Reveals(round string) (map[int][]byte, error) {
+	return f.read(round, "reveal")
+}
+
+func (f *FileBoard) write(round string, validator int, kind string, data []byte) error {
+	roundDir := filepath.Join(f.dir, round)
+	if err := os.MkdirAll(roundDir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(roundDir, fmt.Sprintf("%d.%s", validator, kind))
+	// Write then rename so readers never observe a partial entry
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, []byte(hex.EncodeToString(data)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (f *FileBoard) read(round string, kind string) (map[int][]byte, error) {
+	entries, err := os.ReadDir(filepath.Join(f.dir, round))
+	if os.IsNotExist(err) {
+		return map[int][]byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int][]byte)
+	for _, entry := range entries {
+		idStr, ok := strings.CutSuffix(entry.Name(), "."+kind)
+		if !ok {
+			continue
+		}
+		validator, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(f.dir, round, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		data, err := hex.DecodeString(string(raw))
+		if err != nil {
+			return nil, fmt.Errorf("corrupt %s from validator %d: %v", kind, validator, err)
+		}
+		result[validator] = data
+	}
+	return result, nil
+}
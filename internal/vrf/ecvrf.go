@@ -0,0 +1,199 @@
+package chainlink
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+
+	"filippo.io/edwards25519"
+)
+
+// ECVRF-EDWARDS25519-SHA512-TAI as specified in RFC 9381, section 5.5.
+const (
+	suiteString  = 0x03
+	challengeLen = 16
+	scalarLen    = 32
+	pointLen     = 32
+
+	// ProofSize is the length in bytes of an encoded ECVRF proof (Gamma || c || s)
+	ProofSize = pointLen + challengeLen + scalarLen
+	// OutputSize is the length in bytes of the VRF output (beta)
+	OutputSize = sha512.Size
+)
+
+// ErrInvalidProof is returned when a VRF proof does not verify
+var ErrInvalidProof = errors.New("invalid VRF proof")
+
+// Prove computes the ECVRF proof pi and output beta for alpha under the private key sk
+func Prove(sk ed25519.PrivateKey, alpha []byte) (pi []byte, beta []byte, err error) {
+	if len(sk) != ed25519.PrivateKeySize {
+		return nil, nil, fmt.Errorf("invalid private key length: %d", len(sk))
+	}
+
+	// Expand the seed exactly as RFC 8032 does for signing
+	hashedSK := sha512.Sum512(sk.Seed())
+	x, err := new(edwards25519.Scalar).SetBytesWithClamping(hashedSK[:32])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive secret scalar: %v", err)
+	}
+	pkBytes := new(edwards25519.Point).ScalarBaseMult(x).Bytes()
+
+	H, err := encodeToCurve(pkBytes, alpha)
+	if err != nil {
+		return nil, nil, err
+	}
+	hString := H.Bytes()
+
+	gamma := new(edwards25519.Point).ScalarMult(x, H)
+
+	// Deterministic nonce: k = SHA512(hashedSK[32:64] || h_string) mod q
+	nonceHash := sha512.New()
+	nonceHash.Write(hashedSK[32:])
+	nonceHash.Write(hString)
+	k, err := new(edwards25519.Scalar).SetUniformBytes(nonceHash.Sum(nil))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive nonce: %v", err)
+	}
+
+	U := new(edwards25519.Point).ScalarBaseMult(k)
+	V := new(edwards25519.Point).ScalarMult(k, H)
+	c := challenge(pkBytes, hString, gamma.Bytes(), U.Bytes(), V.Bytes())
+
+	s := new(edwards25519.Scalar).MultiplyAdd(c, x, k)
+
+	pi = make([]byte, 0, ProofSize)
+	pi = append(pi, gamma.Bytes()...)
+	pi = append(pi, c.Bytes()[:challengeLen]...)
+	pi = append(pi, s.Bytes()...)
+
+	return pi, gammaToHash(gamma), nil
+}
+
+// Verify checks the proof pi for alpha under the public key pk and returns the VRF output beta
+func Verify(pk ed25519.PublicKey, pi []byte, alpha []byte) ([]byte, error) {
+	if len(pk) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key length: %d", len(pk))
+	}
+	Y, err := stringToPoint(pk)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	// Reject small-order keys, which would make any proof verify
+	if new(edwards25519.Point).MultByCofactor(Y).Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return nil, fmt.Errorf("invalid public key: small order point")
+	}
+
+	gamma, c, s, err := decodeProof(pi)
+	if err != nil {
+		return nil, err
+	}
+
+	H, err := encodeToCurve(pk, alpha)
+	if err != nil {
+		return nil, err
+	}
+
+	negC := new(edwards25519.Scalar).Negate(c)
+	// U = s*B - c*Y
+	U := new(edwards25519.Point).VarTimeDoubleScalarBaseMult(negC, Y, s)
+	// V = s*H - c*Gamma
+	V := new(edwards25519.Point).VarTimeMultiScalarMult(
+		[]*edwards25519.Scalar{s, negC},
+		[]*edwards25519.Point{H, gamma},
+	)
+
+	expected := challenge(pk, H.Bytes(), gamma.Bytes(), U.Bytes(), V.Bytes())
+	if expected.Equal(c) != 1 {
+		return nil, ErrInvalidProof
+	}
+
+	return gammaToHash(gamma), nil
+}
+
+// ProofToHash returns the VRF output beta encoded in pi without verifying it
+func ProofToHash(pi []byte) ([]byte, error) {
+	gamma, _, _, err := decodeProof(pi)
+	if err != nil {
+		return nil, err
+	}
+	return gammaToHash(gamma), nil
+}
+
+// encodeToCurve implements ECVRF_encode_to_curve_try_and_increment
+func encodeToCurve(pkBytes, alpha []byte) (*edwards25519.Point, error) {
+	for ctr := 0; ctr < 256; ctr++ {
+		h := sha512.New()
+		h.Write([]byte{suiteString, 0x01})
+		h.Write(pkBytes)
+		h.Write(alpha)
+		h.Write([]byte{byte(ctr), 0x00})
+		digest := h.Sum(nil)
+
+		P, err := stringToPoint(digest[:pointLen])
+		if err != nil {
+			continue
+		}
+		return new(edwards25519.Point).MultByCofactor(P), nil
+	}
+	return nil, fmt.Errorf("failed to encode input to curve")
+}
+
+// challenge implements ECVRF_challenge_generation with the five RFC 9381 points
+func challenge(points ...[]byte) *edwards25519.Scalar {
+	h := sha512.New()
+	h.Write([]byte{suiteString, 0x02})
+	for _, p := range points {
+		h.Write(p)
+	}
+	h.Write([]byte{0x00})
+	digest := h.Sum(nil)
+
+	var cBytes [scalarLen]byte
+	copy(cBytes[:], digest[:challengeLen])
+	// A 128-bit value is always below the group order, so this cannot fail
+	c, _ := new(edwards25519.Scalar).SetCanonicalBytes(cBytes[:])
+	return c
+}
+
+// gammaToHash implements ECVRF_proof_to_hash once Gamma has been decoded
+func gammaToHash(gamma *edwards25519.Point) []byte {
+	h := sha512.New()
+	h.Write([]byte{suiteString, 0x03})
+	h.Write(new(edwards25519.Point).MultByCofactor(gamma).Bytes())
+	h.Write([]byte{0x00})
+	return h.Sum(nil)
+}
+
+func decodeProof(pi []byte) (*edwards25519.Point, *edwards25519.Scalar, *edwards25519.Scalar, error) {
+	if len(pi) != ProofSize {
+		return nil, nil, nil, fmt.Errorf("invalid proof length: %d", len(pi))
+	}
+	gamma, err := stringToPoint(pi[:pointLen])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: bad gamma: %v", ErrInvalidProof, err)
+	}
+
+	var cBytes [scalarLen]byte
+	copy(cBytes[:], pi[pointLen:pointLen+challengeLen])
+	c, _ := new(edwards25519.Scalar).SetCanonicalBytes(cBytes[:])
+
+	s, err := new(edwards25519.Scalar).SetCanonicalBytes(pi[pointLen+challengeLen:])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: s is not reduced", ErrInvalidProof)
+	}
+	return gamma, c, s, nil
+}
+
+// stringToPoint decodes a point and, unlike SetBytes, rejects non-canonical encodings
+func stringToPoint(b []byte) (*edwards25519.Point, error) {
+	P, err := new(edwards25519.Point).SetBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(P.Bytes(), b) {
+		return nil, fmt.Errorf("non-canonical point encoding")
+	}
+	return P, nil
+}
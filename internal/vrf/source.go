@@ -0,0 +1,177 @@
+package chainlink
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// Names of the randomness backends accepted by NewRandomnessSource
+const (
+	SourceLocal     = "local"
+	SourceBeacon    = "beacon"
+	SourceChainlink = "chainlink"
+)
+
+// Output is a verifiable random value
+type Output []byte
+
+// Proof allows anyone holding the seed to check an Output
+type Proof []byte
+
+// RandomnessSource is the single abstraction every consumer of randomness goes
+// through: validator selection, submitter scheduling and ballot sampling.
+type RandomnessSource interface {
+	// Request produces randomness bound to seed together with a proof of it
+	Request(ctx context.Context, seed []byte) (Output, Proof, error)
+	// Verify checks that output was produced for seed by this source
+	Verify(seed []byte, output Output, proof Proof) error
+}
+
+// Int returns the output interpreted as a big-endian unsigned integer
+func (o Output) Int() *big.Int {
+	return new(big.Int).SetBytes(o)
+}
+
+// Index maps the output onto [0, n). n must be positive.
+func (o Output) Index(n int) int {
+	return int(new(big.Int).Mod(o.Int(), big.NewInt(int64(n))).Int64())
+}
+
+// Sample deterministically picks k distinct indices from [0, n) using a
+// partial Fisher-Yates shuffle driven by the output.
+func (o Output) Sample(n, k int) []int {
+	if k > n {
+		k = n
+	}
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	for i := 0; i < k; i++ {
+		h := sha512.New()
+		h.Write(o)
+		binary.Write(h, binary.BigEndian, uint32(i))
+		j := i + Output(h.Sum(nil)).Index(n-i)
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+	return perm[:k]
+}
+
+// SourceOptions holds what each backend needs; only the fields of the selected backend are used
+type SourceOptions struct {
+	// Local ECVRF: the validator's identity key
+	LocalKey ed25519.PrivateKey
+
+	// Commit-reveal beacon
+	ValidatorID int
+	Validators  []int
+	Board       BeaconBoard
+
+	// Chainlink oracle
+	OracleEndpoint  string
+	OracleProgramID string
+	OracleKey       ed25519.PublicKey
+}
+
+// NewRandomnessSource builds the backend named by kind
+func NewRandomnessSource(kind string, opts SourceOptions) (RandomnessSource, error) {
+	switch kind {
+	case SourceLocal:
+		if len(opts.LocalKey) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("local VRF source requires an ed25519 private key")
+		}
+		return NewLocalVRF(opts.LocalKey), nil
+	case SourceBeacon:
+		if opts.Board == nil {
+			return nil, fmt.Errorf("beacon source requires a board")
+		}
+		return NewBeacon(opts.ValidatorID, opts.Validators, opts.Board), nil
+	case SourceChainlink:
+		if opts.OracleEndpoint == "" {
+			return nil, fmt.Errorf("chainlink source requires an oracle endpoint")
+		}
+		if len(opts.OracleKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("chainlink source requires the oracle public key")
+		}
+		return NewChainlinkSource(NewSolanaChainlinkVRF(opts.OracleEndpoint, opts.OracleProgramID, nil, opts.OracleKey)), nil
+	default:
+		return nil, fmt.Errorf("unknown randomness source %q", kind)
+	}
+}
+
+// LocalVRF produces randomness with an ECVRF over the validator's own key.
+// Outputs differ per key, so it suits single-operator deployments and tests.
+type LocalVRF struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewLocalVRF creates a local ECVRF source that can both prove and verify
+func NewLocalVRF(key ed25519.PrivateKey) *LocalVRF {
+	return &LocalVRF{
+		privateKey: key,
+		publicKey:  key.Public().(ed25519.PublicKey),
+	}
+}
+
+// NewLocalVRFVerifier creates a local ECVRF source that only verifies outputs of pk
+func NewLocalVRFVerifier(pk ed25519.PublicKey) *LocalVRF {
+	return &LocalVRF{publicKey: pk}
+}
+
+// Request proves seed with the local key
+func (l *LocalVRF) Request(ctx context.Context, seed []byte) (Output, Proof, error) {
+	if l.privateKey == nil {
+		return nil, nil, fmt.Errorf("local VRF has no private key")
+	}
+	pi, beta, err := Prove(l.privateKey, seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return beta, pi, nil
+}
+
+// Verify checks an ECVRF proof against the local public key
+func (l *LocalVRF) Verify(seed []byte, output Output, proof Proof) error {
+	return verifyECVRF(l.publicKey, seed, output, proof)
+}
+
+// ChainlinkSource adapts SolanaChainlinkVRF to RandomnessSource
+type ChainlinkSource struct {
+	client *SolanaChainlinkVRF
+}
+
+// NewChainlinkSource wraps an oracle client
+func NewChainlinkSource(client *SolanaChainlinkVRF) *ChainlinkSource {
+	return &ChainlinkSource{client: client}
+}
+
+// Request asks the oracle for randomness; the response is verified before it is returned
+func (c *ChainlinkSource) Request(ctx context.Context, seed []byte) (Output, Proof, error) {
+	pi, beta, err := c.client.requestProof(ctx, seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return beta, pi, nil
+}
+
+// Verify checks an oracle proof against the oracle public key
+func (c *ChainlinkSource) Verify(seed []byte, output Output, proof Proof) error {
+	return verifyECVRF(c.client.oracleKey, seed, output, proof)
+}
+
+func verifyECVRF(pk ed25519.PublicKey, seed []byte, output Output, proof Proof) error {
+	beta, err := Verify(pk, proof, seed)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(beta, output) {
+		return fmt.Errorf("%w: output does not match proof", ErrInvalidProof)
+	}
+	return nil
+}
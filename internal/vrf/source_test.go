@@ -0,0 +1,122 @@
+package chainlink
+
+import (
+	"context"
+	"crypto/ed25519"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalVRFSource(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	source, err := NewRandomnessSource(SourceLocal, SourceOptions{LocalKey: key})
+	require.NoError(t, err)
+
+	seed := []byte("selection seed")
+	output, proof, err := source.Request(context.Background(), seed)
+	require.NoError(t, err)
+	assert.Len(t, output, OutputSize)
+
+	verifier := NewLocalVRFVerifier(key.Public().(ed25519.PublicKey))
+	assert.NoError(t, verifier.Verify(seed, output, proof))
+	assert.ErrorIs(t, verifier.Verify([]byte("other seed"), output, proof), ErrInvalidProof)
+}
+
+func TestChainlinkSource(t *testing.T) {
+	oracle := newFakeOracle(t)
+	source, err := NewRandomnessSource(SourceChainlink, SourceOptions{
+		OracleEndpoint: oracle.server.URL,
+		OracleKey:      oracle.publicKey(),
+	})
+	require.NoError(t, err)
+
+	seed := []byte("selection seed")
+	output, proof, err := source.Request(context.Background(), seed)
+	require.NoError(t, err)
+	assert.NoError(t, source.Verify(seed, output, proof))
+
+	output[0] ^= 0xff
+	assert.ErrorIs(t, source.Verify(seed, output, proof), ErrInvalidProof)
+}
+
+func TestBeaconAgreement(t *testing.T) {
+	board, err := NewFileBoard(t.TempDir())
+	require.NoError(t, err)
+
+	validators := []int{1, 2, 3}
+	seed := []byte("round-1")
+
+	outputs := make([]Output, len(validators))
+	proofs := make([]Proof, len(validators))
+	errs := make([]error, len(validators))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i, id := range validators {
+		wg.Add(1)
+		go func(i, id int) {
+			defer wg.Done()
+			beacon := NewBeacon(id, validators, board)
+			beacon.PollInterval = 5 * time.Millisecond
+			outputs[i], proofs[i], errs[i] = beacon.Request(ctx, seed)
+		}(i, id)
+	}
+	wg.Wait()
+
+	for i := range validators {
+		require.NoError(t, errs[i])
+		assert.Equal(t, outputs[0], outputs[i], "validator %d disagrees", validators[i])
+	}
+
+	observer := NewBeacon(0, validators, board)
+	assert.NoError(t, observer.Verify(seed, outputs[0], proofs[0]))
+	assert.ErrorIs(t, observer.Verify([]byte("round-2"), outputs[0], proofs[0]), ErrInvalidProof)
+}
+
+func TestBeaconMissingReveal(t *testing.T) {
+	board, err := NewFileBoard(t.TempDir())
+	require.NoError(t, err)
+
+	seed := []byte("round-1")
+	// Validator 2 commits but never reveals
+	require.NoError(t, board.PublishCommit(BeaconRound(seed), 2, make([]byte, 32)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	beacon := NewBeacon(1, []int{1, 2}, board)
+	beacon.PollInterval = 5 * time.Millisecond
+	_, _, err = beacon.Request(ctx, seed)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "missing reveals from validators [2]")
+
+	var missed *MissedRevealError
+	require.ErrorAs(t, err, &missed)
+	assert.Equal(t, BeaconRound(seed), missed.Round)
+	assert.Equal(t, map[int][]byte{2: make([]byte, 32)}, missed.Commitments)
+}
+
+func TestOutputSample(t *testing.T) {
+	output := Output([]byte("some verifiable output"))
+
+	sample := output.Sample(10, 4)
+	assert.Len(t, sample, 4)
+	assert.Equal(t, sample, output.Sample(10, 4), "sampling must be deterministic")
+
+	seen := make(map[int]bool)
+	for _, idx := range sample {
+		assert.True(t, idx >= 0 && idx < 10)
+		assert.False(t, seen[idx], "duplicate index %d", idx)
+		seen[idx] = true
+	}
+
+	assert.Len(t, output.Sample(3, 5), 3)
+}
@@ -3,8 +3,12 @@ package chainlink
 import (
 	"context"
 	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -13,6 +17,9 @@ import (
 	"time"
 )
 
+// ErrRequestIDMismatch is returned when the oracle answers a different request
+var ErrRequestIDMismatch = errors.New("VRF response request ID mismatch")
+
 // ChainlinkVRFResponse represents the response from Chainlink VRF
 type ChainlinkVRFResponse struct {
 	Result     string `json:"result"`
@@ -26,37 +33,55 @@ type SolanaChainlinkVRF struct {
 	endpoint    string
 	programID   string
 	accountKey  ed25519.PrivateKey
+	oracleKey   ed25519.PublicKey
 	initialized bool
 }
 
-// NewSolanaChainlinkVRF creates a new instance of the Solana Chainlink VRF client
-func NewSolanaChainlinkVRF(endpoint, programID string, accountKey ed25519.PrivateKey) *SolanaChainlinkVRF {
+// NewSolanaChainlinkVRF creates a new instance of the Solana Chainlink VRF client.
+// Every response is checked against oracleKey, the oracle's ECVRF public key.
+func NewSolanaChainlinkVRF(endpoint, programID string, accountKey ed25519.PrivateKey, oracleKey ed25519.PublicKey) *SolanaChainlinkVRF {
 	return &SolanaChainlinkVRF{
 		endpoint:    endpoint,
 		programID:   programID,
 		accountKey:  accountKey,
+		oracleKey:   oracleKey,
 		initialized: true,
 	}
 }
 
 // RequestRandomness requests a random value from Chainlink VRF
 func (s *SolanaChainlinkVRF) RequestRandomness(ctx context.Context, seed []byte) (*big.Int, error) {
+	_, beta, err := s.requestProof(ctx, seed)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(beta), nil
+}
+
+// requestProof asks the oracle for randomness and returns the verified proof and output
+func (s *SolanaChainlinkVRF) requestProof(ctx context.Context, seed []byte) (pi []byte, beta []byte, err error) {
 	if !s.initialized {
-		return nil, fmt.Errorf("SolanaChainlinkVRF not initialized")
+		return nil, nil, fmt.Errorf("SolanaChainlinkVRF not initialized")
 	}
 
 	// In a real implementation, this would create a transaction to call the Chainlink VRF program
 	// For demonstration, we'll simulate an HTTP call to a VRF endpoint
 
+	requestID, err := newRequestID()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Create request payload
 	payload := map[string]interface{}{
-		"program": s.programID,
-		"seed":    base64.StdEncoding.EncodeToString(seed),
+		"program":   s.programID,
+		"requestId": requestID,
+		"seed":      base64.StdEncoding.EncodeToString(seed),
 	}
 
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %v", err)
+		return nil, nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
 	// Create HTTP request
@@ -67,7 +92,7 @@ func (s *SolanaChainlinkVRF) RequestRandomness(ctx context.Context, seed []byte)
 		strings.NewReader(string(jsonPayload)),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return nil, nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -76,42 +101,78 @@ func (s *SolanaChainlinkVRF) RequestRandomness(ctx context.Context, seed []byte)
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+		return nil, nil, fmt.Errorf("failed to send request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+		return nil, nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("oracle returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
 
 	// Parse response
 	var vrfResp ChainlinkVRFResponse
 	if err := json.Unmarshal(body, &vrfResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+		return nil, nil, fmt.Errorf("failed to parse response: %v", err)
 	}
 
-	// Convert randomness to big.Int
-	// Remove "0x" prefix if present
-	randomness := vrfResp.Randomness
-	if strings.HasPrefix(randomness, "0x") {
-		randomness = randomness[2:]
+	// A response for another request must never be accepted, even with a valid proof
+	if vrfResp.RequestID != requestID {
+		return nil, nil, fmt.Errorf("%w: expected %s, got %q", ErrRequestIDMismatch, requestID, vrfResp.RequestID)
 	}
 
-	// Parse as big.Int
-	value := new(big.Int)
-	value, success := value.SetString(randomness, 16)
-	if !success {
-		return nil, fmt.Errorf("failed to parse randomness as big.Int")
+	if ok, err := s.VerifyRandomness(vrfResp.Proof, vrfResp.Randomness, seed); !ok {
+		return nil, nil, err
 	}
 
-	return value, nil
+	// Both decode cleanly, VerifyRandomness has just checked them
+	pi, _ = hex.DecodeString(trimHexPrefix(vrfResp.Proof))
+	beta, _ = hex.DecodeString(trimHexPrefix(vrfResp.Randomness))
+	return pi, beta, nil
 }
 
-// VerifyRandomness verifies that the randomness was correctly produced by Chainlink VRF
+// VerifyRandomness verifies that the randomness was produced by the oracle's
+// ECVRF key for this seed. Both proof and randomness are hex encoded.
 func (s *SolanaChainlinkVRF) VerifyRandomness(proof string, randomness string, seed []byte) (bool, error) {
-	// In a real implementation, this would verify the cryptographic proof
-	// For demonstration, we'll simulate a successful verification
+	if len(s.oracleKey) != ed25519.PublicKeySize {
+		return false, fmt.Errorf("oracle public key not configured")
+	}
+
+	pi, err := hex.DecodeString(trimHexPrefix(proof))
+	if err != nil {
+		return false, fmt.Errorf("failed to decode proof: %v", err)
+	}
+	claimed, err := hex.DecodeString(trimHexPrefix(randomness))
+	if err != nil {
+		return false, fmt.Errorf("failed to decode randomness: %v", err)
+	}
+
+	beta, err := Verify(s.oracleKey, pi, seed)
+	if err != nil {
+		return false, err
+	}
+	if !hmac.Equal(beta, claimed) {
+		return false, fmt.Errorf("%w: randomness does not match proof output", ErrInvalidProof)
+	}
+
 	return true, nil
 }
+
+// newRequestID returns a random identifier that ties a response to its request
+func newRequestID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate request ID: %v", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// trimHexPrefix removes a leading "0x" if present
+func trimHexPrefix(s string) string {
+	return strings.TrimPrefix(s, "0x")
+}
@@ -0,0 +1,193 @@
+package chainlink
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOracle is an httptest server that answers VRF requests with genuine ECVRF proofs
+type fakeOracle struct {
+	server *httptest.Server
+	key    ed25519.PrivateKey
+	// tamper, when set, rewrites the response before it is sent
+	tamper func(resp *ChainlinkVRFResponse)
+}
+
+func newFakeOracle(t *testing.T) *fakeOracle {
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	oracle := &fakeOracle{key: key}
+	oracle.server = httptest.NewServer(http.HandlerFunc(oracle.handle))
+	t.Cleanup(oracle.server.Close)
+	return oracle
+}
+
+func (o *fakeOracle) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/vrf/request" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req struct {
+		Program   string `json:"program"`
+		RequestID string `json:"requestId"`
+		Seed      string `json:"seed"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	seed, err := base64.StdEncoding.DecodeString(req.Seed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pi, beta, err := Prove(o.key, seed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := ChainlinkVRFResponse{
+		Result:     "ok",
+		RequestID:  req.RequestID,
+		Proof:      hex.EncodeToString(pi),
+		Randomness: "0x" + hex.EncodeToString(beta),
+	}
+	if o.tamper != nil {
+		o.tamper(&resp)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (o *fakeOracle) publicKey() ed25519.PublicKey {
+	return o.key.Public().(ed25519.PublicKey)
+}
+
+// TestECVRFVector checks Prove and Verify against RFC 9381 example 16 (empty alpha)
+func TestECVRFVector(t *testing.T) {
+	seed, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	sk := ed25519.NewKeyFromSeed(seed)
+	assert.Equal(t, "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		hex.EncodeToString(sk.Public().(ed25519.PublicKey)))
+
+	pi, beta, err := Prove(sk, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "8657106690b5526245a92b003bb079ccd1a92130477671f6fc01ad16f26f723f",
+		hex.EncodeToString(pi[:32]), "gamma")
+	assert.Equal(t, "90cf1df3b703cce59e2a35b925d411164068269d7b2d29f3301c03dd757876ff"+
+		"66b71dda49d2de59d03450451af026798e8f81cd2e333de5cdf4f3e140fdd8ae",
+		hex.EncodeToString(beta))
+
+	verified, err := Verify(sk.Public().(ed25519.PublicKey), pi, nil)
+	require.NoError(t, err)
+	assert.Equal(t, beta, verified)
+}
+
+func TestECVRFRejectsForgeries(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPK, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	alpha := []byte("round 42")
+	pi, _, err := Prove(sk, alpha)
+	require.NoError(t, err)
+
+	_, err = Verify(pk, pi, []byte("round 43"))
+	assert.ErrorIs(t, err, ErrInvalidProof, "wrong alpha")
+
+	_, err = Verify(otherPK, pi, alpha)
+	assert.ErrorIs(t, err, ErrInvalidProof, "wrong key")
+
+	for _, idx := range []int{0, 40, 70} {
+		tampered := append([]byte(nil), pi...)
+		tampered[idx] ^= 0x01
+		_, err = Verify(pk, tampered, alpha)
+		assert.Error(t, err, "flipped byte %d", idx)
+	}
+
+	_, err = Verify(pk, pi[:ProofSize-1], alpha)
+	assert.Error(t, err, "truncated proof")
+}
+
+func TestRequestRandomness(t *testing.T) {
+	oracle := newFakeOracle(t)
+	client := NewSolanaChainlinkVRF(oracle.server.URL, "vrf-program", nil, oracle.publicKey())
+
+	seed := []byte("epoch-7")
+	value, err := client.RequestRandomness(context.Background(), seed)
+	require.NoError(t, err)
+
+	pi, beta, err := Prove(oracle.key, seed)
+	require.NoError(t, err)
+	assert.Equal(t, new(big.Int).SetBytes(beta), value)
+
+	ok, err := client.VerifyRandomness(hex.EncodeToString(pi), hex.EncodeToString(beta), seed)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestRequestRandomnessRejectsBadResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(resp *ChainlinkVRFResponse)
+		wantErr error
+	}{
+		{
+			name:    "request ID mismatch",
+			tamper:  func(resp *ChainlinkVRFResponse) { resp.RequestID = "someone-else" },
+			wantErr: ErrRequestIDMismatch,
+		},
+		{
+			name: "randomness not matching proof",
+			tamper: func(resp *ChainlinkVRFResponse) {
+				resp.Randomness = hex.EncodeToString(make([]byte, OutputSize))
+			},
+			wantErr: ErrInvalidProof,
+		},
+		{
+			name: "proof for another seed",
+			tamper: func(resp *ChainlinkVRFResponse) {
+				_, sk, _ := ed25519.GenerateKey(nil)
+				pi, beta, _ := Prove(sk, []byte("other"))
+				resp.Proof = hex.EncodeToString(pi)
+				resp.Randomness = hex.EncodeToString(beta)
+			},
+			wantErr: ErrInvalidProof,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oracle := newFakeOracle(t)
+			oracle.tamper = tt.tamper
+			client := NewSolanaChainlinkVRF(oracle.server.URL, "vrf-program", nil, oracle.publicKey())
+
+			_, err := client.RequestRandomness(context.Background(), []byte("epoch-7"))
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRequestRandomnessWrongOracleKey(t *testing.T) {
+	oracle := newFakeOracle(t)
+	impostor, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	client := NewSolanaChainlinkVRF(oracle.server.URL, "vrf-program", nil, impostor)
+	_, err = client.RequestRandomness(context.Background(), []byte("epoch-7"))
+	assert.ErrorIs(t, err, ErrInvalidProof)
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/binary"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/blocto/solana-go-sdk/types"
 	"github.com/gagliardetto/solana-go"
@@ -13,6 +18,11 @@ import (
 )
 
 func main() {
+	// The payer defaults to the Solana CLI's keypair
+	home, _ := os.UserHomeDir()
+	keypairPath := flag.String("keypair", filepath.Join(home, ".config", "solana", "id.json"), "Solana CLI keypair paying for the transactions")
+	flag.Parse()
+
 	// Step 1: Connect to Solana Devnet
 	client := rpc.New("https://api.devnet.solana.com")
 
@@ -23,11 +33,10 @@ func main() {
 		log.Fatalf("Invalid program ID: %v", err)
 	}
 
-	// Payer setup (replace with your actual keypair)
-	privateKeyBytes := [64]byte{16, 246, 168, 249, 237, 255, 125, 101, 217, 247, 127, 166, 74, 53, 162, 51, 171, 210, 214, 143, 114, 231, 90, 39, 199, 152, 51, 247, 155, 89, 49, 209, 188, 164, 235, 18, 201, 90, 220, 112, 187, 42, 70, 106, 82, 127, 58, 134, 94, 39, 122, 20, 109, 110, 8, 203, 126, 148, 192, 140, 5, 77, 75, 60}
-	wallet, err := types.AccountFromBytes(privateKeyBytes[:])
+	// Payer setup, refusing keys kept in the repository
+	wallet, err := loadKeypair(*keypairPath)
 	if err != nil {
-		log.Fatalf("Failed to create wallet from private key: %v", err)
+		log.Fatalf("Failed to load payer keypair: %v", err)
 	}
 
 	// Step 3: Define Recipients and Payment Details
@@ -143,3 +152,44 @@ func serializeInstructionData(amounts []uint64, totalAmount uint64, recipients [
 
 	return data, nil
 }
+
+// loadKeypair reads a Solana CLI keypair file, a JSON array of the 64 bytes
+// of the private key, unless it lies inside the repository
+func loadKeypair(path string) (types.Account, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return types.Account{}, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return types.Account{}, err
+	}
+	// The repository is the nearest directory up from here holding .git
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			if rel, err := filepath.Rel(dir, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				return types.Account{}, fmt.Errorf("keypair %s is inside the repository %s", path, dir)
+			}
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return types.Account{}, err
+	}
+	var numbers []int
+	if err := json.Unmarshal(data, &numbers); err != nil {
+		return types.Account{}, fmt.Errorf("invalid keypair file %s: %w", path, err)
+	}
+	key := make([]byte, len(numbers))
+	for i, n := range numbers {
+		if n < 0 || n > 255 {
+			return types.Account{}, fmt.Errorf("invalid keypair file %s: %d is not a byte", path, n)
+		}
+		key[i] = byte(n)
+	}
+	return types.AccountFromBytes(key)
+}
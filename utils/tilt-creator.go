@@ -29,6 +29,7 @@ func ReadTiltCounter() (int, error) {
 	return value, nil
 }
 
+// CreateTilt appends a tilt to the CSV file at filepath; distribution.LoadTilts reads it back
 func CreateTilt(filepath string, id int, receiver []string, businessRules []int, subtilt []int, amount int) (map[string]any, error) {
 	tilt := map[string]any{
 		"id":             id,
@@ -75,53 +76,6 @@ func AppendTiltData(filePath string, id int, receivers []string, businessRules [
 	return nil
 }
 
-func ReadTiltData(filePath string) (map[string]interface{}, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CSV data: %w", err)
-	}
-
-	data := make(map[string]interface{})
-	for _, record := range records {
-		if len(record) < 5 {
-			continue
-		}
-
-		id := record[0]
-		receivers := strings.Split(record[1], ";")
-		var businessRules []int
-		if err := json.Unmarshal([]byte(record[2]), &businessRules); err != nil {
-			return nil, fmt.Errorf("failed to parse business rules: %w", err)
-		}
-		var subtilt []int
-		if record[3] != "null" {
-			if err := json.Unmarshal([]byte(record[3]), &subtilt); err != nil {
-				return nil, fmt.Errorf("failed to parse subtilt: %w", err)
-			}
-		}
-		amount, err := strconv.Atoi(record[4])
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse amount: %w", err)
-		}
-
-		data[id] = map[string]interface{}{
-			"receiver":       receivers, // Changed from "receivers" to "receiver"
-			"business_rules": businessRules,
-			"subtilt":        subtilt,
-			"amount":         amount,
-		}
-	}
-
-	return data, nil
-}
-
 func CreateRandomRecievers() []string {
 	numReceivers := 2
 	receivers := make([]string, numReceivers)